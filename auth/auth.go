@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// ErrPermissionDenied is returned when a principal is not allowed to access a resource.
+var ErrPermissionDenied = errors.New("permission denied")
+
+type (
+	// Permission is a kind of access to a node, its attributes or its components.
+	Permission string
+
+	// Principal is the identity a caller acts as.
+	Principal struct {
+		ID    string
+		Roles []string
+	}
+
+	// Resource describes what a principal wants to access.
+	Resource struct {
+		NodeID      string   // node being accessed, empty for a node to be created
+		Ancestors   []string // IDs of the ancestors of the node, from its parent up to the root
+		Schema      string   // schema name of the node
+		Attribute   string   // attribute being accessed, empty for the whole node
+		ComponentID string   // component being invoked, empty if no component is involved
+	}
+
+	// IAuthorizer is the interface for deciding whether a principal holds a permission on a resource.
+	IAuthorizer interface {
+		Authorize(ctx context.Context, principal Principal, permission Permission, resource Resource) bool
+	}
+
+	// Policy grants permissions to subjects on the resources it matches.
+	// Empty scope fields match everything, non-empty ones must all match.
+	Policy struct {
+		Subjects    []string     // principal IDs, "role:<name>" for principals having a role, or "*" for everyone
+		Permissions []Permission // granted permissions, Admin grants every permission
+		Subtree     string       // ID of the node rooting the subtree the policy applies to
+		Schema      string       // schema name of the nodes the policy applies to
+		Attributes  []string     // attributes the policy applies to, which only matches attribute-level access
+	}
+
+	// PolicyAuthorizer is an authorizer granting access by a set of policies.
+	// Access not granted by any policy is denied.
+	PolicyAuthorizer struct {
+		policies []Policy
+		mu       sync.RWMutex
+	}
+
+	principalKey struct{}
+)
+
+const (
+	Read   Permission = "READ"
+	Write  Permission = "WRITE"
+	Invoke Permission = "INVOKE"
+	Admin  Permission = "ADMIN"
+)
+
+// Anonymous is the principal of callers not providing one through context.
+var Anonymous = Principal{ID: "anonymous"}
+
+// WithPrincipal returns a copy of ctx carrying the principal.
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal carried by ctx, or Anonymous if there is none.
+func PrincipalFromContext(ctx context.Context) Principal {
+	if principal, ok := ctx.Value(principalKey{}).(Principal); ok {
+		return principal
+	}
+	return Anonymous
+}
+
+func NewPolicyAuthorizer(policies ...Policy) *PolicyAuthorizer {
+	return &PolicyAuthorizer{
+		policies: policies,
+	}
+}
+
+// AddPolicy adds a policy to the authorizer.
+func (a *PolicyAuthorizer) AddPolicy(policy Policy) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.policies = append(a.policies, policy)
+}
+
+// Authorize reports whether any policy grants the permission on the resource to the principal.
+func (a *PolicyAuthorizer) Authorize(ctx context.Context, principal Principal, permission Permission, resource Resource) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	for _, policy := range a.policies {
+		if policy.grants(principal, permission) && policy.matches(resource) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) grants(principal Principal, permission Permission) bool {
+	if !slices.Contains(p.Permissions, permission) && !slices.Contains(p.Permissions, Admin) {
+		return false
+	}
+	for _, subject := range p.Subjects {
+		if subject == "*" || subject == principal.ID {
+			return true
+		}
+		for _, role := range principal.Roles {
+			if subject == "role:"+role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *Policy) matches(resource Resource) bool {
+	if p.Subtree != "" && p.Subtree != resource.NodeID && !slices.Contains(resource.Ancestors, p.Subtree) {
+		return false
+	}
+	if p.Schema != "" && p.Schema != resource.Schema {
+		return false
+	}
+	if len(p.Attributes) > 0 && !slices.Contains(p.Attributes, resource.Attribute) {
+		return false
+	}
+	return true
+}
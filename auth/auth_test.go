@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPolicyAuthorizer(t *testing.T) {
+	authorizer := NewPolicyAuthorizer(
+		Policy{Subjects: []string{"alice"}, Permissions: []Permission{Admin}, Subtree: "root"},
+		Policy{Subjects: []string{"role:viewer"}, Permissions: []Permission{Read}, Schema: "SumNode", Attributes: []string{"name"}},
+		Policy{Subjects: []string{"*"}, Permissions: []Permission{Invoke}, Schema: "SumNode"},
+	)
+
+	ctx := context.Background()
+	alice := Principal{ID: "alice"}
+	bob := Principal{ID: "bob", Roles: []string{"viewer"}}
+
+	testCases := []struct {
+		principal  Principal
+		permission Permission
+		resource   Resource
+		expected   bool
+	}{
+		// admin on a subtree grants everything on its nodes
+		{alice, Write, Resource{NodeID: "root"}, true},
+		{alice, Write, Resource{NodeID: "child", Ancestors: []string{"root"}, Attribute: "result"}, true},
+		{alice, Read, Resource{NodeID: "other"}, false},
+
+		// attribute-level policies only match accesses to those attributes
+		{bob, Read, Resource{NodeID: "child", Schema: "SumNode", Attribute: "name"}, true},
+		{bob, Read, Resource{NodeID: "child", Schema: "SumNode", Attribute: "result"}, false},
+		{bob, Read, Resource{NodeID: "child", Schema: "SumNode"}, false},
+		{bob, Read, Resource{NodeID: "child", Schema: "BaseNode", Attribute: "name"}, false},
+
+		// wildcard subjects include anonymous principals
+		{Anonymous, Invoke, Resource{NodeID: "child", Schema: "SumNode", ComponentID: "compo"}, true},
+		{Anonymous, Write, Resource{NodeID: "child", Schema: "SumNode"}, false},
+	}
+
+	for i, tc := range testCases {
+		if granted := authorizer.Authorize(ctx, tc.principal, tc.permission, tc.resource); granted != tc.expected {
+			t.Errorf("case %d: %s %s on %+v is expected to be %v, but is %v", i, tc.principal.ID, tc.permission, tc.resource, tc.expected, granted)
+		}
+	}
+}
+
+func TestPrincipalFromContext(t *testing.T) {
+	if principal := PrincipalFromContext(context.Background()); principal.ID != Anonymous.ID {
+		t.Fatalf("principal of empty context is expected to be anonymous, but is %v", principal)
+	}
+
+	ctx := WithPrincipal(context.Background(), Principal{ID: "alice"})
+	if principal := PrincipalFromContext(ctx); principal.ID != "alice" {
+		t.Fatalf("principal is expected to be alice, but is %v", principal)
+	}
+}
@@ -1,33 +1,33 @@
 package component
 
 import (
-	"container/heap"
 	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	componentinterface "github.com/world-in-progress/yggdrasil/component/interface"
 	"github.com/world-in-progress/yggdrasil/component/restfulcomponent"
+	"github.com/world-in-progress/yggdrasil/core/metrics"
+	"github.com/world-in-progress/yggdrasil/core/structure"
 )
 
 type (
 	ComponentType string
 
-	componentEntry struct {
-		index int
-		id    string
-		compo componentinterface.IComponent
-	}
-
-	componentHeap []*componentEntry
+	// ManagerOption configures a component manager created by NewComponentManager.
+	ManagerOption func(*ComponentManager)
 
 	ComponentManager struct {
-		cacheSize      int
-		componentCache sync.Map
-		heap           componentHeap
-		repo           componentinterface.IRepository
+		name      string
+		cacheSize int
+		stats     metrics.CacheCounters
+		cache     *structure.Cache[string, componentinterface.IComponent]
+		limiters  sync.Map // limiters of components by ID, kept while components are inactive
+		bus       atomic.Pointer[managerBus]
+		repo      componentinterface.IRepository
 
 		mu sync.RWMutex
 	}
@@ -40,19 +40,32 @@ const (
 	Runtime ComponentType = "RUNTIME"
 )
 
-func NewComponentManager(name string, repo componentinterface.IRepository, cacheSize uint) (*ComponentManager, error) {
-	t := &ComponentManager{
-		repo:           repo,
-		componentCache: sync.Map{},
-		cacheSize:      int(cacheSize),
-		heap:           make(componentHeap, 0),
+// WithCachePolicy sets the policy evicting components from the runtime cache, the least recently used first by default.
+func WithCachePolicy(policy structure.ICachePolicy[string]) ManagerOption {
+	return func(c *ComponentManager) {
+		c.cache = structure.NewCache[string, componentinterface.IComponent](policy)
 	}
+}
 
-	heap.Init(&t.heap)
-	return t, nil
+func NewComponentManager(name string, repo componentinterface.IRepository, cacheSize uint, opts ...ManagerOption) (*ComponentManager, error) {
+	c := &ComponentManager{
+		name:      name,
+		repo:      repo,
+		cacheSize: int(cacheSize),
+		cache:     structure.NewCache[string, componentinterface.IComponent](structure.NewLRUPolicy[string]()),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
 }
 
 func (c *ComponentManager) RegisterComponent(compoType ComponentType, providedSchema any) (string, error) {
+	return c.RegisterComponentCtx(context.Background(), compoType, providedSchema)
+}
+
+// RegisterComponentCtx records a component schema in repository and activates the component with context.
+func (c *ComponentManager) RegisterComponentCtx(ctx context.Context, compoType ComponentType, providedSchema any) (string, error) {
 	// convert compoSchema to type of map[string]any
 	var schemaMap map[string]any
 	switch t := providedSchema.(type) {
@@ -81,14 +94,13 @@ func (c *ComponentManager) RegisterComponent(compoType ComponentType, providedSc
 	}
 
 	// add schema to repository
-	ctx := context.Background()
 	ID, err := c.repo.Create(ctx, "composchema", schema)
 	if err != nil {
 		return "", fmt.Errorf("failed to record component schema in repository: %v", err)
 	}
 
 	// active component
-	if err := c.activateComponent(ID); err != nil {
+	if _, err := c.activateComponent(ctx, ID); err != nil {
 		return "", fmt.Errorf("failed to active component: %v", err)
 	}
 	return ID, nil
@@ -96,38 +108,56 @@ func (c *ComponentManager) RegisterComponent(compoType ComponentType, providedSc
 
 // GetComponent gets a component interface through cache or deserializing from repository record.
 func (c *ComponentManager) GetComponent(ID string) (componentinterface.IComponent, error) {
+	return c.GetComponentCtx(context.Background(), ID)
+}
+
+// GetComponentCtx gets a component interface through cache or deserializing from repository record with context.
+func (c *ComponentManager) GetComponentCtx(ctx context.Context, ID string) (componentinterface.IComponent, error) {
 	// get component if it is active
-	if val, loaded := c.componentCache.Load(ID); loaded {
-		return val.(componentinterface.IComponent), nil
+	if compo, ok := c.cache.Get(ID); ok {
+		c.stats.Hit()
+		return compo, nil
 	}
 
-	if err := c.activateComponent(ID); err != nil {
+	c.stats.Miss()
+	compo, err := c.activateComponent(ctx, ID)
+	if err != nil {
 		return nil, fmt.Errorf("failed to get component in repository: %v", err)
-	} else {
-		return c.GetComponent(ID)
 	}
+	return compo, nil
 }
 
 // DeleteComponent deletes cache and repository record from the provided component
 func (c *ComponentManager) DeleteComponent(ID string) error {
+	return c.DeleteComponentCtx(context.Background(), ID)
+}
+
+// DeleteComponentCtx deletes cache and repository record from the provided component with context.
+func (c *ComponentManager) DeleteComponentCtx(ctx context.Context, ID string) error {
 	// get component
-	_, err := c.GetComponent(ID)
+	_, err := c.GetComponentCtx(ctx, ID)
 	if err != nil {
 		return fmt.Errorf("failed to get component: %v", err)
 	}
 
 	// deactivate
 	c.deactivateComponent(ID)
+	c.limiters.Delete(ID)
 
 	// delete component record in repository
-	ctx := context.Background()
 	if err := c.repo.Delete(ctx, "composchema", map[string]any{"_id": ID}); err != nil {
 		return fmt.Errorf("failed to delete component record: %v", err)
 	}
+	c.publish(ctx, ID)
 
 	return nil
 }
 
+// DiscardComponent deactivates a component, so that it is loaded again from its record once requested.
+func (c *ComponentManager) DiscardComponent(ID string) {
+	c.deactivateComponent(ID)
+}
+
 // Shrink clear the cache to half its size.
 func (c *ComponentManager) Shrink() error {
 	c.mu.Lock()
@@ -137,17 +167,36 @@ func (c *ComponentManager) Shrink() error {
 
 // GetActiveComponentNum counts all active components in the cache.
 func (c *ComponentManager) GetActiveComponentNum() int {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	return c.heap.Len()
+	return c.cache.Len()
+}
+
+// CacheStats snapshots the statistics of the runtime cache of the component manager.
+// Components are never dirty, so no flush is counted.
+func (c *ComponentManager) CacheStats() metrics.CacheStats {
+	return c.stats.Stats(c.cache.Len())
+}
+
+// RegisterMetrics exposes the statistics of the runtime cache of the component manager in a registry,
+// labeled by the component manager name.
+func (c *ComponentManager) RegisterMetrics(r *metrics.Registry) {
+	metrics.RegisterCache(r, c.name, c.CacheStats)
+}
+
+// UnregisterMetrics removes the statistics of the runtime cache of the component manager from a registry.
+func (c *ComponentManager) UnregisterMetrics(r *metrics.Registry) {
+	metrics.UnregisterCache(r, c.name)
 }
 
 // GetComponentRecordNum counts all component records in the repository.
 func (c *ComponentManager) GetComponentRecordNum() (int64, error) {
+	return c.GetComponentRecordNumCtx(context.Background())
+}
+
+// GetComponentRecordNumCtx counts all component records in the repository with context.
+func (c *ComponentManager) GetComponentRecordNumCtx(ctx context.Context) (int64, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	ctx := context.Background()
 	if count, err := c.repo.Count(ctx, "node", nil); err != nil {
 		return 0, fmt.Errorf("failed to count node record in repository: %v", err)
 	} else {
@@ -155,26 +204,23 @@ func (c *ComponentManager) GetComponentRecordNum() (int64, error) {
 	}
 }
 
-// activateComponent activates a component from repository record to the runtime cache.
-func (c *ComponentManager) activateComponent(ID string) error {
+// activateComponent activates a component from repository record to the runtime cache, and returns it.
+func (c *ComponentManager) activateComponent(ctx context.Context, ID string) (componentinterface.IComponent, error) {
 	// check if is active
-	if _, loaded := c.componentCache.LoadOrStore(ID, nil); loaded {
-		return nil
+	if compo, ok := c.cache.Peek(ID); ok {
+		return compo, nil
 	}
 
 	// find if is in repository
-	var err error
-	ctx := context.Background()
 	schema, err := c.repo.ReadOne(ctx, "composchema", map[string]any{"_id": ID})
 	if err != nil {
-		c.componentCache.Delete(ID)
-		return fmt.Errorf("cannot activate component not existing: %v", err)
+		return nil, fmt.Errorf("cannot activate component not existing: %v", err)
 	}
 
 	// get component type
 	var compoType ComponentType
 	if infos := strings.Split(ID, "-"); len(infos) != 6 {
-		return fmt.Errorf("provided ID %s is not valid", ID)
+		return nil, fmt.Errorf("provided ID %s is not valid", ID)
 	} else {
 		compoType = ComponentType(infos[0])
 	}
@@ -185,27 +231,19 @@ func (c *ComponentManager) activateComponent(ID string) error {
 	case Restful:
 		compo, err = restfulcomponent.NewRestfulComponentInstance(schema)
 		if err != nil {
-			return fmt.Errorf("cannot instantiate RESTful component from ID %v: %v", ID, err)
+			return nil, fmt.Errorf("cannot instantiate RESTful component from ID %v: %v", ID, err)
 		}
 		// TODO: implement other cases
 	default:
-		return fmt.Errorf("cannot instantiate component from an unknown type: %v", compoType)
+		return nil, fmt.Errorf("cannot instantiate component from an unknown type: %v", compoType)
 	}
-	c.componentCache.Store(ID, compo)
-	return c.addToHeap(compo)
+	compo = c.withLimits(compo)
+	return compo, c.addToCache(ID, compo)
 }
 
 // deactivateComponent deactivates a node from the runtime cache.
 func (c *ComponentManager) deactivateComponent(ID string) {
-	// check if is inactive
-	val, loaded := c.componentCache.LoadAndDelete(ID)
-	if !loaded || val == nil {
-		return
-	}
-	compo := val.(componentinterface.IComponent)
-
-	// remove from heap
-	c.removeFromHeap(compo)
+	c.cache.Remove(ID)
 }
 
 func (c *ComponentManager) shrinkLocked() error {
@@ -214,68 +252,19 @@ func (c *ComponentManager) shrinkLocked() error {
 		toSize = 1
 	}
 
-	if c.heap.Len() <= c.cacheSize {
+	if c.cache.Len() <= c.cacheSize {
 		return nil
 	}
-
-	heap.Init(&c.heap)
-	for c.heap.Len() > toSize {
-
-		// remove from heap
-		entry := heap.Pop(&c.heap).(*componentEntry)
-
-		// deactivate compo
-		compo := entry.compo
-		ID := compo.GetID()
-		c.componentCache.Delete(ID)
+	for range c.cache.Shrink(toSize) {
+		c.stats.Evict()
 	}
 	return nil
 }
 
-func (c *ComponentManager) addToHeap(component componentinterface.IComponent) error {
+func (c *ComponentManager) addToCache(ID string, compo componentinterface.IComponent) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	entry := &componentEntry{
-		id:    component.GetID(),
-		compo: component,
-	}
-	heap.Push(&c.heap, entry)
+	c.cache.Add(ID, compo)
 	return c.shrinkLocked()
 }
-
-func (c *ComponentManager) removeFromHeap(component componentinterface.IComponent) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	for i, entry := range c.heap {
-		if entry.compo == component {
-			heap.Remove(&c.heap, i)
-			break
-		}
-	}
-}
-
-func (h componentHeap) Len() int { return len(h) }
-func (h componentHeap) Less(i, j int) bool {
-	return h[i].compo.GetCallTime().Before(h[j].compo.GetCallTime())
-}
-func (h componentHeap) Swap(i, j int) {
-	h[i], h[j] = h[j], h[i]
-	h[i].index = i
-	h[j].index = j
-}
-func (h *componentHeap) Push(x any) {
-	entry := x.(*componentEntry)
-	entry.index = len(*h)
-	*h = append(*h, entry)
-}
-func (h *componentHeap) Pop() any {
-	old := *h
-	n := len(old)
-	entry := old[n-1]
-	old[n-1] = nil
-	entry.index = -1
-	*h = old[0 : n-1]
-	return entry
-}
@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/spf13/viper"
+	"github.com/world-in-progress/yggdrasil/core/invalidation"
+	"github.com/world-in-progress/yggdrasil/db/memory"
 	"github.com/world-in-progress/yggdrasil/db/mongo"
 )
 
@@ -53,7 +56,10 @@ func TestComponentManager(t *testing.T) {
 	// init component manager and its dependencies
 	var err error
 	var cacheSize uint = 1 // only one component can be stored in the runtime cache
-	repo := mongo.NewMongoRepository()
+	repo, err := mongo.NewMongoRepository()
+	if err != nil {
+		t.Fatal(err)
+	}
 	cManager, err := NewComponentManager("Test Component Manager", repo, cacheSize)
 	if err != nil {
 		t.Fatal(err)
@@ -133,3 +139,37 @@ func TestComponentManager(t *testing.T) {
 		fmt.Printf("components have all been deleted\n\n\n")
 	}
 }
+
+func TestComponentInvalidation(t *testing.T) {
+	repo := memory.NewMemoryRepository()
+	bus := invalidation.NewMemoryBus()
+	managerA, _ := NewComponentManager("Test manager", repo, 16)
+	managerB, _ := NewComponentManager("Test manager", repo, 16)
+	managerA.SetInvalidationBus(bus)
+	managerB.SetInvalidationBus(bus)
+	defer managerA.SetInvalidationBus(nil)
+	defer managerB.SetInvalidationBus(nil)
+
+	compoID, err := managerA.RegisterComponent(Restful, map[string]any{"method": "GET", "name": "API", "api": "http://127.0.0.1:8000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := managerB.GetComponent(compoID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The component deleted by manager A is not served by manager B
+	if err := managerA.DeleteComponent(compoID); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := managerB.GetComponent(compoID); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("component deleted by another manager is expected to be invalidated")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
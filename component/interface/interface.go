@@ -21,6 +21,21 @@ type (
 		GetName() string
 		GetCallTime() time.Time
 		Execute(node INode, params map[string]any, client *http.Client, headers map[string]string) (map[string]any, error)
+		ExecuteCtx(ctx context.Context, node INode, params map[string]any, client *http.Client, headers map[string]string) (map[string]any, error)
+	}
+
+	// CallLimits are limits on calls of a component, enforced for all callers sharing a component manager.
+	// Zero values disable the respective limit, and a zero WaitTimeout rejects calls over a limit at once.
+	CallLimits struct {
+		RequestsPerSecond float64
+		Burst             int
+		MaxInFlight       int
+		WaitTimeout       time.Duration
+	}
+
+	// ILimitedComponent is the interface for a component declaring limits on its calls.
+	ILimitedComponent interface {
+		GetCallLimits() *CallLimits
 	}
 
 	// ITask is the interface for a worker task.
@@ -0,0 +1,46 @@
+package component
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/world-in-progress/yggdrasil/core/invalidation"
+	"github.com/world-in-progress/yggdrasil/core/logger"
+)
+
+// managerBus is the invalidation bus of a component manager, with the ID the manager publishes events as.
+type managerBus struct {
+	bus         invalidation.IBus
+	source      string
+	unsubscribe func()
+}
+
+// SetInvalidationBus shares invalidations of component records with other managers subscribing to bus.
+// Records deleted by the manager are published as invalidated, and components whose records are deleted by other
+// managers are deactivated. A nil bus stops sharing invalidations.
+func (c *ComponentManager) SetInvalidationBus(bus invalidation.IBus) {
+	var mb *managerBus
+	if bus != nil {
+		mb = &managerBus{bus: bus, source: uuid.New().String()}
+		mb.unsubscribe = bus.Subscribe(func(event invalidation.Event) {
+			if event.Source == mb.source || event.Table != "composchema" {
+				return
+			}
+			c.deactivateComponent(event.ID)
+		})
+	}
+	if old := c.bus.Swap(mb); old != nil {
+		old.unsubscribe()
+	}
+}
+
+// publish publishes the record of a component as invalidated.
+func (c *ComponentManager) publish(ctx context.Context, ID string) {
+	mb := c.bus.Load()
+	if mb == nil {
+		return
+	}
+	if err := mb.bus.Publish(ctx, invalidation.Event{Source: mb.source, Table: "composchema", ID: ID}); err != nil {
+		logger.FromContext(ctx).WithError(err).Warn("Failed to publish invalidation of component %s", ID)
+	}
+}
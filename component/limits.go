@@ -0,0 +1,55 @@
+package component
+
+import (
+	"context"
+	"net/http"
+
+	componentinterface "github.com/world-in-progress/yggdrasil/component/interface"
+	"github.com/world-in-progress/yggdrasil/core/limiter"
+)
+
+// limitedComponent enforces the call limits of a component shared by all its instances of a component manager.
+type limitedComponent struct {
+	componentinterface.IComponent
+	limiter *limiter.Limiter
+	limits  *componentinterface.CallLimits
+}
+
+// withLimits wraps a component declaring call limits with the limiter of its ID,
+// which outlives deactivations of the component so that limits hold while it is reactivated.
+func (c *ComponentManager) withLimits(compo componentinterface.IComponent) componentinterface.IComponent {
+	limited, ok := compo.(componentinterface.ILimitedComponent)
+	if !ok {
+		return compo
+	}
+	limits := limited.GetCallLimits()
+	if limits == nil || (limits.RequestsPerSecond <= 0 && limits.MaxInFlight <= 0) {
+		return compo
+	}
+
+	l, _ := c.limiters.LoadOrStore(compo.GetID(), limiter.NewLimiter(compo.GetID(), limits.RequestsPerSecond, limits.Burst, limits.MaxInFlight))
+	return &limitedComponent{
+		IComponent: compo,
+		limiter:    l.(*limiter.Limiter),
+		limits:     limits,
+	}
+}
+
+func (lc *limitedComponent) Execute(node componentinterface.INode, params map[string]any, client *http.Client, headers map[string]string) (map[string]any, error) {
+	return lc.ExecuteCtx(context.Background(), node, params, client, headers)
+}
+
+// ExecuteCtx executes the component once admitted by its limiter, failing with a limiter.LimitError
+// if it is not admitted within the waiting time of its limits.
+func (lc *limitedComponent) ExecuteCtx(ctx context.Context, node componentinterface.INode, params map[string]any, client *http.Client, headers map[string]string) (map[string]any, error) {
+	release, err := lc.limiter.Acquire(ctx, lc.limits.WaitTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return lc.IComponent.ExecuteCtx(ctx, node, params, client, headers)
+}
+
+func (lc *limitedComponent) GetCallLimits() *componentinterface.CallLimits {
+	return lc.limits
+}
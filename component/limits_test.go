@@ -0,0 +1,73 @@
+package component
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/world-in-progress/yggdrasil/core/limiter"
+	"github.com/world-in-progress/yggdrasil/db/memory"
+)
+
+func TestComponentLimits(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	gate := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := inFlight.Add(1); n > maxInFlight.Load() {
+			maxInFlight.Store(n)
+		}
+		<-gate
+		inFlight.Add(-1)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	manager, _ := NewComponentManager("Test manager", memory.NewMemoryRepository(), 1) // limits outlive evictions
+	compoID, err := manager.RegisterComponent(Restful, map[string]any{
+		"method":      "GET",
+		"name":        "Limited API",
+		"api":         server.URL,
+		"resStatuses": []any{map[string]any{"code": 200}},
+		"rateLimit":   map[string]any{"maxInFlight": 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var rejected atomic.Int32
+	for range 4 {
+		// the component is evicted and reactivated between calls
+		if _, err := manager.RegisterComponent(Restful, map[string]any{"method": "GET", "name": "Other API", "api": server.URL}); err != nil {
+			t.Fatal(err)
+		}
+		compo, err := manager.GetComponent(compoID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := compo.Execute(nil, map[string]any{}, nil, nil); errors.Is(err, limiter.ErrLimitExceeded) {
+				rejected.Add(1)
+			} else if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for (rejected.Load() < 2 || inFlight.Load() < 2) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(gate)
+	wg.Wait()
+	if maxInFlight.Load() != 2 || rejected.Load() != 2 {
+		t.Fatalf("2 calls are expected in flight and 2 rejected, but got %d in flight and %d rejected", maxInFlight.Load(), rejected.Load())
+	}
+}
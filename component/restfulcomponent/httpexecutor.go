@@ -1,18 +1,50 @@
 package restfulcomponent
 
-import "net/http"
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/world-in-progress/yggdrasil/core/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
 
 type HTTPExecutor struct {
 	Client  *http.Client
 	Headers map[string]string
 }
 
+// Execute sends the request in a client span started from the request context.
+// Trace context is injected into request headers through the global propagator set by otel.SetTextMapPropagator.
 func (e *HTTPExecutor) Execute(req *http.Request) (*http.Response, error) {
 	if e.Client == nil {
 		e.Client = &http.Client{}
 	}
+
+	ctx, span := tracing.Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", req.URL.String()),
+		),
+	)
+	req = req.WithContext(ctx)
+
 	for key, value := range e.Headers {
 		req.Header.Set(key, value)
 	}
-	return e.Client.Do(req)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := e.Client.Do(req)
+	if err == nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, fmt.Sprintf("HTTP status %d", resp.StatusCode))
+		}
+	}
+	tracing.End(span, err)
+	return resp, err
 }
@@ -2,8 +2,10 @@ package restfulcomponent
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
@@ -12,6 +14,11 @@ import (
 type RequestBuilder struct{}
 
 func (b *RequestBuilder) BuildRequest(c *RestfulComponent, params map[string]any) (*http.Request, error) {
+	return b.BuildRequestCtx(context.Background(), c, params)
+}
+
+// BuildRequestCtx builds the http request of a component call bound to ctx.
+func (b *RequestBuilder) BuildRequestCtx(ctx context.Context, c *RestfulComponent, params map[string]any) (*http.Request, error) {
 	// build URL
 	apiURL := c.API
 	for _, param := range c.ReqParams {
@@ -82,7 +89,7 @@ func (b *RequestBuilder) BuildRequest(c *RestfulComponent, params map[string]any
 	}
 
 	// build request body
-	var reqBody *bytes.Buffer
+	var reqBody io.Reader // keep nil interface for requests without body
 	if c.Method == POST || c.Method == PUT || c.Method == PATCH {
 		if len(bodyParams) > 0 {
 			body, err := json.Marshal(bodyParams)
@@ -94,7 +101,7 @@ func (b *RequestBuilder) BuildRequest(c *RestfulComponent, params map[string]any
 	}
 
 	// create request
-	req, err := http.NewRequest(string(c.Method), apiURL, reqBody)
+	req, err := http.NewRequestWithContext(ctx, string(c.Method), apiURL, reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
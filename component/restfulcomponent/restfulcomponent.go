@@ -1,6 +1,7 @@
 package restfulcomponent
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -33,6 +34,15 @@ type (
 		Params      []ParamDescription `json:"params,omitempty"`
 	}
 
+	// RateLimit limits calls of a component by a token bucket and a maximum number of calls in flight.
+	// Calls over a limit wait for at most WaitTimeoutMs milliseconds before being rejected.
+	RateLimit struct {
+		RequestsPerSecond float64 `json:"requestsPerSecond,omitempty"`
+		Burst             int     `json:"burst,omitempty"`
+		MaxInFlight       int     `json:"maxInFlight,omitempty"`
+		WaitTimeoutMs     int     `json:"waitTimeoutMs,omitempty"`
+	}
+
 	RestfulComponent struct {
 		ID          string             `json:"_id"`
 		Name        string             `json:"name"`
@@ -43,6 +53,7 @@ type (
 		ReqParams   []ParamDescription `json:"reqParams,omitempty"`
 		ResStatuses []ResponseStatus   `json:"resStatuses,omitempty"`
 		Deprecated  bool               `json:"deprecated,omitempty"`
+		RateLimit   *RateLimit         `json:"rateLimit,omitempty"`
 
 		callTime time.Time
 	}
@@ -115,6 +126,11 @@ func NewRestfulComponent(schema map[string]any) (map[string]any, error) {
 		return nil, fmt.Errorf("invalid HTTP method '%s'", c.Method)
 	}
 
+	// verify rate limit
+	if l := c.RateLimit; l != nil && (l.RequestsPerSecond < 0 || l.Burst < 0 || l.MaxInFlight < 0 || l.WaitTimeoutMs < 0) {
+		return nil, fmt.Errorf("rate limit of component '%s' cannot be negative", c.Name)
+	}
+
 	// verify kind of request params and set default values
 	for i := range c.ReqParams {
 		if err := validateAndSetParamDefaults(&c.ReqParams[i], c.ReqParams[i].Name); err != nil {
@@ -156,7 +172,25 @@ func (c *RestfulComponent) GetCallTime() time.Time {
 	return c.callTime
 }
 
+// GetCallLimits returns the limits declared by the rate limit of the component, nil if it declares none.
+func (c *RestfulComponent) GetCallLimits() *componentinterface.CallLimits {
+	if c.RateLimit == nil {
+		return nil
+	}
+	return &componentinterface.CallLimits{
+		RequestsPerSecond: c.RateLimit.RequestsPerSecond,
+		Burst:             c.RateLimit.Burst,
+		MaxInFlight:       c.RateLimit.MaxInFlight,
+		WaitTimeout:       time.Duration(c.RateLimit.WaitTimeoutMs) * time.Millisecond,
+	}
+}
+
 func (c *RestfulComponent) Execute(node componentinterface.INode, params map[string]any, client *http.Client, headers map[string]string) (map[string]any, error) {
+	return c.ExecuteCtx(context.Background(), node, params, client, headers)
+}
+
+// ExecuteCtx sends the request built from params and node attributes, bound to ctx for cancellation and deadlines.
+func (c *RestfulComponent) ExecuteCtx(ctx context.Context, node componentinterface.INode, params map[string]any, client *http.Client, headers map[string]string) (map[string]any, error) {
 	// overwrite specific param by node attribute if not provided by params
 	if node != nil {
 		for _, reqParam := range c.ReqParams {
@@ -175,7 +209,7 @@ func (c *RestfulComponent) Execute(node componentinterface.INode, params map[str
 	}
 
 	builder := &RequestBuilder{}
-	req, err := builder.BuildRequest(c, params)
+	req, err := builder.BuildRequestCtx(ctx, c, params)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"log"
+
+	"github.com/spf13/viper"
+)
+
+type LoggerConfig struct {
+	Level      string // debug, info, warn or error
+	Format     string // json or text
+	File       string // empty for stderr
+	MaxSizeMB  int    // size a log file is rotated at, zero for never
+	MaxBackups int    // number of rotated log files kept
+}
+
+func LoadLoggerConfig() LoggerConfig {
+	viper.AutomaticEnv() // enable overwrite envs
+
+	// default
+	viper.SetDefault("logger.level", "info")
+	viper.SetDefault("logger.format", "json")
+	viper.SetDefault("logger.file", "")
+	viper.SetDefault("logger.max_size_mb", 100)
+	viper.SetDefault("logger.max_backups", 3)
+
+	if err := viper.ReadInConfig(); err != nil {
+		log.Printf("no config file found, use default congifuration: %v", err)
+	}
+
+	return LoggerConfig{
+		Level:      viper.GetString("logger.level"),
+		Format:     viper.GetString("logger.format"),
+		File:       viper.GetString("logger.file"),
+		MaxSizeMB:  viper.GetInt("logger.max_size_mb"),
+		MaxBackups: viper.GetInt("logger.max_backups"),
+	}
+}
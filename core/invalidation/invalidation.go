@@ -0,0 +1,103 @@
+package invalidation
+
+import (
+	"context"
+	"sync"
+
+	"github.com/world-in-progress/yggdrasil/core/structure"
+	"github.com/world-in-progress/yggdrasil/core/threading"
+)
+
+type (
+	// Event invalidates copies of a record cached by instances other than its source.
+	Event struct {
+		Source string // ID of the instance changing the record
+		Table  string
+		ID     string
+	}
+
+	// Handler handles events delivered by a bus.
+	Handler func(event Event)
+
+	// IBus is the interface for a channel delivering invalidation events to every instance subscribing to it.
+	// Events are delivered asynchronously, and to their source as well.
+	IBus interface {
+		Publish(ctx context.Context, event Event) error
+		Subscribe(handler Handler) (unsubscribe func())
+	}
+
+	// MemoryBus is an in-process bus, delivering events to every subscriber in the order they are published.
+	MemoryBus struct {
+		mu          sync.Mutex
+		subscribers map[*subscriber]struct{}
+	}
+
+	subscriber struct {
+		handler Handler
+		events  *structure.ElasticBuffer[Event]
+		notify  chan struct{}
+		quit    chan struct{}
+	}
+)
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+// Publish queues an event for every subscriber without blocking.
+func (b *MemoryBus) Publish(ctx context.Context, event Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subscribers {
+		s.events.Push(event)
+		select {
+		case s.notify <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Subscribe runs handler for every event published from now on, until unsubscribe is called.
+func (b *MemoryBus) Subscribe(handler Handler) func() {
+	s := &subscriber{
+		handler: handler,
+		events:  structure.NewElasticBuffer[Event](64),
+		notify:  make(chan struct{}, 1),
+		quit:    make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	b.subscribers[s] = struct{}{}
+	b.mu.Unlock()
+	threading.GoSafe(s.run)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, s)
+			b.mu.Unlock()
+			close(s.quit)
+		})
+	}
+}
+
+func (s *subscriber) run() {
+	for {
+		select {
+		case <-s.notify:
+			for event, ok := s.events.Pop(); ok; event, ok = s.events.Pop() {
+				threading.RunSafe(func() { s.handler(event) })
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package invalidation
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryBus(t *testing.T) {
+	bus := NewMemoryBus()
+
+	var mu sync.Mutex
+	received := make([][]string, 2)
+	var wg sync.WaitGroup
+	wg.Add(2 * 100)
+	unsubscribes := make([]func(), 2)
+	for i := range received {
+		unsubscribes[i] = bus.Subscribe(func(event Event) {
+			mu.Lock()
+			received[i] = append(received[i], event.ID)
+			mu.Unlock()
+			wg.Done()
+		})
+	}
+
+	for i := range 100 {
+		if err := bus.Publish(context.Background(), Event{Source: "test", Table: "node", ID: string(rune('a' + i%26))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	for i, IDs := range received {
+		for j, ID := range IDs {
+			if ID != string(rune('a'+j%26)) {
+				t.Fatalf("subscriber %v is expected to receive events in order, but got %v", i, IDs)
+			}
+		}
+	}
+
+	// Unsubscribed handlers receive no more events
+	unsubscribes[0]()
+	wg.Add(1)
+	bus.Publish(context.Background(), Event{Source: "test", Table: "node", ID: "z"})
+	wg.Wait()
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received[0]) != 100 || len(received[1]) != 101 {
+		t.Fatalf("only subscribed handlers are expected to receive events, but got %v and %v events", len(received[0]), len(received[1]))
+	}
+}
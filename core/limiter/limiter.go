@@ -0,0 +1,161 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// RateLimit is the limit of a token bucket, see LimitError.
+	RateLimit = "rate"
+	// InFlightLimit is the limit of concurrent calls, see LimitError.
+	InFlightLimit = "in-flight"
+)
+
+// ErrLimitExceeded is matched by every LimitError with errors.Is.
+var ErrLimitExceeded = fmt.Errorf("limiter error: limit exceeded")
+
+type (
+	// Limiter limits calls by a token bucket refilled at a rate, and by a maximum number of calls in flight.
+	// The zero limits disable the bucket or the concurrency cap respectively.
+	Limiter struct {
+		name  string
+		rate  float64
+		burst float64
+
+		mu     sync.Mutex
+		tokens float64
+		last   time.Time
+
+		inFlight chan struct{}
+	}
+
+	// LimitError is returned by Limiter.Acquire if a call cannot be admitted within the waiting time.
+	LimitError struct {
+		Name  string
+		Limit string
+		Wait  time.Duration
+	}
+)
+
+// NewLimiter creates a limiter admitting rps calls per second with bursts of burst calls, and at most maxInFlight calls
+// concurrently. A zero burst with a positive rps is rps rounded up.
+func NewLimiter(name string, rps float64, burst int, maxInFlight int) *Limiter {
+	if rps > 0 && burst <= 0 {
+		burst = int(math.Ceil(rps))
+	}
+
+	l := &Limiter{
+		name:   name,
+		rate:   rps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+	if maxInFlight > 0 {
+		l.inFlight = make(chan struct{}, maxInFlight)
+	}
+	return l
+}
+
+// Acquire admits a call, waiting for at most wait or until ctx is done. Zero wait never waits.
+// The returned function must be called once the call is done, to free its in-flight slot.
+func (l *Limiter) Acquire(ctx context.Context, wait time.Duration) (release func(), err error) {
+	deadline := time.Now().Add(wait)
+
+	// Take a slot of calls in flight
+	if l.inFlight != nil {
+		if err := l.takeSlot(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+	free := func() {
+		if l.inFlight != nil {
+			<-l.inFlight
+		}
+	}
+
+	// Take a token of the bucket
+	if l.rate > 0 {
+		if err := l.takeToken(ctx, wait, time.Until(deadline)); err != nil {
+			free()
+			return nil, err
+		}
+	}
+
+	var once sync.Once
+	return func() { once.Do(free) }, nil
+}
+
+// InFlight counts calls admitted and not released.
+func (l *Limiter) InFlight() int {
+	return len(l.inFlight)
+}
+
+func (l *Limiter) takeSlot(ctx context.Context, wait time.Duration) error {
+	select {
+	case l.inFlight <- struct{}{}:
+		return nil
+	default:
+	}
+	if wait <= 0 {
+		return &LimitError{Name: l.name, Limit: InFlightLimit, Wait: wait}
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case l.inFlight <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return &LimitError{Name: l.name, Limit: InFlightLimit, Wait: wait}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// takeToken reserves a token and waits until it is refilled, if it is refilled within the remaining waiting time.
+func (l *Limiter) takeToken(ctx context.Context, wait time.Duration, remaining time.Duration) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	var delay time.Duration
+	if l.tokens < 1 {
+		delay = time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		if delay > remaining {
+			l.mu.Unlock()
+			return &LimitError{Name: l.name, Limit: RateLimit, Wait: wait}
+		}
+	}
+	l.tokens--
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Give the reserved token back
+		l.mu.Lock()
+		l.tokens = math.Min(l.burst, l.tokens+1)
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v limit of %v exceeded after waiting %v", e.Limit, e.Name, e.Wait)
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
@@ -0,0 +1,65 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	l := NewLimiter("test", 20, 2, 0)
+
+	// the burst is admitted at once, the next call over the limit is rejected without waiting
+	for range 2 {
+		if _, err := l.Acquire(context.Background(), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := l.Acquire(context.Background(), 0)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != RateLimit || !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("call over the rate limit is expected to be rejected, but got %v", err)
+	}
+
+	// a call waiting long enough is admitted once a token is refilled
+	start := time.Now()
+	if _, err := l.Acquire(context.Background(), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < 25*time.Millisecond {
+		t.Fatalf("call is expected to wait for a token to be refilled, but waited %v", waited)
+	}
+}
+
+func TestInFlightLimit(t *testing.T) {
+	l := NewLimiter("test", 0, 0, 1)
+
+	release, err := l.Acquire(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Acquire(context.Background(), 20*time.Millisecond); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("call over the in-flight limit is expected to be rejected, but got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.Acquire(ctx, time.Second); err != context.Canceled {
+		t.Fatalf("waiting call is expected to give up once its context is done, but got %v", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+		release() // released once only
+	}()
+	next, err := l.Acquire(context.Background(), time.Second)
+	if err != nil {
+		t.Fatalf("waiting call is expected to be admitted once a slot is freed, but got %v", err)
+	}
+	next()
+	if l.InFlight() != 0 {
+		t.Fatalf("no call is expected in flight, but got %d", l.InFlight())
+	}
+}
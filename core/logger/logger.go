@@ -1,22 +1,223 @@
 package logger
 
-import "github.com/sirupsen/logrus"
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
 
-var log = logrus.New()
+	"github.com/sirupsen/logrus"
+	"github.com/world-in-progress/yggdrasil/config"
+)
+
+// Standard field keys identifying what a log entry is about.
+const (
+	SceneField     = "scene"
+	NodeField      = "node_id"
+	ComponentField = "component_id"
+	TaskField      = "task_id"
+)
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+const (
+	JSONFormat Format = "json"
+	TextFormat Format = "text"
+)
+
+type (
+	Level int
+
+	// Format of log entries.
+	Format string
+
+	// Fields are structured data attached to log entries.
+	Fields map[string]any
+
+	// ILogger is the interface for a leveled logger attaching fields to its entries.
+	ILogger interface {
+		Debug(format string, args ...any)
+		Info(format string, args ...any)
+		Warn(format string, args ...any)
+		Error(format string, args ...any)
+		WithField(key string, value any) ILogger
+		WithFields(fields Fields) ILogger
+		WithError(err error) ILogger
+	}
+
+	entryLogger struct {
+		entry *logrus.Entry
+	}
+
+	loggerKey struct{}
+	fieldsKey struct{}
+)
+
+var (
+	log = logrus.New()
+	std = &entryLogger{entry: logrus.NewEntry(log)}
+)
+
+func init() {
+	log.SetFormatter(&logrus.JSONFormatter{})
+	log.SetLevel(logrus.InfoLevel)
+}
+
+// ParseLevel parses a level name: debug, info, warn or error.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return DebugLevel, nil
+	case "info", "":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	}
+	return InfoLevel, fmt.Errorf("unknown log level %s", name)
+}
+
+// SetLevel sets the minimum level of entries written by the standard logger.
+func SetLevel(level Level) {
+	switch level {
+	case DebugLevel:
+		log.SetLevel(logrus.DebugLevel)
+	case WarnLevel:
+		log.SetLevel(logrus.WarnLevel)
+	case ErrorLevel:
+		log.SetLevel(logrus.ErrorLevel)
+	default:
+		log.SetLevel(logrus.InfoLevel)
+	}
+}
+
+// SetFormat sets the format of entries written by the standard logger.
+func SetFormat(format Format) error {
+	switch format {
+	case JSONFormat, "":
+		log.SetFormatter(&logrus.JSONFormatter{})
+	case TextFormat:
+		log.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	default:
+		return fmt.Errorf("unknown log format %s", format)
+	}
+	return nil
+}
+
+// SetOutput sets the writer the standard logger writes entries to.
+func SetOutput(w io.Writer) {
+	log.SetOutput(w)
+}
+
+// Configure sets level, format and output of the standard logger.
+// Entries are written to stderr if no file is configured, or to a file rotated by size otherwise.
+func Configure(cfg config.LoggerConfig) error {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	if err := SetFormat(Format(cfg.Format)); err != nil {
+		return err
+	}
+
+	if cfg.File == "" {
+		SetOutput(os.Stderr)
+	} else {
+		file, err := NewRotatingFile(cfg.File, int64(cfg.MaxSizeMB)<<20, cfg.MaxBackups)
+		if err != nil {
+			return fmt.Errorf("failed to open log file %s: %v", cfg.File, err)
+		}
+		SetOutput(file)
+	}
+	SetLevel(level)
+	return nil
+}
+
+// Standard returns the standard logger.
+func Standard() ILogger {
+	return std
+}
+
+// With returns the standard logger attaching fields to its entries.
+func With(fields Fields) ILogger {
+	return std.WithFields(fields)
+}
+
+// NewContext returns a copy of ctx carrying a logger.
+func NewContext(ctx context.Context, l ILogger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or the standard logger if there is none.
+func FromContext(ctx context.Context) ILogger {
+	if ctx != nil {
+		if l, ok := ctx.Value(loggerKey{}).(ILogger); ok {
+			return l
+		}
+	}
+	return std
+}
+
+// ContextWithFields returns a copy of ctx carrying its logger attaching more fields.
+// The fields can be read back by FieldsFromContext.
+func ContextWithFields(ctx context.Context, fields Fields) context.Context {
+	merged := make(Fields, len(fields))
+	for key, value := range FieldsFromContext(ctx) {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	ctx = context.WithValue(ctx, fieldsKey{}, merged)
+	return NewContext(ctx, FromContext(ctx).WithFields(fields))
+}
+
+// FieldsFromContext returns the fields attached to ctx by ContextWithFields.
+func FieldsFromContext(ctx context.Context) Fields {
+	if ctx != nil {
+		if fields, ok := ctx.Value(fieldsKey{}).(Fields); ok {
+			return fields
+		}
+	}
+	return Fields{}
+}
+
+func Debug(format string, args ...any) {
+	std.Debug(format, args...)
+}
 
 func Info(format string, args ...any) {
-	log.Infof(format, args...)
+	std.Info(format, args...)
+}
+
+func Warn(format string, args ...any) {
+	std.Warn(format, args...)
 }
 
 func Error(format string, args ...any) {
-	log.Errorf(format, args...)
+	std.Error(format, args...)
 }
 
-func Fatal(format string, args ...any) {
-	log.Fatalf(format, args...)
+func (l *entryLogger) Debug(format string, args ...any) { l.entry.Debugf(format, args...) }
+func (l *entryLogger) Info(format string, args ...any)  { l.entry.Infof(format, args...) }
+func (l *entryLogger) Warn(format string, args ...any)  { l.entry.Warnf(format, args...) }
+func (l *entryLogger) Error(format string, args ...any) { l.entry.Errorf(format, args...) }
+
+func (l *entryLogger) WithField(key string, value any) ILogger {
+	return &entryLogger{entry: l.entry.WithField(key, value)}
 }
 
-func init() {
-	log.SetFormatter(&logrus.JSONFormatter{})
-	log.SetLevel(logrus.InfoLevel)
+func (l *entryLogger) WithFields(fields Fields) ILogger {
+	return &entryLogger{entry: l.entry.WithFields(logrus.Fields(fields))}
+}
+
+func (l *entryLogger) WithError(err error) ILogger {
+	return &entryLogger{entry: l.entry.WithError(err)}
 }
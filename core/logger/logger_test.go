@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContextLogger(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer SetOutput(os.Stderr)
+	defer SetLevel(InfoLevel)
+
+	ctx := ContextWithFields(context.Background(), Fields{SceneField: "scene", TaskField: "task"})
+	ctx = ContextWithFields(ctx, Fields{NodeField: "node"})
+	FromContext(ctx).WithError(errors.New("boom")).Error("Failed to process %s", "task")
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("entry is expected to be in JSON format: %v", err)
+	}
+	for key, value := range map[string]any{
+		"msg":      "Failed to process task",
+		"level":    "error",
+		"error":    "boom",
+		SceneField: "scene",
+		TaskField:  "task",
+		NodeField:  "node",
+	} {
+		if entry[key] != value {
+			t.Fatalf("entry is expected to have %s of %v, but is %v", key, value, entry)
+		}
+	}
+
+	// entries below level are dropped
+	buf.Reset()
+	SetLevel(WarnLevel)
+	FromContext(ctx).Info("dropped")
+	Warn("kept")
+	if strings.Contains(buf.String(), "dropped") || !strings.Contains(buf.String(), "kept") {
+		t.Fatalf("only entries at least of warn level are expected to be written, but got %s", buf.String())
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	file, err := NewRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, expected := range map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	} {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != expected {
+			t.Fatalf("%s is expected to hold %q, but holds %q", name, expected, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("backups beyond the backup number are expected to be removed")
+	}
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import "sync/atomic"
+
+type (
+	// CacheStats is a snapshot of the statistics of a runtime cache.
+	CacheStats struct {
+		Hits         uint64
+		Misses       uint64
+		Evictions    uint64
+		DirtyFlushes uint64
+		Size         int
+	}
+
+	// CacheCounters counts accesses to a runtime cache.
+	CacheCounters struct {
+		hits         atomic.Uint64
+		misses       atomic.Uint64
+		evictions    atomic.Uint64
+		dirtyFlushes atomic.Uint64
+	}
+)
+
+func (c *CacheCounters) Hit()   { c.hits.Add(1) }
+func (c *CacheCounters) Miss()  { c.misses.Add(1) }
+func (c *CacheCounters) Evict() { c.evictions.Add(1) }
+
+// Flush counts a dirty cached item written back to repository.
+func (c *CacheCounters) Flush() { c.dirtyFlushes.Add(1) }
+
+// Stats snapshots the counters with the current cache size.
+func (c *CacheCounters) Stats(size int) CacheStats {
+	return CacheStats{
+		Hits:         c.hits.Load(),
+		Misses:       c.misses.Load(),
+		Evictions:    c.evictions.Load(),
+		DirtyFlushes: c.dirtyFlushes.Load(),
+		Size:         size,
+	}
+}
+
+// RegisterCache exposes the statistics of a runtime cache in a registry, labeled by the cache name.
+func RegisterCache(r *Registry, cache string, stats func() CacheStats) {
+	r.Counter("yggdrasil_cache_hits_total", "Lookups served by the runtime cache.", "cache").
+		Func(func() float64 { return float64(stats().Hits) }, cache)
+	r.Counter("yggdrasil_cache_misses_total", "Lookups activating items from repository.", "cache").
+		Func(func() float64 { return float64(stats().Misses) }, cache)
+	r.Counter("yggdrasil_cache_evictions_total", "Items evicted from the runtime cache.", "cache").
+		Func(func() float64 { return float64(stats().Evictions) }, cache)
+	r.Counter("yggdrasil_cache_dirty_flushes_total", "Dirty items written back to repository.", "cache").
+		Func(func() float64 { return float64(stats().DirtyFlushes) }, cache)
+	r.Gauge("yggdrasil_cache_size", "Items held by the runtime cache.", "cache").
+		Func(func() float64 { return float64(stats().Size) }, cache)
+}
+
+// UnregisterCache removes the statistics of a runtime cache registered by RegisterCache from a registry.
+func UnregisterCache(r *Registry, cache string) {
+	r.Counter("yggdrasil_cache_hits_total", "Lookups served by the runtime cache.", "cache").Delete(cache)
+	r.Counter("yggdrasil_cache_misses_total", "Lookups activating items from repository.", "cache").Delete(cache)
+	r.Counter("yggdrasil_cache_evictions_total", "Items evicted from the runtime cache.", "cache").Delete(cache)
+	r.Counter("yggdrasil_cache_dirty_flushes_total", "Dirty items written back to repository.", "cache").Delete(cache)
+	r.Gauge("yggdrasil_cache_size", "Items held by the runtime cache.", "cache").Delete(cache)
+}
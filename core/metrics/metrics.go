@@ -0,0 +1,395 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultRegistry is the registry components of a process record their metrics in by default.
+var DefaultRegistry = NewRegistry()
+
+// DefBuckets are the default histogram buckets, in seconds, fitting latencies of network calls.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type (
+	metricType string
+
+	// Registry holds metric families and exposes them in Prometheus text format.
+	Registry struct {
+		mu       sync.RWMutex
+		families map[string]*family
+	}
+
+	// family is a metric and its children of distinct label values.
+	family struct {
+		name       string
+		help       string
+		typ        metricType
+		labelNames []string
+		buckets    []float64
+
+		mu       sync.RWMutex
+		children map[string]*child
+	}
+
+	child struct {
+		labelValues []string
+		value       atomicFloat
+		fn          func() float64
+		hist        *histogram
+	}
+
+	histogram struct {
+		bounds []float64
+		counts []atomic.Uint64 // non-cumulative counts of buckets, with +Inf last
+		sum    atomicFloat
+		count  atomic.Uint64
+	}
+
+	atomicFloat struct {
+		bits atomic.Uint64
+	}
+
+	// Counter is a value only going up.
+	Counter struct{ c *child }
+
+	// Gauge is a value going up and down.
+	Gauge struct{ c *child }
+
+	// Histogram counts observations in buckets.
+	Histogram struct{ c *child }
+
+	CounterVec   struct{ f *family }
+	GaugeVec     struct{ f *family }
+	HistogramVec struct{ f *family }
+)
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+func NewRegistry() *Registry {
+	return &Registry{
+		families: make(map[string]*family),
+	}
+}
+
+// Counter registers a counter family, or returns the one registered with the same name.
+func (r *Registry) Counter(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{r.register(name, help, counterType, labelNames, nil)}
+}
+
+// Gauge registers a gauge family, or returns the one registered with the same name.
+func (r *Registry) Gauge(name, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{r.register(name, help, gaugeType, labelNames, nil)}
+}
+
+// Histogram registers a histogram family with ascending buckets, or returns the one registered with the same name.
+// Nil buckets are DefBuckets.
+func (r *Registry) Histogram(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	return &HistogramVec{r.register(name, help, histogramType, labelNames, buckets)}
+}
+
+// register panics if a family of the same name but another type or labels is registered,
+// which is a programming error.
+func (r *Registry) register(name, help string, typ metricType, labelNames []string, buckets []float64) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.families[name]; ok {
+		if f.typ != typ || strings.Join(f.labelNames, ",") != strings.Join(labelNames, ",") {
+			panic(fmt.Sprintf("metric %s is registered as %s with labels %v", name, f.typ, f.labelNames))
+		}
+		return f
+	}
+
+	f := &family{
+		name:       name,
+		help:       help,
+		typ:        typ,
+		labelNames: labelNames,
+		buckets:    buckets,
+		children:   make(map[string]*child),
+	}
+	r.families[name] = f
+	return f
+}
+
+// child gets or creates the child of label values.
+func (f *family) child(labelValues []string) *child {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	f.mu.RLock()
+	c, ok := f.children[key]
+	f.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if c, ok := f.children[key]; ok {
+		return c
+	}
+	c = &child{labelValues: append([]string(nil), labelValues...)}
+	if f.typ == histogramType {
+		c.hist = &histogram{bounds: f.buckets, counts: make([]atomic.Uint64, len(f.buckets)+1)}
+	}
+	f.children[key] = c
+	return c
+}
+
+// setFunc makes the child of label values report the value of fn at collection.
+func (f *family) setFunc(fn func() float64, labelValues []string) {
+	c := f.child(labelValues)
+	f.mu.Lock()
+	c.fn = fn
+	f.mu.Unlock()
+}
+
+// delete removes the child of label values, and reports whether it existed.
+func (f *family) delete(labelValues []string) bool {
+	key := strings.Join(labelValues, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.children[key]
+	delete(f.children, key)
+	return ok
+}
+
+// deleteMatching removes children having a value of a label, and returns how many are removed.
+func (f *family) deleteMatching(labelName, labelValue string) int {
+	i := slices.Index(f.labelNames, labelName)
+	if i < 0 {
+		return 0
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	deleted := 0
+	for key, c := range f.children {
+		if c.labelValues[i] == labelValue {
+			delete(f.children, key)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// With gets the counter of label values.
+func (v *CounterVec) With(labelValues ...string) *Counter {
+	return &Counter{v.f.child(labelValues)}
+}
+
+// Func makes the counter of label values report the value of fn at collection.
+// fn must return a value only going up.
+func (v *CounterVec) Func(fn func() float64, labelValues ...string) {
+	v.f.setFunc(fn, labelValues)
+}
+
+// Delete removes the counter of label values, and reports whether it existed.
+func (v *CounterVec) Delete(labelValues ...string) bool {
+	return v.f.delete(labelValues)
+}
+
+// DeleteMatching removes counters having a value of a label, and returns how many are removed.
+func (v *CounterVec) DeleteMatching(labelName, labelValue string) int {
+	return v.f.deleteMatching(labelName, labelValue)
+}
+
+// With gets the gauge of label values.
+func (v *GaugeVec) With(labelValues ...string) *Gauge {
+	return &Gauge{v.f.child(labelValues)}
+}
+
+// Func makes the gauge of label values report the value of fn at collection.
+func (v *GaugeVec) Func(fn func() float64, labelValues ...string) {
+	v.f.setFunc(fn, labelValues)
+}
+
+// Delete removes the gauge of label values, and reports whether it existed.
+func (v *GaugeVec) Delete(labelValues ...string) bool {
+	return v.f.delete(labelValues)
+}
+
+// DeleteMatching removes gauges having a value of a label, and returns how many are removed.
+func (v *GaugeVec) DeleteMatching(labelName, labelValue string) int {
+	return v.f.deleteMatching(labelName, labelValue)
+}
+
+// With gets the histogram of label values.
+func (v *HistogramVec) With(labelValues ...string) *Histogram {
+	return &Histogram{v.f.child(labelValues)}
+}
+
+// Delete removes the histogram of label values, and reports whether it existed.
+func (v *HistogramVec) Delete(labelValues ...string) bool {
+	return v.f.delete(labelValues)
+}
+
+// DeleteMatching removes histograms having a value of a label, and returns how many are removed.
+func (v *HistogramVec) DeleteMatching(labelName, labelValue string) int {
+	return v.f.deleteMatching(labelName, labelValue)
+}
+
+func (c *Counter) Inc() { c.c.value.add(1) }
+
+// Add adds a non-negative value to the counter.
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("counter cannot decrease")
+	}
+	c.c.value.add(delta)
+}
+
+func (g *Gauge) Set(value float64) { g.c.value.set(value) }
+func (g *Gauge) Add(delta float64) { g.c.value.add(delta) }
+func (g *Gauge) Inc()              { g.c.value.add(1) }
+func (g *Gauge) Dec()              { g.c.value.add(-1) }
+
+// Observe counts a value in the first bucket whose upper bound is not less than it.
+func (h *Histogram) Observe(value float64) {
+	hist := h.c.hist
+	hist.counts[sort.SearchFloat64s(hist.bounds, value)].Add(1)
+	hist.sum.add(value)
+	hist.count.Add(1)
+}
+
+func (a *atomicFloat) load() float64 {
+	return math.Float64frombits(a.bits.Load())
+}
+
+func (a *atomicFloat) set(value float64) {
+	a.bits.Store(math.Float64bits(value))
+}
+
+func (a *atomicFloat) add(delta float64) {
+	for {
+		old := a.bits.Load()
+		if a.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// Handler returns an http handler exposing metrics of the registry in Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := r.WriteText(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// WriteText writes metrics of the registry in Prometheus text format, sorted by name and label values.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.RLock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.RUnlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.mu.RLock()
+	children := make([]*child, 0, len(f.children))
+	for _, c := range f.children {
+		children = append(children, c)
+	}
+	f.mu.RUnlock()
+	if len(children) == 0 {
+		return
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return strings.Join(children[i].labelValues, "\xff") < strings.Join(children[j].labelValues, "\xff")
+	})
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escape(f.help, false))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+	for _, c := range children {
+		labels := f.labels(c.labelValues, "")
+		if c.hist == nil {
+			value := c.value.load()
+			f.mu.RLock()
+			fn := c.fn
+			f.mu.RUnlock()
+			if fn != nil {
+				value = fn()
+			}
+			fmt.Fprintf(w, "%s%s %s\n", f.name, labels, formatFloat(value))
+			continue
+		}
+
+		var cumulative uint64
+		for i, bound := range f.buckets {
+			cumulative += c.hist.counts[i].Load()
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labels(c.labelValues, formatFloat(bound)), cumulative)
+		}
+		cumulative += c.hist.counts[len(f.buckets)].Load()
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labels(c.labelValues, "+Inf"), cumulative)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, labels, formatFloat(c.hist.sum.load()))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, labels, c.hist.count.Load())
+	}
+}
+
+// labels formats label pairs of a child, with the le label of a histogram bucket if provided.
+func (f *family) labels(labelValues []string, le string) string {
+	pairs := make([]string, 0, len(labelValues)+1)
+	for i, name := range f.labelNames {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escape(labelValues[i], true)))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf(`le="%s"`, le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escape(s string, quoted bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quoted {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
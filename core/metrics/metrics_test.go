@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+
+	calls := r.Counter("test_calls_total", "Calls.", "name")
+	calls.With("a").Inc()
+	calls.With("a").Add(2)
+	calls.With(`quoted "b"`).Inc()
+	if r.Counter("test_calls_total", "Calls.", "name") == nil {
+		t.Fatal("registering a family twice is expected to return it")
+	}
+
+	size := 3
+	r.Gauge("test_size", "Size.").Func(func() float64 { return float64(size) })
+	size = 5
+
+	latency := r.Histogram("test_latency_seconds", "Latency.", []float64{0.1, 1}, "name")
+	latency.With("a").Observe(0.05)
+	latency.With("a").Observe(0.5)
+	latency.With("a").Observe(2)
+
+	r.Gauge("test_unused", "No child, not written.")
+
+	var sb strings.Builder
+	if err := r.WriteText(&sb); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP test_calls_total Calls.
+# TYPE test_calls_total counter
+test_calls_total{name="a"} 3
+test_calls_total{name="quoted \"b\""} 1
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{name="a",le="0.1"} 1
+test_latency_seconds_bucket{name="a",le="1"} 2
+test_latency_seconds_bucket{name="a",le="+Inf"} 3
+test_latency_seconds_sum{name="a"} 2.55
+test_latency_seconds_count{name="a"} 3
+# HELP test_size Size.
+# TYPE test_size gauge
+test_size 5
+`
+	if sb.String() != expected {
+		t.Fatalf("text is expected to be\n%s\nbut is\n%s", expected, sb.String())
+	}
+}
+
+func TestRegisterMismatch(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("test_total", "Test.", "name")
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering a family of the same name but another type is expected to panic")
+		}
+	}()
+	r.Gauge("test_total", "Test.", "name")
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	var counters CacheCounters
+	counters.Hit()
+	counters.Miss()
+	counters.Evict()
+	RegisterCache(r, "tree", func() CacheStats { return counters.Stats(7) })
+
+	recorder := httptest.NewRecorder()
+	r.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Fatalf("content type is expected to be Prometheus text format, but is %s", contentType)
+	}
+	body := recorder.Body.String()
+	for _, line := range []string{
+		`yggdrasil_cache_hits_total{cache="tree"} 1`,
+		`yggdrasil_cache_misses_total{cache="tree"} 1`,
+		`yggdrasil_cache_evictions_total{cache="tree"} 1`,
+		`yggdrasil_cache_dirty_flushes_total{cache="tree"} 0`,
+		`yggdrasil_cache_size{cache="tree"} 7`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Fatalf("metrics are expected to contain %s, but are\n%s", line, body)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	r := NewRegistry()
+	calls := r.Counter("test_calls_total", "Calls.", "scene", "name")
+	calls.With("a", "x").Inc()
+	calls.With("a", "y").Inc()
+	calls.With("b", "x").Inc()
+	RegisterCache(r, "tree", func() CacheStats { return CacheStats{Size: 1} })
+
+	if deleted := calls.DeleteMatching("scene", "a"); deleted != 2 {
+		t.Fatalf("2 counters are expected to be deleted, but got %v", deleted)
+	}
+	if calls.Delete("a", "x") || !calls.Delete("b", "x") {
+		t.Fatal("only existing counters are expected to be reported deleted")
+	}
+	UnregisterCache(r, "tree")
+
+	var sb strings.Builder
+	if err := r.WriteText(&sb); err != nil {
+		t.Fatal(err)
+	}
+	if sb.String() != "" {
+		t.Fatalf("no metric is expected to be left, but got\n%s", sb.String())
+	}
+}
@@ -1,16 +1,30 @@
 package queue
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/world-in-progress/yggdrasil/core/logger"
 	"github.com/world-in-progress/yggdrasil/core/rescue"
 	"github.com/world-in-progress/yggdrasil/core/threading"
 )
 
+const (
+	// Block blocks producers until the queue has room.
+	Block Backpressure = iota
+	// DropOldest drops the oldest queued item to make room for a new one.
+	DropOldest
+	// DropNewest drops a new item if the queue is full.
+	DropNewest
+
+	// eventBufferSize is the number of events buffered for each consumer, beyond which broadcast events are dropped.
+	eventBufferSize = 16
+)
+
 type (
 	// Listener interface represents a listener that can be notified with queue events.
 	Listener interface {
@@ -18,6 +32,28 @@ type (
 		OnResume()
 	}
 
+	// Backpressure is the strategy of a queue for items produced while it is full.
+	// Dropping strategies require a positive capacity, DropOldest behaves as DropNewest without one.
+	Backpressure int
+
+	// ErrorHandler handles an item whose consumption kept failing after all retries.
+	ErrorHandler[T any] func(item T, err error)
+
+	// Stats is a snapshot of the statistics of a queue.
+	Stats struct {
+		Produced      uint64
+		Consumed      uint64
+		Failed        uint64 // items failing all retries
+		Retried       uint64 // retries of failed consumptions
+		Dropped       uint64 // items dropped by backpressure
+		DroppedEvents uint64 // broadcast events dropped for consumers lagging behind
+		Length        int    // items queued
+		Capacity      int
+		Consumers     int
+		Throughput    float64       // items consumed per second since start
+		Lag           time.Duration // time the item most recently taken by a consumer waited in the queue
+	}
+
 	// Queue is the structure for task queue.
 	Queue[T any] struct {
 		name                 string
@@ -28,11 +64,39 @@ type (
 		producerCount        int
 		consumerCount        int
 		active               int32
-		channel              chan T
+		channel              chan entry[T]
 		quit                 chan struct{}
 		listeners            []Listener
-		eventLock            sync.Mutex
-		eventChannels        []chan any
+		backpressure         Backpressure
+		maxRetries           int
+		retryBackoff         time.Duration
+		errorHandler         ErrorHandler[T]
+
+		consumerLock sync.Mutex
+		consumers    []*consumerSlot
+		started      bool
+		closed       bool
+		startTime    time.Time
+
+		produced      atomic.Uint64
+		consumed      atomic.Uint64
+		failed        atomic.Uint64
+		retried       atomic.Uint64
+		dropped       atomic.Uint64
+		droppedEvents atomic.Uint64
+		lag           atomic.Int64
+	}
+
+	// entry is a queued item with the time it is queued.
+	entry[T any] struct {
+		item     T
+		enqueued time.Time
+	}
+
+	// consumerSlot is the event channel of a running consumer and the channel stopping it.
+	consumerSlot struct {
+		events chan any
+		stop   chan struct{}
 	}
 
 	routineListener[T any] struct {
@@ -42,7 +106,6 @@ type (
 
 // NewQueue returns a new queue.
 func NewQueue[T any](name string, producerFactory ProducerFactory[T], consumerFactory ConsumeFactory[T]) *Queue[T] {
-
 	q := &Queue[T]{
 		producerFactory:      producerFactory,
 		producerRoutineGroup: threading.NewRoutineGroup(),
@@ -50,10 +113,12 @@ func NewQueue[T any](name string, producerFactory ProducerFactory[T], consumerFa
 		consumerRoutineGroup: threading.NewRoutineGroup(),
 		producerCount:        runtime.NumCPU(),
 		consumerCount:        runtime.NumCPU() << 1,
-		channel:              make(chan T),
+		channel:              make(chan entry[T]),
 		quit:                 make(chan struct{}),
 	}
-
+	q.errorHandler = func(item T, err error) {
+		q.logger().WithError(err).Error("Error occurred while consuming")
+	}
 	q.SetName(name)
 	return q
 }
@@ -69,8 +134,53 @@ func (q *Queue[T]) SetNumProducer(count int) {
 }
 
 // SetNumConsumer sets the numer of consumers.
-func (q *Queue[T]) SetNumConsumer(count int) {
+// Consumers are started or stopped to match the number if the queue is running.
+// A stopped consumer finishes the item it is consuming first. A running queue keeps at least one consumer,
+// as producers would otherwise be left blocked on a full queue.
+func (q *Queue[T]) SetNumConsumer(count int) error {
+	q.consumerLock.Lock()
+	defer q.consumerLock.Unlock()
+
+	running := q.started && !q.closed
+	if running && count < 1 {
+		return fmt.Errorf("queue %s is running and needs at least one consumer, got %d", q.name, count)
+	}
+	count = max(count, 0)
 	q.consumerCount = count
+	if !running {
+		return nil
+	}
+	if diff := count - len(q.consumers); diff > 0 {
+		q.startConsumersLocked(diff)
+	} else {
+		for _, slot := range q.consumers[count:] {
+			close(slot.stop)
+		}
+		q.consumers = q.consumers[:count]
+	}
+	return nil
+}
+
+// SetCapacity sets the number of items queued before backpressure applies. It must be set before Start.
+func (q *Queue[T]) SetCapacity(capacity int) {
+	q.channel = make(chan entry[T], capacity)
+}
+
+// SetBackpressure sets the strategy for items produced while the queue is full. Block by default.
+func (q *Queue[T]) SetBackpressure(backpressure Backpressure) {
+	q.backpressure = backpressure
+}
+
+// SetRetry retries consuming a failed item up to maxRetries times, waiting backoff doubled for every retry.
+// No retry is made by default.
+func (q *Queue[T]) SetRetry(maxRetries int, backoff time.Duration) {
+	q.maxRetries = maxRetries
+	q.retryBackoff = backoff
+}
+
+// SetErrorHandler sets the handler of items failing all retries. Failures are logged by default.
+func (q *Queue[T]) SetErrorHandler(handler ErrorHandler[T]) {
+	q.errorHandler = handler
 }
 
 // AddListener adds a listener to the queue.
@@ -78,25 +188,62 @@ func (q *Queue[T]) AddListener(listener Listener) {
 	q.listeners = append(q.listeners, listener)
 }
 
-// Broadcast broadcasts the message to all event channels.
+// Broadcast broadcasts the message to all consumers without blocking.
+// The message is dropped for consumers having eventBufferSize events pending.
 func (q *Queue[T]) Broadcast(message any) {
-	go func() {
-		defer q.eventLock.Unlock()
+	q.consumerLock.Lock()
+	defer q.consumerLock.Unlock()
 
-		q.eventLock.Lock()
-		for _, channel := range q.eventChannels {
-			channel <- message
+	for _, slot := range q.consumers {
+		select {
+		case slot.events <- message:
+		default:
+			q.droppedEvents.Add(1)
 		}
-	}()
+	}
+}
+
+// Stats snapshots the statistics of the queue.
+func (q *Queue[T]) Stats() Stats {
+	q.consumerLock.Lock()
+	consumers, startTime := len(q.consumers), q.startTime
+	q.consumerLock.Unlock()
+
+	stats := Stats{
+		Produced:      q.produced.Load(),
+		Consumed:      q.consumed.Load(),
+		Failed:        q.failed.Load(),
+		Retried:       q.retried.Load(),
+		Dropped:       q.dropped.Load(),
+		DroppedEvents: q.droppedEvents.Load(),
+		Length:        len(q.channel),
+		Capacity:      cap(q.channel),
+		Consumers:     consumers,
+		Lag:           time.Duration(q.lag.Load()),
+	}
+	if !startTime.IsZero() {
+		if elapsed := time.Since(startTime).Seconds(); elapsed > 0 {
+			stats.Throughput = float64(stats.Consumed) / elapsed
+		}
+	}
+	return stats
 }
 
 // Start starts the task queue.
 func (q *Queue[T]) Start() {
-	q.startProducers(q.producerCount)
-	q.startConsumers(q.consumerCount)
+	q.consumerLock.Lock()
+	q.started = true
+	q.startTime = time.Now()
+	q.startConsumersLocked(q.consumerCount)
+	q.consumerLock.Unlock()
 
+	q.startProducers(q.producerCount)
 	q.producerRoutineGroup.Wait()
+
+	q.consumerLock.Lock()
+	q.closed = true
 	close(q.channel)
+	q.consumerLock.Unlock()
 	q.consumerRoutineGroup.Wait()
 }
 
@@ -105,6 +252,10 @@ func (q *Queue[T]) Stop() {
 	close(q.quit)
 }
 
+func (q *Queue[T]) logger() logger.ILogger {
+	return logger.With(logger.Fields{"queue": q.name})
+}
+
 func (q *Queue[T]) produceOne(producer Producer[T]) (T, bool) {
 	defer rescue.Recover()
 
@@ -113,11 +264,10 @@ func (q *Queue[T]) produceOne(producer Producer[T]) (T, bool) {
 
 func (q *Queue[T]) produce() {
 	var producer Producer[T]
-
 	for {
 		var err error
 		if producer, err = q.producerFactory(); err != nil {
-			fmt.Println("Error occurred while creating producer: ", err)
+			q.logger().WithError(err).Error("Error occurred while creating producer")
 			return
 		} else {
 			break
@@ -132,16 +282,49 @@ func (q *Queue[T]) produce() {
 	for {
 		select {
 		case <-q.quit:
-			fmt.Println("Quitting producer")
+			q.logger().Debug("Quitting producer")
 			return
 		default:
 			if v, ok := q.produceOne(producer); ok {
-				q.channel <- v
+				q.put(v)
 			}
 		}
 	}
 }
 
+// put queues an item, applying the backpressure strategy if the queue is full.
+func (q *Queue[T]) put(item T) {
+	e := entry[T]{item: item, enqueued: time.Now()}
+
+	switch {
+	case q.backpressure == DropNewest || (q.backpressure == DropOldest && cap(q.channel) == 0):
+		select {
+		case q.channel <- e:
+		default:
+			q.dropped.Add(1)
+			return
+		}
+
+	case q.backpressure == DropOldest:
+		for queued := false; !queued; {
+			select {
+			case q.channel <- e:
+				queued = true
+			default:
+				select {
+				case <-q.channel:
+					q.dropped.Add(1)
+				default:
+				}
+			}
+		}
+
+	default:
+		q.channel <- e
+	}
+	q.produced.Add(1)
+}
+
 func (q *Queue[T]) startProducers(number int) {
 	for range number {
 		q.producerRoutineGroup.Run(func() {
@@ -150,21 +333,48 @@ func (q *Queue[T]) startProducers(number int) {
 	}
 }
 
-func (q *Queue[T]) consumeOne(consumer Consumer[T], task T) {
-	threading.RunSafe(func() {
-		if err := consumer.Consume(task); err != nil {
-			log.Fatal("Error occurred while consuming: ", err)
+// consumeOne consumes an item, retrying on failure, and passes it to the error handler if all retries fail
+// or the queue is stopped before it is retried.
+func (q *Queue[T]) consumeOne(consumer Consumer[T], e entry[T]) {
+	q.lag.Store(int64(time.Since(e.enqueued)))
+
+	backoff := q.retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := q.tryConsume(consumer, e.item)
+		if err == nil {
+			q.consumed.Add(1)
+			return
+		}
+
+		if attempt < q.maxRetries {
+			select {
+			case <-time.After(backoff):
+				q.retried.Add(1)
+				backoff *= 2
+				continue
+			case <-q.quit:
+			}
 		}
-	})
+		q.failed.Add(1)
+		threading.RunSafe(func() { q.errorHandler(e.item, err) })
+		return
+	}
 }
 
-func (q *Queue[T]) consume(eventChan chan any) {
-	var consumer Consumer[T]
+// tryConsume consumes an item, converting a panic of the consumer to an error.
+func (q *Queue[T]) tryConsume(consumer Consumer[T], item T) (err error) {
+	defer rescue.RecoverToError(logger.ContextWithFields(context.Background(), logger.Fields{"queue": q.name}), &err)
+
+	return consumer.Consume(item)
+}
 
+func (q *Queue[T]) consume(slot *consumerSlot) {
+	var consumer Consumer[T]
 	for {
 		var err error
 		if consumer, err = q.consumerFactory(); err != nil {
-			fmt.Println("Error occurred while creating consumer: ", err)
+			q.logger().WithError(err).Error("Error occurred while creating consumer")
+			q.removeConsumer(slot)
 			return
 		} else {
 			break
@@ -177,27 +387,45 @@ func (q *Queue[T]) consume(eventChan chan any) {
 			if ok {
 				q.consumeOne(consumer, message)
 			} else {
-				fmt.Println("Task channel was closed, quitting consumer...")
+				q.logger().Debug("Task channel was closed, quitting consumer...")
 				return
 			}
-		case event := <-eventChan:
+		case event := <-slot.events:
 			consumer.OnEvent(event)
+		case <-slot.stop:
+			q.logger().Debug("Consumer is stopped")
+			return
 		}
 	}
 }
 
-func (q *Queue[T]) startConsumers(number int) {
+// startConsumersLocked starts consumers, with consumerLock held.
+func (q *Queue[T]) startConsumersLocked(number int) {
 	for range number {
-		eventChan := make(chan any)
-		q.eventLock.Lock()
-		q.eventChannels = append(q.eventChannels, eventChan)
-		q.eventLock.Unlock()
+		slot := &consumerSlot{
+			events: make(chan any, eventBufferSize),
+			stop:   make(chan struct{}),
+		}
+		q.consumers = append(q.consumers, slot)
 		q.consumerRoutineGroup.RunSafe(func() {
-			q.consume(eventChan)
+			q.consume(slot)
 		})
 	}
 }
 
+// removeConsumer removes the slot of a consumer failing to be created.
+func (q *Queue[T]) removeConsumer(slot *consumerSlot) {
+	q.consumerLock.Lock()
+	defer q.consumerLock.Unlock()
+
+	for i, s := range q.consumers {
+		if s == slot {
+			q.consumers = append(q.consumers[:i:i], q.consumers[i+1:]...)
+			return
+		}
+	}
+}
+
 func (q *Queue[T]) pause() {
 	for _, listener := range q.listeners {
 		listener.OnPause()
@@ -1,6 +1,7 @@
 package queue
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -42,6 +43,31 @@ func TestQueue(t *testing.T) {
 	assert.Equal(t, int32(rounds), atomic.LoadInt32(&consumer.count))
 }
 
+func TestQueueConsumeError(t *testing.T) {
+	producer := newMockedProducer(rounds)
+	consumer := newMockedConsumer()
+	consumer.consumeErr = errors.New("consume error")
+	q := NewQueue(
+		"test",
+		func() (Producer[string], error) {
+			return producer, nil
+		},
+		func() (Consumer[string], error) {
+			return consumer, nil
+		},
+	)
+	q.SetNumConsumer(consumers)
+	q.SetNumProducer(1)
+	go func() {
+		producer.wait.Wait()
+		q.Stop()
+	}()
+	q.Start()
+
+	// consumer errors are logged and consuming goes on
+	assert.Equal(t, int32(rounds), atomic.LoadInt32(&consumer.count))
+}
+
 type (
 	mockedProducer struct {
 		total    int32
@@ -105,3 +131,172 @@ func (l *mockedListener) OnPause() {
 func (l *mockedListener) OnResume() {
 	fmt.Println("Resumed")
 }
+
+// funcConsumer consumes items by a function.
+type funcConsumer struct {
+	consume func(string) error
+	onEvent func(any)
+}
+
+func (c *funcConsumer) Consume(item string) error { return c.consume(item) }
+func (c *funcConsumer) OnEvent(event any) {
+	if c.onEvent != nil {
+		c.onEvent(event)
+	}
+}
+
+// newFuncQueue creates a queue of a producer and consumers created from functions.
+func newFuncQueue(producer Producer[string], consumer func() *funcConsumer) *Queue[string] {
+	return NewQueue(
+		"test",
+		func() (Producer[string], error) {
+			return producer, nil
+		},
+		func() (Consumer[string], error) {
+			return consumer(), nil
+		},
+	)
+}
+
+func TestQueueBackpressure(t *testing.T) {
+	q := newFuncQueue(nil, nil)
+	q.SetCapacity(2)
+
+	q.SetBackpressure(DropOldest)
+	for _, item := range []string{"a", "b", "c"} {
+		q.put(item)
+	}
+	assert.Equal(t, "b", (<-q.channel).item)
+	assert.Equal(t, "c", (<-q.channel).item)
+
+	q.SetBackpressure(DropNewest)
+	for _, item := range []string{"a", "b", "c"} {
+		q.put(item)
+	}
+	assert.Equal(t, "a", (<-q.channel).item)
+	assert.Equal(t, "b", (<-q.channel).item)
+
+	stats := q.Stats()
+	assert.Equal(t, uint64(2), stats.Dropped)
+	assert.Equal(t, uint64(5), stats.Produced) // items dropped as oldest were queued once
+	assert.Equal(t, 2, stats.Capacity)
+}
+
+func TestQueueRetry(t *testing.T) {
+	producer := newMockedProducer(rounds)
+	var attempts sync.Map
+	var failed []string
+	var failedLock sync.Mutex
+	q := newFuncQueue(producer, func() *funcConsumer {
+		return &funcConsumer{consume: func(item string) error {
+			n, _ := attempts.LoadOrStore(item, new(atomic.Int32))
+			if n.(*atomic.Int32).Add(1) < 3 {
+				return errors.New("transient error")
+			}
+			return nil
+		}}
+	})
+	q.SetNumProducer(1)
+	q.SetNumConsumer(1)
+	q.SetRetry(1, time.Millisecond)
+	q.SetErrorHandler(func(item string, err error) {
+		failedLock.Lock()
+		failed = append(failed, item)
+		failedLock.Unlock()
+	})
+
+	go func() {
+		producer.wait.Wait()
+		q.Stop()
+	}()
+	q.Start()
+
+	// the same item is produced every round, and fails twice before succeeding,
+	// so that the first round fails its retry and the others succeed at once
+	stats := q.Stats()
+	assert.Equal(t, []string{"item"}, failed)
+	assert.Equal(t, uint64(1), stats.Failed)
+	assert.Equal(t, uint64(rounds-1), stats.Consumed)
+	assert.Equal(t, uint64(1), stats.Retried)
+}
+
+func TestQueueStopDuringRetry(t *testing.T) {
+	producer := newMockedProducer(1)
+	consumed := make(chan struct{}, rounds)
+	q := newFuncQueue(producer, func() *funcConsumer {
+		return &funcConsumer{consume: func(string) error {
+			consumed <- struct{}{}
+			return errors.New("transient error")
+		}}
+	})
+	q.SetNumProducer(1)
+	q.SetNumConsumer(1)
+	q.SetRetry(5, time.Hour)
+	var failed atomic.Int32
+	q.SetErrorHandler(func(string, error) { failed.Add(1) })
+
+	go func() {
+		<-consumed
+		q.Stop()
+	}()
+	start := time.Now()
+	q.Start()
+
+	// the item waiting for a retry is failed once the queue is stopped, rather than retried at once
+	stats := q.Stats()
+	assert.Less(t, time.Since(start), time.Minute)
+	assert.Empty(t, consumed)
+	assert.Equal(t, int32(1), failed.Load())
+	assert.Equal(t, uint64(1), stats.Failed)
+	assert.Equal(t, uint64(0), stats.Retried)
+}
+
+func TestQueueResize(t *testing.T) {
+	producer := newMockedProducer(rounds)
+	gate := make(chan struct{})
+	var events atomic.Int32
+	q := newFuncQueue(producer, func() *funcConsumer {
+		return &funcConsumer{
+			consume: func(string) error {
+				<-gate
+				return nil
+			},
+			onEvent: func(any) { events.Add(1) },
+		}
+	})
+	q.SetNumProducer(1)
+	q.SetNumConsumer(1)
+	q.SetCapacity(rounds)
+
+	done := make(chan struct{})
+	go func() {
+		q.Start()
+		close(done)
+	}()
+
+	// broadcasting to consumers busy consuming never blocks
+	time.Sleep(10 * time.Millisecond)
+	for range eventBufferSize + 10 {
+		q.Broadcast("event")
+	}
+	assert.Equal(t, uint64(10), q.Stats().DroppedEvents)
+
+	q.SetNumConsumer(4)
+	assert.Equal(t, 4, q.Stats().Consumers)
+	q.SetNumConsumer(2)
+	assert.Equal(t, 2, q.Stats().Consumers)
+
+	// a running queue keeps at least one consumer
+	assert.Error(t, q.SetNumConsumer(0))
+	assert.Equal(t, 2, q.Stats().Consumers)
+
+	close(gate)
+	producer.wait.Wait()
+	q.Stop()
+	<-done
+
+	stats := q.Stats()
+	assert.Equal(t, uint64(rounds), stats.Consumed)
+	assert.Greater(t, stats.Throughput, 0.0)
+	assert.Equal(t, int32(eventBufferSize), events.Load())
+}
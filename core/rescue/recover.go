@@ -3,24 +3,127 @@ package rescue
 import (
 	"context"
 	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/world-in-progress/yggdrasil/core/logger"
+	"github.com/world-in-progress/yggdrasil/core/metrics"
+)
+
+type (
+	// PanicInfo describes a recovered panic.
+	PanicInfo struct {
+		Value  any
+		Stack  []byte
+		Fields logger.Fields // context values such as task ID and node ID, see logger.ContextWithFields
+		Time   time.Time
+	}
+
+	// PanicHandler is called with every recovered panic.
+	PanicHandler func(ctx context.Context, info *PanicInfo)
+
+	// PanicError is the error a panic is converted to by RecoverToError.
+	PanicError struct {
+		Info *PanicInfo
+	}
+
+	handlerEntry struct {
+		handler PanicHandler
+	}
 )
 
-// TODO: Log the error to a log file
+var (
+	handlersMu sync.RWMutex
+	handlers   = []*handlerEntry{{handler: LogHandler}}
+)
+
+// AddHandler registers a handler called with every recovered panic, and returns a function removing it.
+// LogHandler is registered by default.
+func AddHandler(handler PanicHandler) (remove func()) {
+	entry := &handlerEntry{handler: handler}
+
+	handlersMu.Lock()
+	handlers = append(handlers, entry)
+	handlersMu.Unlock()
+
+	return func() {
+		handlersMu.Lock()
+		defer handlersMu.Unlock()
+		for i, e := range handlers {
+			if e == entry {
+				handlers = append(handlers[:i:i], handlers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// LogHandler logs a panic with its stack trace through the logger carried by ctx.
+func LogHandler(ctx context.Context, info *PanicInfo) {
+	logger.FromContext(ctx).WithField("stack", string(info.Stack)).Error("Recovered from panic: %v", info.Value)
+}
+
+// CounterHandler returns a handler counting panics in a registry.
+func CounterHandler(r *metrics.Registry) PanicHandler {
+	counter := r.Counter("yggdrasil_panics_total", "Panics recovered.").With()
+	return func(context.Context, *PanicInfo) {
+		counter.Inc()
+	}
+}
+
+// Recover recovers from a panic, runs cleanups and passes the panic to handlers.
 func Recover(cleanups ...func()) {
 	if r := recover(); r != nil {
-		for _, cleanup := range cleanups {
-			cleanup()
-		}
-		fmt.Println("Recovered from panic:", r)
+		handle(context.Background(), r, cleanups)
 	}
 }
 
-// TODO: Log the error to a log file with context info
+// RecoverCtx recovers from a panic, runs cleanups and passes the panic to handlers with ctx.
 func RecoverCtx(ctx context.Context, cleanups ...func()) {
 	if r := recover(); r != nil {
-		for _, cleanup := range cleanups {
-			cleanup()
+		handle(ctx, r, cleanups)
+	}
+}
+
+// RecoverToError recovers from a panic like RecoverCtx, and sets errp to a PanicError for the caller.
+// It must be deferred directly, for example: defer rescue.RecoverToError(ctx, &err)
+func RecoverToError(ctx context.Context, errp *error, cleanups ...func()) {
+	if r := recover(); r != nil {
+		info := handle(ctx, r, cleanups)
+		if errp != nil {
+			*errp = &PanicError{Info: info}
 		}
-		fmt.Println("Recovered from panic:", r)
 	}
 }
+
+func handle(ctx context.Context, value any, cleanups []func()) *PanicInfo {
+	info := &PanicInfo{
+		Value:  value,
+		Stack:  debug.Stack(),
+		Fields: logger.FieldsFromContext(ctx),
+		Time:   time.Now(),
+	}
+
+	for _, cleanup := range cleanups {
+		cleanup()
+	}
+
+	handlersMu.RLock()
+	entries := handlers
+	handlersMu.RUnlock()
+	for _, entry := range entries {
+		entry.handler(ctx, info)
+	}
+	return info
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Info.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Info.Value.(error)
+	return err
+}
@@ -1,7 +1,12 @@
 package rescue
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
+
+	"github.com/world-in-progress/yggdrasil/core/logger"
 )
 
 func division(a float64, b float64) float64 {
@@ -17,3 +22,53 @@ func division(a float64, b float64) float64 {
 func TestRecover(t *testing.T) {
 	division(1, 0)
 }
+
+func TestPanicHandlers(t *testing.T) {
+	var received *PanicInfo
+	remove := AddHandler(func(ctx context.Context, info *PanicInfo) {
+		received = info
+	})
+
+	ctx := logger.ContextWithFields(context.Background(), logger.Fields{logger.TaskField: "task", logger.NodeField: "node"})
+	func() {
+		defer RecoverCtx(ctx)
+		panic("boom")
+	}()
+	if received == nil {
+		t.Fatal("handler is expected to receive the panic")
+	}
+	if received.Value != "boom" || received.Fields[logger.TaskField] != "task" || received.Fields[logger.NodeField] != "node" {
+		t.Fatalf("panic info is unexpected: %+v", received)
+	}
+	if !strings.Contains(string(received.Stack), "TestPanicHandlers") {
+		t.Fatalf("stack trace is expected to contain the panicking function, but is %s", received.Stack)
+	}
+
+	remove()
+	received = nil
+	division(1, 0)
+	if received != nil {
+		t.Fatal("removed handler is expected not to be called")
+	}
+}
+
+func TestRecoverToError(t *testing.T) {
+	cause := errors.New("cause")
+	cleaned := false
+	run := func() (err error) {
+		defer RecoverToError(context.Background(), &err, func() { cleaned = true })
+		panic(cause)
+	}
+
+	err := run()
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("panic is expected to be converted to a PanicError, but got %v", err)
+	}
+	if !errors.Is(err, cause) {
+		t.Fatalf("panic error is expected to wrap the panic value, but got %v", err)
+	}
+	if !cleaned {
+		t.Fatal("cleanup is expected to run")
+	}
+}
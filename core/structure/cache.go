@@ -0,0 +1,317 @@
+package structure
+
+import (
+	"container/heap"
+	"container/list"
+	"sync"
+	"time"
+)
+
+type (
+	// ICachePolicy is the interface for the order keys of a Cache are evicted in.
+	// Methods are called with the cache locked, and only with keys of entries not pinned.
+	ICachePolicy[K comparable] interface {
+		Add(key K)
+		Touch(key K)
+		Remove(key K)
+		// Victim returns the key to evict first, and whether it has expired,
+		// in which case it is evicted even if the cache is not full.
+		Victim(now time.Time) (key K, expired bool, ok bool)
+	}
+
+	// Cache is a thread-safe map evicting entries in the order of its policy once it is shrunk.
+	// Pinned entries are never evicted.
+	Cache[K comparable, V any] struct {
+		mu      sync.Mutex
+		entries map[K]*cacheEntry[V]
+		policy  ICachePolicy[K]
+	}
+
+	// CacheEntry is an entry evicted from a Cache.
+	CacheEntry[K comparable, V any] struct {
+		Key   K
+		Value V
+	}
+
+	cacheEntry[V any] struct {
+		value  V
+		pinned bool
+	}
+
+	// lruPolicy evicts the least recently used key first.
+	lruPolicy[K comparable] struct {
+		order    *list.List // of lruItem, from the least recently used
+		elements map[K]*list.Element
+		ttl      time.Duration
+	}
+
+	lruItem[K comparable] struct {
+		key    K
+		access time.Time
+	}
+
+	// lfuPolicy evicts the least frequently used key first, and the least recently used one among them.
+	lfuPolicy[K comparable] struct {
+		heap  lfuHeap[K]
+		items map[K]*lfuItem[K]
+		tick  uint64
+	}
+
+	lfuItem[K comparable] struct {
+		key   K
+		count uint64
+		tick  uint64
+		index int
+	}
+
+	lfuHeap[K comparable] []*lfuItem[K]
+)
+
+func NewCache[K comparable, V any](policy ICachePolicy[K]) *Cache[K, V] {
+	return &Cache[K, V]{
+		entries: make(map[K]*cacheEntry[V]),
+		policy:  policy,
+	}
+}
+
+// NewLRUPolicy creates a policy evicting the least recently used key first, in constant time.
+func NewLRUPolicy[K comparable]() ICachePolicy[K] {
+	return &lruPolicy[K]{order: list.New(), elements: make(map[K]*list.Element)}
+}
+
+// NewTTLPolicy creates a policy evicting keys not used for ttl even if the cache is not full,
+// and the least recently used key first otherwise, in constant time.
+func NewTTLPolicy[K comparable](ttl time.Duration) ICachePolicy[K] {
+	return &lruPolicy[K]{order: list.New(), elements: make(map[K]*list.Element), ttl: ttl}
+}
+
+// NewLFUPolicy creates a policy evicting the least frequently used key first, in logarithmic time.
+func NewLFUPolicy[K comparable]() ICachePolicy[K] {
+	return &lfuPolicy[K]{items: make(map[K]*lfuItem[K])}
+}
+
+// Get returns the value of a key, marking it used.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	if !e.pinned {
+		c.policy.Touch(key)
+	}
+	return e.value, true
+}
+
+// Peek returns the value of a key without marking it used.
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		return e.value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Add sets the value of a key, marking it used.
+func (c *Cache[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.value = value
+		if !e.pinned {
+			c.policy.Touch(key)
+		}
+		return
+	}
+	c.entries[key] = &cacheEntry[V]{value: value}
+	c.policy.Add(key)
+}
+
+// Remove removes a key, returning its value.
+func (c *Cache[K, V]) Remove(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	delete(c.entries, key)
+	if !e.pinned {
+		c.policy.Remove(key)
+	}
+	return e.value, true
+}
+
+// Pin protects the entry of a key from eviction, returning false if the key is not cached.
+func (c *Cache[K, V]) Pin(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	if !e.pinned {
+		e.pinned = true
+		c.policy.Remove(key)
+	}
+	return true
+}
+
+// Unpin makes the entry of a key evictable again, as if it is just used.
+func (c *Cache[K, V]) Unpin(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	if e.pinned {
+		e.pinned = false
+		c.policy.Add(key)
+	}
+	return true
+}
+
+// IsPinned checks if the entry of a key is pinned.
+func (c *Cache[K, V]) IsPinned(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	return ok && e.pinned
+}
+
+// Len counts entries, pinned or not.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Range calls fn for every entry until fn returns false. The cache must not be changed by fn.
+func (c *Cache[K, V]) Range(fn func(key K, value V) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, e := range c.entries {
+		if !fn(key, e.value) {
+			return
+		}
+	}
+}
+
+// Shrink evicts entries in the order of the policy until at most size entries are left,
+// as well as entries expired, and returns the evicted entries.
+func (c *Cache[K, V]) Shrink(size int) []CacheEntry[K, V] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var evicted []CacheEntry[K, V]
+	now := time.Now()
+	for {
+		key, expired, ok := c.policy.Victim(now)
+		if !ok || (len(c.entries) <= size && !expired) {
+			return evicted
+		}
+		evicted = append(evicted, CacheEntry[K, V]{Key: key, Value: c.entries[key].value})
+		delete(c.entries, key)
+		c.policy.Remove(key)
+	}
+}
+
+func (p *lruPolicy[K]) Add(key K) {
+	p.elements[key] = p.order.PushBack(&lruItem[K]{key: key, access: time.Now()})
+}
+
+func (p *lruPolicy[K]) Touch(key K) {
+	if element, ok := p.elements[key]; ok {
+		element.Value.(*lruItem[K]).access = time.Now()
+		p.order.MoveToBack(element)
+	}
+}
+
+func (p *lruPolicy[K]) Remove(key K) {
+	if element, ok := p.elements[key]; ok {
+		p.order.Remove(element)
+		delete(p.elements, key)
+	}
+}
+
+func (p *lruPolicy[K]) Victim(now time.Time) (K, bool, bool) {
+	front := p.order.Front()
+	if front == nil {
+		var zero K
+		return zero, false, false
+	}
+	item := front.Value.(*lruItem[K])
+	return item.key, p.ttl > 0 && now.Sub(item.access) > p.ttl, true
+}
+
+func (p *lfuPolicy[K]) Add(key K) {
+	p.tick++
+	item := &lfuItem[K]{key: key, count: 1, tick: p.tick}
+	p.items[key] = item
+	heap.Push(&p.heap, item)
+}
+
+func (p *lfuPolicy[K]) Touch(key K) {
+	if item, ok := p.items[key]; ok {
+		p.tick++
+		item.count++
+		item.tick = p.tick
+		heap.Fix(&p.heap, item.index)
+	}
+}
+
+func (p *lfuPolicy[K]) Remove(key K) {
+	if item, ok := p.items[key]; ok {
+		heap.Remove(&p.heap, item.index)
+		delete(p.items, key)
+	}
+}
+
+func (p *lfuPolicy[K]) Victim(time.Time) (K, bool, bool) {
+	if len(p.heap) == 0 {
+		var zero K
+		return zero, false, false
+	}
+	return p.heap[0].key, false, true
+}
+
+func (h lfuHeap[K]) Len() int { return len(h) }
+func (h lfuHeap[K]) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].tick < h[j].tick
+}
+func (h lfuHeap[K]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *lfuHeap[K]) Push(x any) {
+	item := x.(*lfuItem[K])
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+func (h *lfuHeap[K]) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*h = old[0 : n-1]
+	return item
+}
@@ -0,0 +1,193 @@
+package structure
+
+import (
+	"container/heap"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func keys(entries []CacheEntry[string, int]) []string {
+	result := make([]string, len(entries))
+	for i, entry := range entries {
+		result[i] = entry.Key
+	}
+	return result
+}
+
+func TestCacheLRU(t *testing.T) {
+	c := NewCache[string, int](NewLRUPolicy[string]())
+	for i, key := range []string{"a", "b", "c", "d"} {
+		c.Add(key, i)
+	}
+	c.Get("a")
+	c.Add("b", 10)
+
+	evicted := c.Shrink(2)
+	if got := keys(evicted); len(got) != 2 || got[0] != "c" || got[1] != "d" {
+		t.Fatalf("c and d are expected to be evicted, but got %v", got)
+	}
+	if v, ok := c.Peek("b"); !ok || v != 10 {
+		t.Fatalf("b is expected to be 10, but got %v, %v", v, ok)
+	}
+	if c.Len() != 2 {
+		t.Fatalf("length is expected to be 2, but got %v", c.Len())
+	}
+	if _, ok := c.Remove("a"); !ok {
+		t.Fatalf("a is expected to be removed")
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Fatalf("a is expected to be absent")
+	}
+}
+
+func TestCacheLFU(t *testing.T) {
+	c := NewCache[string, int](NewLFUPolicy[string]())
+	for i, key := range []string{"a", "b", "c"} {
+		c.Add(key, i)
+	}
+	for range 3 {
+		c.Get("a")
+	}
+	c.Get("c")
+	c.Get("b")
+
+	// b and c are used as often, but c is used earlier
+	if got := keys(c.Shrink(1)); len(got) != 2 || got[0] != "c" || got[1] != "b" {
+		t.Fatalf("c and b are expected to be evicted, but got %v", got)
+	}
+	if _, ok := c.Peek("a"); !ok {
+		t.Fatalf("a is expected to be kept")
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	c := NewCache[string, int](NewTTLPolicy[string](20 * time.Millisecond))
+	c.Add("a", 1)
+	c.Add("b", 2)
+	if evicted := c.Shrink(10); len(evicted) != 0 {
+		t.Fatalf("nothing is expected to be evicted, but got %v", keys(evicted))
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	c.Get("b")
+	if got := keys(c.Shrink(10)); len(got) != 1 || got[0] != "a" {
+		t.Fatalf("expired a is expected to be evicted, but got %v", got)
+	}
+}
+
+func TestCachePinned(t *testing.T) {
+	c := NewCache[string, int](NewLRUPolicy[string]())
+	c.Add("a", 1)
+	c.Add("b", 2)
+	if c.Pin("x") {
+		t.Fatalf("absent key is not expected to be pinned")
+	}
+	if !c.Pin("a") || !c.IsPinned("a") {
+		t.Fatalf("a is expected to be pinned")
+	}
+
+	if got := keys(c.Shrink(0)); len(got) != 1 || got[0] != "b" {
+		t.Fatalf("only b is expected to be evicted, but got %v", got)
+	}
+	if c.Len() != 1 {
+		t.Fatalf("pinned a is expected to be kept, but got length %v", c.Len())
+	}
+
+	c.Unpin("a")
+	if got := keys(c.Shrink(0)); len(got) != 1 || got[0] != "a" {
+		t.Fatalf("unpinned a is expected to be evicted, but got %v", got)
+	}
+}
+
+// legacyEntry and legacyHeap reproduce the cache bookkeeping replaced by Cache,
+// which scans the heap to find the entry of a used key.
+type (
+	legacyEntry struct {
+		index  int
+		key    string
+		access time.Time
+	}
+
+	legacyHeap []*legacyEntry
+)
+
+func (h legacyHeap) Len() int           { return len(h) }
+func (h legacyHeap) Less(i, j int) bool { return h[i].access.Before(h[j].access) }
+func (h legacyHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *legacyHeap) Push(x any) {
+	entry := x.(*legacyEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+func (h *legacyHeap) Pop() any {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	*h = old[0 : n-1]
+	return entry
+}
+
+func (h *legacyHeap) touch(key string) {
+	for _, entry := range *h {
+		if entry.key == key {
+			entry.access = time.Now()
+			heap.Fix(h, entry.index)
+		}
+	}
+}
+
+const benchmarkCacheSize = 4096
+
+// benchmarkKeys picks n keys normally distributed over about twice as many keys as the cache holds.
+func benchmarkKeys(n int) []string {
+	r := rand.New(rand.NewSource(1))
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = strconv.Itoa(int(r.NormFloat64() * benchmarkCacheSize / 2))
+	}
+	return ids
+}
+
+func benchmarkCache(b *testing.B, policy ICachePolicy[string]) {
+	c := NewCache[string, int](policy)
+	ids := benchmarkKeys(b.N)
+
+	b.ResetTimer()
+	for i := range b.N {
+		key := ids[i]
+		if _, ok := c.Get(key); !ok {
+			c.Add(key, i)
+			c.Shrink(benchmarkCacheSize)
+		}
+	}
+}
+
+func BenchmarkCacheLRU(b *testing.B) { benchmarkCache(b, NewLRUPolicy[string]()) }
+func BenchmarkCacheLFU(b *testing.B) { benchmarkCache(b, NewLFUPolicy[string]()) }
+func BenchmarkCacheTTL(b *testing.B) { benchmarkCache(b, NewTTLPolicy[string](time.Minute)) }
+
+func BenchmarkCacheLegacyHeap(b *testing.B) {
+	cache := make(map[string]int)
+	h := make(legacyHeap, 0)
+	ids := benchmarkKeys(b.N)
+
+	b.ResetTimer()
+	for i := range b.N {
+		key := ids[i]
+		if _, ok := cache[key]; ok {
+			h.touch(key)
+			continue
+		}
+		cache[key] = i
+		heap.Push(&h, &legacyEntry{key: key, access: time.Now()})
+		for h.Len() > benchmarkCacheSize {
+			delete(cache, heap.Pop(&h).(*legacyEntry).key)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 package structure
 
 import (
-	"runtime"
+	"context"
 	"sync"
 	"sync/atomic"
 )
@@ -11,128 +11,314 @@ type Nillable interface {
 	~*struct{} | *any | any
 }
 
-// RingBuffer is a fixed-size, thread-safe ring buffer.
-type RingBuffer[T Nillable] struct {
-	buffer   []T
-	capacity uint64
-	writePos atomic.Uint64
-	readPos  atomic.Uint64
-}
+// cacheLinePad keeps positions of producers and consumers on distinct cache lines.
+type cacheLinePad [64]byte
+
+type (
+	// RingBuffer is a fixed-size, thread-safe ring buffer of multiple producers and consumers.
+	// Every slot carries a sequence number telling whether it is ready to be written or read for a position,
+	// so that an entry is published to consumers only once it is written.
+	// The sequence of a slot free for position pos is 2*pos, and 2*pos+1 once the entry of pos is published.
+	RingBuffer[T Nillable] struct {
+		_        cacheLinePad
+		writePos atomic.Uint64
+		_        cacheLinePad
+		readPos  atomic.Uint64
+		_        cacheLinePad
+
+		slots    []ringSlot[T]
+		capacity uint64
+
+		// readable and writable wake up waiters of PopWait and PushWait, see signal
+		readable chan struct{}
+		writable chan struct{}
+	}
+
+	ringSlot[T any] struct {
+		sequence atomic.Uint64
+		entry    T
+	}
+)
 
 func NewRingBuffer[T Nillable](size int) *RingBuffer[T] {
 	if size <= 0 {
 		size = 1 // Prevent zero-size buffer
 	}
-	return &RingBuffer[T]{
-		buffer:   make([]T, size),
+	r := &RingBuffer[T]{
+		slots:    make([]ringSlot[T], size),
 		capacity: uint64(size),
+		readable: make(chan struct{}, 1),
+		writable: make(chan struct{}, 1),
+	}
+	for i := range r.slots {
+		r.slots[i].sequence.Store(uint64(i) << 1)
 	}
+	return r
 }
 
+// Push pushes an entry, returning false if the buffer is full.
 func (r *RingBuffer[T]) Push(entry T) bool {
+	pos := r.writePos.Load()
 	for {
-		read := r.readPos.Load()
-		write := r.writePos.Load()
-
-		if write-read >= r.capacity { // Buffer full
+		slot := &r.slots[pos%r.capacity]
+		diff := int64(slot.sequence.Load()) - int64(pos<<1)
+		switch {
+		case diff == 0: // slot is free for the position
+			if r.writePos.CompareAndSwap(pos, pos+1) {
+				slot.entry = entry
+				slot.sequence.Store(pos<<1 + 1) // publish
+				signal(r.readable)
+				return true
+			}
+			pos = r.writePos.Load()
+		case diff < 0: // slot is not read yet a round ago
 			return false
-		}
-
-		nextWrite := write + 1
-		if r.writePos.CompareAndSwap(write, nextWrite) {
-			r.buffer[write%r.capacity] = entry
-			return true
+		default: // position is taken by another producer
+			pos = r.writePos.Load()
 		}
 	}
 }
 
+// Pop pops the oldest entry, returning false if the buffer is empty.
 func (r *RingBuffer[T]) Pop() (T, bool) {
 	var zero T
+	pos := r.readPos.Load()
 	for {
-		read := r.readPos.Load()
-		write := r.writePos.Load()
-
-		if read > write { // Buffer empty
+		slot := &r.slots[pos%r.capacity]
+		diff := int64(slot.sequence.Load()) - int64(pos<<1+1)
+		switch {
+		case diff == 0: // slot is published for the position
+			if r.readPos.CompareAndSwap(pos, pos+1) {
+				entry := slot.entry
+				slot.entry = zero
+				slot.sequence.Store((pos + r.capacity) << 1) // free for the next round
+				signal(r.writable)
+				return entry, true
+			}
+			pos = r.readPos.Load()
+		case diff < 0: // slot is not written yet
 			return zero, false
+		default: // position is taken by another consumer
+			pos = r.readPos.Load()
+		}
+	}
+}
+
+// PushWait pushes an entry, waiting for room until ctx is done.
+func (r *RingBuffer[T]) PushWait(ctx context.Context, entry T) error {
+	for {
+		if r.Push(entry) {
+			r.chain(r.writable, r.Len() < r.capacity)
+			return nil
+		}
+		select {
+		case <-r.writable:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
+	}
+}
 
-		nextRead := read + 1
-		if r.readPos.CompareAndSwap(read, nextRead) {
-			entry := r.buffer[read%r.capacity]
-			return entry, true
+// PopWait pops the oldest entry, waiting for one until ctx is done.
+func (r *RingBuffer[T]) PopWait(ctx context.Context) (T, error) {
+	for {
+		if entry, ok := r.Pop(); ok {
+			r.chain(r.readable, r.Len() > 0)
+			return entry, nil
+		}
+		select {
+		case <-r.readable:
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
 		}
 	}
 }
 
+// PushN pushes entries in order until the buffer is full, and returns the number of entries pushed.
+func (r *RingBuffer[T]) PushN(entries []T) int {
+	for i, entry := range entries {
+		if !r.Push(entry) {
+			return i
+		}
+	}
+	return len(entries)
+}
+
+// PopN pops up to n oldest entries.
+func (r *RingBuffer[T]) PopN(n int) []T {
+	entries := make([]T, 0, min(uint64(max(n, 0)), r.capacity))
+	for range n {
+		entry, ok := r.Pop()
+		if !ok {
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Len counts entries pushed and not popped.
 func (r *RingBuffer[T]) Len() uint64 {
 	read := r.readPos.Load()
 	write := r.writePos.Load()
 	if write < read {
 		return 0
 	}
-	return write - read
+	return min(write-read, r.capacity)
 }
 
-type node[T any] struct {
-	data T
-	next *node[T]
+// Cap returns the capacity of the buffer.
+func (r *RingBuffer[T]) Cap() uint64 {
+	return r.capacity
 }
 
-// ElasticBuffer extends RingBuffer with an overflow slice.
-type ElasticBuffer[T any] struct {
-	nodes    atomic.Pointer[node[T]]
-	nodePool sync.Pool
+// chain passes a wake-up on to another waiter if the condition still holds,
+// as wake-ups of several pushes or pops may have been merged into one.
+func (r *RingBuffer[T]) chain(ch chan struct{}, holds bool) {
+	if holds {
+		signal(ch)
+	}
 }
 
-func NewElasticBuffer[T any]() *ElasticBuffer[T] {
-	return &ElasticBuffer[T]{
-		nodePool: sync.Pool{
-			New: func() any { return new(node[T]) },
-		},
+// signal wakes up a waiter without blocking.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
 	}
 }
 
-func (erb *ElasticBuffer[T]) Push(entry T) {
+// overflowSegmentSize is the number of entries of an overflow segment of ElasticBuffer.
+const overflowSegmentSize = 64
 
-	newNode := erb.nodePool.Get().(*node[T])
-	newNode.data = entry
-	newNode.next = nil
+type (
+	// ElasticBuffer is an unbounded, thread-safe FIFO buffer backed by a RingBuffer,
+	// which spills entries into a list of overflow segments once the ring is full.
+	// Producers push to the ring concurrently under a shared lock, and serialize on an exclusive lock while
+	// the buffer is spilled, so that no entry gets ahead of spilled ones. Consumers pop the ring first,
+	// as its entries are always older than spilled ones.
+	ElasticBuffer[T any] struct {
+		ring *RingBuffer[T]
 
-	for {
-		head := erb.nodes.Load()
-		newNode.next = head
-		if erb.nodes.CompareAndSwap(head, newNode) {
+		mu       sync.RWMutex
+		spilled  atomic.Bool
+		head     *overflowSegment[T]
+		tail     *overflowSegment[T]
+		overflow atomic.Uint64
+
+		highWater atomic.Uint64
+	}
+
+	overflowSegment[T any] struct {
+		entries    [overflowSegmentSize]T
+		read, size int
+		next       *overflowSegment[T]
+	}
+)
+
+// NewElasticBuffer creates an elastic buffer whose ring holds size entries.
+func NewElasticBuffer[T any](size int) *ElasticBuffer[T] {
+	return &ElasticBuffer[T]{
+		ring: NewRingBuffer[T](size),
+	}
+}
+
+// Push pushes an entry, spilling it into the overflow if the ring is full.
+func (eb *ElasticBuffer[T]) Push(entry T) {
+	if !eb.spilled.Load() {
+		eb.mu.RLock()
+		pushed := !eb.spilled.Load() && eb.ring.Push(entry)
+		eb.mu.RUnlock()
+		if pushed {
+			eb.observe()
 			return
 		}
 	}
+
+	eb.mu.Lock()
+	if eb.spilled.Load() || !eb.ring.Push(entry) {
+		eb.spill(entry)
+	}
+	eb.mu.Unlock()
+	eb.observe()
 }
 
-func (erb *ElasticBuffer[T]) Pop() (T, bool) {
-	var zero T
+// Pop pops the oldest entry, returning false if the buffer is empty.
+func (eb *ElasticBuffer[T]) Pop() (T, bool) {
+	if entry, ok := eb.ring.Pop(); ok {
+		return entry, true
+	}
+	if !eb.spilled.Load() {
+		var zero T
+		return zero, false
+	}
 
-	for {
-		head := erb.nodes.Load()
-		if head == nil {
-			return zero, false
-		}
-		next := head.next
-		if erb.nodes.CompareAndSwap(head, next) {
-			data := head.data
-			head.data = zero
-			head.next = nil
-			erb.nodePool.Put(head)
-			return data, true
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	// Entries pushed to the ring before the buffer spilled go first
+	if entry, ok := eb.ring.Pop(); ok {
+		return entry, true
+	}
+	return eb.unspill()
+}
+
+// Len counts entries pushed and not popped.
+func (eb *ElasticBuffer[T]) Len() uint64 {
+	return eb.ring.Len() + eb.overflow.Load()
+}
+
+// HighWaterMark returns the largest number of entries the buffer has held.
+func (eb *ElasticBuffer[T]) HighWaterMark() uint64 {
+	return eb.highWater.Load()
+}
+
+// spill appends an entry to the overflow, with mu held.
+func (eb *ElasticBuffer[T]) spill(entry T) {
+	if eb.tail == nil || eb.tail.read+eb.tail.size == overflowSegmentSize {
+		segment := &overflowSegment[T]{}
+		if eb.tail == nil {
+			eb.head = segment
+		} else {
+			eb.tail.next = segment
 		}
-		runtime.Gosched()
+		eb.tail = segment
 	}
+	eb.tail.entries[eb.tail.read+eb.tail.size] = entry
+	eb.tail.size++
+	eb.overflow.Add(1)
+	eb.spilled.Store(true)
 }
 
-func (erb *ElasticBuffer[T]) Len() uint64 {
-	var length uint64 = 0
-	head := erb.nodes.Load()
-	for head != nil {
-		length++
-		head = head.next
+// unspill takes the oldest entry of the overflow, with mu held.
+func (eb *ElasticBuffer[T]) unspill() (T, bool) {
+	var zero T
+	segment := eb.head
+	if segment == nil {
+		return zero, false
+	}
+
+	entry := segment.entries[segment.read]
+	segment.entries[segment.read] = zero
+	segment.read++
+	segment.size--
+	eb.overflow.Add(^uint64(0))
+	if eb.overflow.Load() == 0 {
+		eb.head, eb.tail = nil, nil
+		eb.spilled.Store(false)
+	} else if segment.size == 0 {
+		eb.head = segment.next
+	}
+	return entry, true
+}
+
+// observe raises the high-water mark to the current length.
+func (eb *ElasticBuffer[T]) observe() {
+	length := eb.Len()
+	for {
+		high := eb.highWater.Load()
+		if length <= high || eb.highWater.CompareAndSwap(high, length) {
+			return
+		}
 	}
-	return length
 }
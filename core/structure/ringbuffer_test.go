@@ -0,0 +1,329 @@
+package structure
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRingBuffer(t *testing.T) {
+	r := NewRingBuffer[int](3)
+	if _, ok := r.Pop(); ok {
+		t.Fatalf("empty buffer is expected to pop nothing")
+	}
+
+	for round := range 3 {
+		for i := range 3 {
+			if !r.Push(round*3 + i) {
+				t.Fatalf("push %v is expected to succeed", round*3+i)
+			}
+		}
+		if r.Push(-1) {
+			t.Fatalf("full buffer is expected to reject a push")
+		}
+		if r.Len() != 3 {
+			t.Fatalf("length is expected to be 3, but got %v", r.Len())
+		}
+		for i := range 3 {
+			if v, ok := r.Pop(); !ok || v != round*3+i {
+				t.Fatalf("pop is expected to return %v, but got %v, %v", round*3+i, v, ok)
+			}
+		}
+		if _, ok := r.Pop(); ok {
+			t.Fatalf("drained buffer is expected to pop nothing")
+		}
+	}
+}
+
+func TestRingBufferBatch(t *testing.T) {
+	r := NewRingBuffer[int](4)
+	if n := r.PushN([]int{0, 1, 2, 3, 4, 5}); n != 4 {
+		t.Fatalf("4 entries are expected to be pushed, but got %v", n)
+	}
+	if got := r.PopN(3); len(got) != 3 || got[0] != 0 || got[2] != 2 {
+		t.Fatalf("first 3 entries are expected to be popped, but got %v", got)
+	}
+	if got := r.PopN(3); len(got) != 1 || got[0] != 3 {
+		t.Fatalf("the remaining entry is expected to be popped, but got %v", got)
+	}
+}
+
+func TestRingBufferWait(t *testing.T) {
+	r := NewRingBuffer[int](1)
+
+	popped := make(chan int)
+	go func() {
+		v, err := r.PopWait(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		popped <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := r.PushWait(context.Background(), 42); err != nil {
+		t.Fatal(err)
+	}
+	if v := <-popped; v != 42 {
+		t.Fatalf("waiting pop is expected to return 42, but got %v", v)
+	}
+
+	// Waiting push gives up once ctx is done
+	r.Push(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := r.PushWait(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("push to a full buffer is expected to time out, but got %v", err)
+	}
+
+	// Waiting push proceeds once an entry is popped
+	pushed := make(chan error)
+	go func() { pushed <- r.PushWait(context.Background(), 3) }()
+	time.Sleep(10 * time.Millisecond)
+	if v, ok := r.Pop(); !ok || v != 1 {
+		t.Fatalf("pop is expected to return 1, but got %v, %v", v, ok)
+	}
+	if err := <-pushed; err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := r.Pop(); v != 3 {
+		t.Fatalf("pop is expected to return 3, but got %v", v)
+	}
+}
+
+// TestRingBufferConcurrency checks every entry pushed by producers is popped by consumers exactly once.
+// Run it with -race.
+func TestRingBufferConcurrency(t *testing.T) {
+	const producers, consumers, perProducer = 4, 4, 5000
+
+	for _, capacity := range []int{1, 7, 64} {
+		r := NewRingBuffer[*int](capacity)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+
+		var wg sync.WaitGroup
+		for p := range producers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range perProducer {
+					v := p*perProducer + i
+					if err := r.PushWait(ctx, &v); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+		}
+
+		seen := make([][]int, consumers)
+		var consumed sync.WaitGroup
+		for c := range consumers {
+			consumed.Add(1)
+			go func() {
+				defer consumed.Done()
+				for range producers * perProducer / consumers {
+					v, err := r.PopWait(ctx)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					seen[c] = append(seen[c], *v)
+				}
+			}()
+		}
+		wg.Wait()
+		consumed.Wait()
+		cancel()
+
+		counts := make([]int, producers*perProducer)
+		for _, values := range seen {
+			for _, v := range values {
+				counts[v]++
+			}
+		}
+		for v, count := range counts {
+			if count != 1 {
+				t.Fatalf("entry %v is expected to be popped once from buffer of capacity %v, but popped %v times", v, capacity, count)
+			}
+		}
+		if r.Len() != 0 {
+			t.Fatalf("buffer is expected to be empty, but got length %v", r.Len())
+		}
+	}
+}
+
+func BenchmarkRingBuffer(b *testing.B) {
+	r := NewRingBuffer[int](1024)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			for !r.Push(1) {
+				r.Pop()
+			}
+			r.Pop()
+		}
+	})
+}
+
+func BenchmarkRingBufferWait(b *testing.B) {
+	r := NewRingBuffer[int](1024)
+	ctx := context.Background()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range b.N {
+			r.PopWait(ctx)
+		}
+	}()
+
+	b.ResetTimer()
+	for range b.N {
+		r.PushWait(ctx, 1)
+	}
+	<-done
+}
+
+func BenchmarkChannel(b *testing.B) {
+	ch := make(chan int, 1024)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			select {
+			case ch <- 1:
+			default:
+				<-ch
+			}
+			select {
+			case <-ch:
+			default:
+			}
+		}
+	})
+}
+
+func TestElasticBuffer(t *testing.T) {
+	eb := NewElasticBuffer[int](4)
+	for round := range 2 {
+		for i := range 200 {
+			eb.Push(i)
+		}
+		if eb.Len() != 200 {
+			t.Fatalf("length is expected to be 200, but got %v", eb.Len())
+		}
+		// Pop some and push more while spilled
+		for i := range 10 {
+			if v, ok := eb.Pop(); !ok || v != i {
+				t.Fatalf("pop is expected to return %v, but got %v, %v", i, v, ok)
+			}
+		}
+		for i := range 10 {
+			eb.Push(200 + i)
+		}
+		for i := 10; i < 210; i++ {
+			if v, ok := eb.Pop(); !ok || v != i {
+				t.Fatalf("pop of round %v is expected to return %v, but got %v, %v", round, i, v, ok)
+			}
+		}
+		if _, ok := eb.Pop(); ok {
+			t.Fatalf("drained buffer is expected to pop nothing")
+		}
+	}
+	if eb.HighWaterMark() != 200 {
+		t.Fatalf("high-water mark is expected to be 200, but got %v", eb.HighWaterMark())
+	}
+
+	// Back to the ring once drained
+	eb.Push(1)
+	if v, ok := eb.Pop(); !ok || v != 1 {
+		t.Fatalf("pop is expected to return 1, but got %v, %v", v, ok)
+	}
+}
+
+// TestElasticBufferConcurrency checks entries of every producer are popped once and in the order they are pushed.
+// Run it with -race.
+func TestElasticBufferConcurrency(t *testing.T) {
+	const producers, perProducer = 4, 20000
+
+	eb := NewElasticBuffer[[2]int](8)
+	var wg sync.WaitGroup
+	for p := range producers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perProducer {
+				eb.Push([2]int{p, i})
+			}
+		}()
+	}
+
+	next := make([]int, producers)
+	deadline := time.Now().Add(10 * time.Second)
+	for popped := 0; popped < producers*perProducer; {
+		v, ok := eb.Pop()
+		if !ok {
+			if time.Now().After(deadline) {
+				t.Fatalf("only %v entries are popped", popped)
+			}
+			continue
+		}
+		if v[1] != next[v[0]] {
+			t.Fatalf("entry %v of producer %v is expected, but got %v", next[v[0]], v[0], v[1])
+		}
+		next[v[0]]++
+		popped++
+	}
+	wg.Wait()
+	if eb.Len() != 0 {
+		t.Fatalf("buffer is expected to be empty, but got length %v", eb.Len())
+	}
+}
+
+func TestElasticBufferConsumers(t *testing.T) {
+	const producers, consumers, perProducer = 4, 4, 5000
+
+	eb := NewElasticBuffer[int](16)
+	var wg sync.WaitGroup
+	for p := range producers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perProducer {
+				eb.Push(p*perProducer + i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := make([][]int, consumers)
+	for c := range consumers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v, ok := eb.Pop(); ok; v, ok = eb.Pop() {
+				seen[c] = append(seen[c], v)
+			}
+		}()
+	}
+	wg.Wait()
+
+	counts := make([]int, producers*perProducer)
+	for _, values := range seen {
+		for _, v := range values {
+			counts[v]++
+		}
+	}
+	for v, count := range counts {
+		if count != 1 {
+			t.Fatalf("entry %v is expected to be popped once, but popped %v times", v, count)
+		}
+	}
+}
+
+func BenchmarkElasticBuffer(b *testing.B) {
+	eb := NewElasticBuffer[int](1024)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			eb.Push(1)
+			eb.Pop()
+		}
+	})
+}
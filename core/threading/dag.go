@@ -0,0 +1,295 @@
+package threading
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	TaskSucceeded TaskState = iota
+	TaskFailed
+	TaskCanceled
+	// TaskSkipped is the state of a task not run because a dependency of it failed.
+	TaskSkipped
+)
+
+// ErrDAGCycle is returned by DAG.Run if dependencies of tasks form a cycle.
+var ErrDAGCycle = fmt.Errorf("dag error: dependency cycle")
+
+type (
+	// TaskState is the outcome state of a task run by a DAG.
+	TaskState int
+
+	// IAwaitableTask is the interface for a task whose completion can be awaited.
+	// Tasks embedding BaseTask implement it, and fail by finishing themselves with an error, see BaseTask.Finish.
+	IAwaitableTask interface {
+		Done() <-chan struct{}
+		Err() error
+	}
+
+	// TaskOutcome is the outcome of a task run by a DAG.
+	TaskOutcome struct {
+		ID    string
+		State TaskState
+		Err   error
+	}
+
+	// DAGSummary is the outcome of every task run by a DAG, in the order the tasks are added.
+	DAGSummary struct {
+		Outcomes []*TaskOutcome
+		byID     map[string]*TaskOutcome
+	}
+
+	// DAG runs tasks on a WorkerPool after the tasks they depend on, running ready tasks in parallel.
+	// A task whose dependency fails is skipped, and one whose dependency is canceled is canceled.
+	// A DAG is run once.
+	DAG struct {
+		pool  *WorkerPool
+		nodes []*dagNode
+		byID  map[string]*dagNode
+		ran   bool
+	}
+
+	dagNode struct {
+		task       ITask
+		deps       []string
+		dependents []*dagNode
+		pending    int
+		outcome    *TaskOutcome
+		submitErr  error
+	}
+)
+
+func NewDAG(pool *WorkerPool) *DAG {
+	return &DAG{
+		pool: pool,
+		byID: make(map[string]*dagNode),
+	}
+}
+
+func (s TaskState) String() string {
+	switch s {
+	case TaskSucceeded:
+		return "succeeded"
+	case TaskFailed:
+		return "failed"
+	case TaskCanceled:
+		return "canceled"
+	case TaskSkipped:
+		return "skipped"
+	}
+	return fmt.Sprintf("TaskState(%d)", int(s))
+}
+
+// Add adds a task depending on tasks of IDs. Dependencies may be added later, but before the DAG is run.
+func (d *DAG) Add(task ITask, deps ...string) error {
+	if _, ok := task.(IAwaitableTask); !ok {
+		return fmt.Errorf("task %v cannot be awaited, embed BaseTask in it", task.GetID())
+	}
+	if d.ran {
+		return fmt.Errorf("dag has been run")
+	}
+	if _, ok := d.byID[task.GetID()]; ok {
+		return fmt.Errorf("task %v has been added", task.GetID())
+	}
+
+	n := &dagNode{task: task, deps: deps}
+	d.nodes = append(d.nodes, n)
+	d.byID[task.GetID()] = n
+	return nil
+}
+
+func (d *DAG) Run() (*DAGSummary, error) {
+	return d.RunCtx(context.Background())
+}
+
+// RunCtx runs the tasks and waits for all of them to be done.
+// Tasks not done once ctx is done are canceled. An error is returned if a dependency is unknown or forms a cycle,
+// in which case no task is run.
+func (d *DAG) RunCtx(ctx context.Context) (*DAGSummary, error) {
+	if d.ran {
+		return nil, fmt.Errorf("dag has been run")
+	}
+	d.ran = true
+	if err := d.validate(); err != nil {
+		return nil, err
+	}
+
+	summary := &DAGSummary{byID: make(map[string]*TaskOutcome, len(d.nodes))}
+	for _, n := range d.nodes {
+		summary.Outcomes = append(summary.Outcomes, &TaskOutcome{ID: n.task.GetID()})
+		summary.byID[n.task.GetID()] = summary.Outcomes[len(summary.Outcomes)-1]
+	}
+
+	results := make(chan *dagNode, len(d.nodes))
+	remaining := len(d.nodes)
+	for _, n := range d.nodes {
+		if n.pending == 0 {
+			d.submit(ctx, n, results)
+		}
+	}
+
+	for remaining > 0 {
+		n := <-results
+		remaining--
+
+		outcome := summary.byID[n.task.GetID()]
+		n.outcome = outcome
+		outcome.State, outcome.Err = n.result()
+
+		for _, dependent := range n.dependents {
+			if dependent.outcome != nil {
+				continue
+			}
+			switch outcome.State {
+			case TaskSucceeded:
+				if dependent.pending--; dependent.pending == 0 {
+					d.submit(ctx, dependent, results)
+				}
+			case TaskFailed, TaskSkipped:
+				remaining -= d.skip(summary, dependent, TaskSkipped, fmt.Errorf("dependency %v of task %v failed: %w", n.task.GetID(), dependent.task.GetID(), outcome.Err))
+			case TaskCanceled:
+				remaining -= d.skip(summary, dependent, TaskCanceled, fmt.Errorf("dependency %v of task %v is canceled: %w", n.task.GetID(), dependent.task.GetID(), ErrTaskCanceled))
+			}
+		}
+	}
+	return summary, nil
+}
+
+// validate links dependencies of tasks and detects cycles.
+func (d *DAG) validate() error {
+	for _, n := range d.nodes {
+		n.pending = len(n.deps)
+		for _, id := range n.deps {
+			dep, ok := d.byID[id]
+			if !ok {
+				return fmt.Errorf("dependency %v of task %v is unknown", id, n.task.GetID())
+			}
+			dep.dependents = append(dep.dependents, n)
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := make(map[*dagNode]int, len(d.nodes))
+	var path []string
+	var visit func(n *dagNode) error
+	visit = func(n *dagNode) error {
+		switch states[n] {
+		case visiting:
+			start := 0
+			for i, id := range path {
+				if id == n.task.GetID() {
+					start = i
+				}
+			}
+			return fmt.Errorf("%w: %v", ErrDAGCycle, strings.Join(append(path[start:], n.task.GetID()), " -> "))
+		case visited:
+			return nil
+		}
+
+		states[n] = visiting
+		path = append(path, n.task.GetID())
+		for _, dependent := range n.dependents {
+			if err := visit(dependent); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		states[n] = visited
+		return nil
+	}
+	for _, n := range d.nodes {
+		if err := visit(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// submit submits a ready task and reports it once done.
+func (d *DAG) submit(ctx context.Context, n *dagNode, results chan<- *dagNode) {
+	task := n.task.(IAwaitableTask)
+	GoSafe(func() {
+		defer func() { results <- n }()
+
+		if _, err := d.pool.SubmitCtx(ctx, n.task); err != nil {
+			n.submitErr = err
+			return
+		}
+		select {
+		case <-task.Done():
+		case <-ctx.Done():
+			n.task.Cancel()
+			<-task.Done()
+		}
+	})
+}
+
+// skip resolves a task not to be run and its dependents, returning the number of tasks resolved.
+func (d *DAG) skip(summary *DAGSummary, n *dagNode, state TaskState, err error) int {
+	if n.outcome != nil {
+		return 0
+	}
+	n.outcome = summary.byID[n.task.GetID()]
+	n.outcome.State, n.outcome.Err = state, err
+	n.task.Cancel()
+
+	resolved := 1
+	for _, dependent := range n.dependents {
+		resolved += d.skip(summary, dependent, state, err)
+	}
+	return resolved
+}
+
+// result is the outcome state and error of a done task.
+func (n *dagNode) result() (TaskState, error) {
+	if n.submitErr != nil {
+		if errors.Is(n.submitErr, context.Canceled) || errors.Is(n.submitErr, context.DeadlineExceeded) {
+			return TaskCanceled, n.submitErr
+		}
+		return TaskFailed, n.submitErr
+	}
+	if n.task.IsCanceled() {
+		if err := n.task.(IAwaitableTask).Err(); err != nil {
+			return TaskCanceled, err
+		}
+		return TaskCanceled, ErrTaskCanceled
+	}
+	if err := n.task.(IAwaitableTask).Err(); err != nil {
+		return TaskFailed, err
+	}
+	return TaskSucceeded, nil
+}
+
+// Get returns the outcome of a task.
+func (s *DAGSummary) Get(ID string) (*TaskOutcome, bool) {
+	outcome, ok := s.byID[ID]
+	return outcome, ok
+}
+
+// Succeeded checks if every task succeeded.
+func (s *DAGSummary) Succeeded() bool {
+	for _, outcome := range s.Outcomes {
+		if outcome.State != TaskSucceeded {
+			return false
+		}
+	}
+	return true
+}
+
+// Err joins errors of tasks failed, canceled or skipped.
+func (s *DAGSummary) Err() error {
+	var errs []error
+	for _, outcome := range s.Outcomes {
+		if outcome.Err != nil {
+			errs = append(errs, outcome.Err)
+		}
+	}
+	return errors.Join(errs...)
+}
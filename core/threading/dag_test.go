@@ -0,0 +1,158 @@
+package threading
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockDAGTask struct {
+	BaseTask
+	process func() error
+}
+
+func newMockDAGTask(id string, process func() error) *mockDAGTask {
+	return &mockDAGTask{
+		BaseTask: BaseTask{ID: id},
+		process:  process,
+	}
+}
+
+func (m *mockDAGTask) Process() {
+	m.Finish(m.process())
+}
+
+func TestDAGOrder(t *testing.T) {
+	wp := NewWorkerPool(0, 4, 16)
+	defer wp.Shutdown()
+
+	var mu sync.Mutex
+	var order []string
+	record := func(id string) func() error {
+		return func() error {
+			mu.Lock()
+			order = append(order, id)
+			mu.Unlock()
+			return nil
+		}
+	}
+
+	// the parent aggregates children recomputed in parallel
+	dag := NewDAG(wp)
+	for _, err := range []error{
+		dag.Add(newMockDAGTask("parent", record("parent")), "child-0", "child-1"),
+		dag.Add(newMockDAGTask("child-0", record("child-0")), "leaf"),
+		dag.Add(newMockDAGTask("child-1", record("child-1"))),
+		dag.Add(newMockDAGTask("leaf", record("leaf"))),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	summary, err := dag.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !summary.Succeeded() {
+		t.Fatalf("all tasks are expected to succeed, but got %v", summary.Err())
+	}
+
+	index := make(map[string]int)
+	for i, id := range order {
+		index[id] = i
+	}
+	if len(order) != 4 || index["parent"] != 3 || index["leaf"] > index["child-0"] {
+		t.Fatalf("tasks are expected to run after their dependencies, but run in order %v", order)
+	}
+}
+
+func TestDAGFailure(t *testing.T) {
+	wp := NewWorkerPool(0, 4, 16)
+	defer wp.Shutdown()
+
+	cause := errors.New("cause")
+	dag := NewDAG(wp)
+	dag.Add(newMockDAGTask("a", func() error { return cause }))
+	dag.Add(newMockDAGTask("b", func() error { return nil }), "a")
+	dag.Add(newMockDAGTask("c", func() error { return nil }), "b")
+	dag.Add(newMockDAGTask("d", func() error { return nil }))
+	dag.Add(newMockDAGTask("e", func() error { panic("boom") }))
+
+	summary, err := dag.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]TaskState{"a": TaskFailed, "b": TaskSkipped, "c": TaskSkipped, "d": TaskSucceeded, "e": TaskFailed}
+	for id, state := range expected {
+		outcome, _ := summary.Get(id)
+		if outcome.State != state {
+			t.Fatalf("task %v is expected to be %v, but is %v (%v)", id, state, outcome.State, outcome.Err)
+		}
+	}
+	if outcome, _ := summary.Get("c"); !errors.Is(outcome.Err, cause) {
+		t.Fatalf("failure is expected to propagate to dependents, but got %v", outcome.Err)
+	}
+	if summary.Succeeded() || !errors.Is(summary.Err(), cause) {
+		t.Fatalf("summary is expected to report the failure, but got %v", summary.Err())
+	}
+}
+
+func TestDAGCancel(t *testing.T) {
+	wp := NewWorkerPool(0, 1, 16)
+	defer wp.Shutdown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	dag := NewDAG(wp)
+	dag.Add(newMockDAGTask("slow", func() error {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	}))
+	dag.Add(newMockDAGTask("dependent", func() error { return nil }), "slow")
+
+	go func() {
+		<-started
+		cancel()
+	}()
+	summary, err := dag.RunCtx(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, outcome := range summary.Outcomes {
+		if outcome.State != TaskCanceled {
+			t.Fatalf("task %v is expected to be canceled, but is %v", outcome.ID, outcome.State)
+		}
+	}
+}
+
+func TestDAGValidation(t *testing.T) {
+	wp := NewWorkerPool(0, 1, 16)
+	defer wp.Shutdown()
+
+	processed := false
+	dag := NewDAG(wp)
+	dag.Add(newMockDAGTask("free", func() error { processed = true; return nil }))
+	dag.Add(newMockDAGTask("a", func() error { return nil }), "c")
+	dag.Add(newMockDAGTask("b", func() error { return nil }), "a")
+	dag.Add(newMockDAGTask("c", func() error { return nil }), "b")
+	if err := dag.Add(newMockDAGTask("a", func() error { return nil })); err == nil {
+		t.Fatal("adding a task of a duplicate ID is expected to fail")
+	}
+
+	_, err := dag.Run()
+	if !errors.Is(err, ErrDAGCycle) {
+		t.Fatalf("cycle is expected to be detected, but got %v", err)
+	}
+	if processed {
+		t.Fatal("no task is expected to run if a cycle is detected")
+	}
+
+	dag = NewDAG(wp)
+	dag.Add(newMockDAGTask("a", func() error { return nil }), "unknown")
+	if _, err := dag.Run(); err == nil {
+		t.Fatal("unknown dependency is expected to be detected")
+	}
+}
@@ -0,0 +1,87 @@
+package threading
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/world-in-progress/yggdrasil/core/rescue"
+)
+
+// WithTaskTimeout bounds the processing time of tasks not declaring their own timeout, see ITimeoutTask.
+// Zero means no limit.
+func WithTaskTimeout(timeout time.Duration) PoolOption {
+	return func(wp *WorkerPool) {
+		wp.taskTimeout = timeout
+	}
+}
+
+// timeoutOf returns the timeout of a task, or the one of the pool if the task does not declare one.
+func (wp *WorkerPool) timeoutOf(task ITask) time.Duration {
+	if t, ok := task.(ITimeoutTask); ok && t.GetTimeout() > 0 {
+		return t.GetTimeout()
+	}
+	return wp.taskTimeout
+}
+
+// process processes a task within its deadline.
+// A task exceeding its deadline, or whose context is done, is completed with an error and left behind,
+// so that the worker is freed even if the task ignores cancellation.
+func (wp *WorkerPool) process(task ITask) {
+	ctx := context.Background()
+	if ctxTask, ok := task.(IContextTask); ok && ctxTask.Context() != nil {
+		ctx = ctxTask.Context()
+	}
+
+	timeout := wp.timeoutOf(task)
+	if timeout <= 0 && ctx.Done() == nil {
+		run(ctx, task)
+		return
+	}
+
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	processed := make(chan struct{})
+	GoSafeCtx(ctx, func() {
+		defer close(processed)
+		run(ctx, task)
+	})
+
+	select {
+	case <-processed:
+	case <-ctx.Done():
+		err := fmt.Errorf("task %v is abandoned: %w", task.GetID(), ctx.Err())
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("task %v exceeded its deadline: %w", task.GetID(), ErrTaskTimeout)
+		}
+		if t, ok := task.(IFinishableTask); ok {
+			t.Finish(err)
+		} else {
+			task.Cancel()
+		}
+	}
+}
+
+// run processes a task with ctx if it is a context task, finishing it with the error of a panic.
+func run(ctx context.Context, task ITask) {
+	var panicErr error
+	defer func() {
+		if t, ok := task.(IFinishableTask); ok && panicErr != nil {
+			t.Finish(fmt.Errorf("task %v panicked: %w", task.GetID(), panicErr))
+		}
+	}()
+	defer rescue.RecoverToError(ctx, &panicErr)
+
+	if ctxTask, ok := task.(IContextTask); ok {
+		ctxTask.ProcessCtx(ctx)
+		return
+	}
+	task.Process()
+}
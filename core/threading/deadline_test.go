@@ -0,0 +1,99 @@
+package threading
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockContextTask struct {
+	BaseTask
+	ctx     context.Context
+	process func(ctx context.Context)
+}
+
+func (m *mockContextTask) Context() context.Context       { return m.ctx }
+func (m *mockContextTask) Process()                       { m.ProcessCtx(m.ctx) }
+func (m *mockContextTask) ProcessCtx(ctx context.Context) { m.process(ctx) }
+
+func TestTaskDeadline(t *testing.T) {
+	wp := NewWorkerPool(0, 1, 16)
+	defer wp.Shutdown()
+
+	// a task ignoring cancellation is left behind once its deadline is exceeded
+	release := make(chan struct{})
+	defer close(release)
+	stuck := newMockPriorityTask("stuck", PriorityNormal, func(string) { <-release })
+	stuck.Timeout = 50 * time.Millisecond
+	wp.Submit(stuck)
+	if err := stuck.Wait(time.Second); !errors.Is(err, ErrTaskTimeout) {
+		t.Fatalf("task exceeding its deadline is expected to fail with a timeout error, but got %v", err)
+	}
+
+	// the in-flight work of a context task is canceled
+	canceled := make(chan error, 1)
+	ctxTask := &mockContextTask{
+		BaseTask: BaseTask{ID: "ctx", Timeout: 50 * time.Millisecond},
+		ctx:      context.Background(),
+		process: func(ctx context.Context) {
+			<-ctx.Done()
+			canceled <- ctx.Err()
+		},
+	}
+	wp.Submit(ctxTask)
+	select {
+	case err := <-canceled:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("context of task is expected to exceed its deadline, but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("context of task exceeding its deadline is expected to be done")
+	}
+
+	// the worker is freed for other tasks
+	var wg sync.WaitGroup
+	wg.Add(1)
+	next := NewMockTerminateTask("next", &wg)
+	wp.Submit(next)
+	if err := next.Wait(time.Second); err != nil {
+		t.Fatalf("task submitted after a timed out one is expected to succeed, but got %v", err)
+	}
+}
+
+func TestPoolTaskTimeout(t *testing.T) {
+	wp := NewWorkerPool(0, 1, 16, WithTaskTimeout(50*time.Millisecond))
+	defer wp.Shutdown()
+
+	release := make(chan struct{})
+	defer close(release)
+	task := newMockPriorityTask("stuck", PriorityNormal, func(string) { <-release })
+	wp.Submit(task)
+	if err := task.Wait(time.Second); !errors.Is(err, ErrTaskTimeout) {
+		t.Fatalf("task is expected to be bounded by the timeout of the pool, but got %v", err)
+	}
+}
+
+func TestTaskWait(t *testing.T) {
+	task := newMockPriorityTask("task", PriorityNormal, func(string) {})
+	if err := task.Wait(10 * time.Millisecond); err != ErrProcessTimeout {
+		t.Fatalf("waiting for a pending task is expected to time out, but got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := task.WaitCtx(ctx); err != context.Canceled {
+		t.Fatalf("waiting with a canceled context is expected to fail, but got %v", err)
+	}
+
+	if !task.Cancel() {
+		t.Fatal("pending task is expected to be canceled")
+	}
+	if err := task.Wait(time.Second); err != ErrTaskCanceled {
+		t.Fatalf("canceled task is expected to be done with a cancellation error, but got %v", err)
+	}
+	if task.Finish(nil) {
+		t.Fatal("canceled task is expected not to be finished again")
+	}
+}
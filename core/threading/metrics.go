@@ -0,0 +1,58 @@
+package threading
+
+import (
+	"time"
+
+	"github.com/world-in-progress/yggdrasil/core/metrics"
+)
+
+// poolMetrics records latencies of the tasks of a pool. A zero value records nothing.
+type poolMetrics struct {
+	wait       *metrics.HistogramVec
+	run        *metrics.HistogramVec
+	pool       string
+	unregister func()
+}
+
+// WithMetrics records metrics of the pool in a registry, labeled by the pool name:
+// queue depth by priority, active and idle workers, and wait and run latencies of tasks.
+// They are removed from the registry once the pool is shut down.
+func WithMetrics(r *metrics.Registry, name string) PoolOption {
+	return func(wp *WorkerPool) {
+		wp.metrics = &poolMetrics{
+			wait: r.Histogram("yggdrasil_workerpool_task_wait_seconds", "Time tasks wait in queue for a worker.", nil, "pool", "priority"),
+			run:  r.Histogram("yggdrasil_workerpool_task_run_seconds", "Time workers take to process tasks.", nil, "pool", "priority"),
+			pool: name,
+		}
+
+		depth := r.Gauge("yggdrasil_workerpool_queue_depth", "Tasks waiting for a worker.", "pool", "priority")
+		for _, priority := range []Priority{PriorityLow, PriorityNormal, PriorityHigh} {
+			depth.Func(func() float64 { return float64(wp.GetQueueDepth(priority)) }, name, priority.String())
+		}
+		active := r.Gauge("yggdrasil_workerpool_active_workers", "Workers processing a task.", "pool")
+		active.Func(func() float64 { return float64(wp.GetActiveWorkerCount()) }, name)
+		idle := r.Gauge("yggdrasil_workerpool_idle_workers", "Workers waiting for a task.", "pool")
+		idle.Func(func() float64 { return float64(max(0, wp.GetWorkerCount()-wp.GetActiveWorkerCount())) }, name)
+
+		wait, run := wp.metrics.wait, wp.metrics.run
+		wp.metrics.unregister = func() {
+			wait.DeleteMatching("pool", name)
+			run.DeleteMatching("pool", name)
+			depth.DeleteMatching("pool", name)
+			active.Delete(name)
+			idle.Delete(name)
+		}
+	}
+}
+
+func (m *poolMetrics) observeWait(priority Priority, d time.Duration) {
+	if m.wait != nil {
+		m.wait.With(m.pool, priority.String()).Observe(d.Seconds())
+	}
+}
+
+func (m *poolMetrics) observeRun(priority Priority, d time.Duration) {
+	if m.run != nil {
+		m.run.With(m.pool, priority.String()).Observe(d.Seconds())
+	}
+}
@@ -0,0 +1,54 @@
+package threading
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/world-in-progress/yggdrasil/core/metrics"
+)
+
+func TestPoolMetrics(t *testing.T) {
+	r := metrics.NewRegistry()
+	wp := NewWorkerPool(1, 2, 16, WithMetrics(r, "test"))
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	for _, priority := range []Priority{PriorityLow, PriorityHigh, PriorityHigh} {
+		wp.Submit(newMockPriorityTask("task", priority, func(string) { wg.Done() }))
+	}
+	wg.Wait()
+
+	// run latency is recorded once tasks return
+	for deadline := time.Now().Add(time.Second); wp.GetActiveWorkerCount() > 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+
+	var sb strings.Builder
+	if err := r.WriteText(&sb); err != nil {
+		t.Fatal(err)
+	}
+	text := sb.String()
+	for _, line := range []string{
+		`yggdrasil_workerpool_queue_depth{pool="test",priority="normal"} 0`,
+		`yggdrasil_workerpool_task_wait_seconds_count{pool="test",priority="high"} 2`,
+		`yggdrasil_workerpool_task_run_seconds_count{pool="test",priority="low"} 1`,
+		`yggdrasil_workerpool_active_workers{pool="test"}`,
+		`yggdrasil_workerpool_idle_workers{pool="test"}`,
+	} {
+		if !strings.Contains(text, line) {
+			t.Fatalf("metrics are expected to contain %s, but are\n%s", line, text)
+		}
+	}
+
+	// metrics of the pool are removed once it is shut down
+	wp.Shutdown()
+	sb.Reset()
+	if err := r.WriteText(&sb); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sb.String(), `pool="test"`) {
+		t.Fatalf("metrics of a shut down pool are not expected to be left, but are\n%s", sb.String())
+	}
+}
@@ -0,0 +1,300 @@
+package threading
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/world-in-progress/yggdrasil/core/structure"
+)
+
+const (
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	PriorityHigh
+
+	classNum = 3
+
+	// defaultAgingInterval is the waiting time raising a queued task by one priority class.
+	defaultAgingInterval = time.Second
+)
+
+type (
+	// Priority of a task. Tasks of higher priority are scheduled first.
+	// Priorities above PriorityHigh or below PriorityLow are clamped to them.
+	Priority int
+
+	// IPriorityTask is the interface for a task declaring its priority.
+	// Tasks not implementing it are scheduled with PriorityNormal.
+	IPriorityTask interface {
+		GetPriority() Priority
+	}
+
+	// PoolOption configures a WorkerPool.
+	PoolOption func(*WorkerPool)
+
+	// priorityClass is the queue and the concurrency limit of tasks of a priority.
+	priorityClass struct {
+		depth     int
+		maxActive int
+		active    atomic.Int32
+		queue     chan *scheduledTask
+		// ring replaces queue if the pool buffers tasks in ring buffers, see WithRingBuffer
+		ring   *structure.RingBuffer[*scheduledTask]
+		queued chan struct{}
+	}
+
+	// scheduledTask wraps a task queued in a priority class,
+	// releasing its class slot once processed, canceled or not.
+	scheduledTask struct {
+		ITask
+		class    *priorityClass
+		priority Priority
+		enqueued time.Time
+		pool     *WorkerPool
+	}
+)
+
+// WithPriorityClass limits the number of workers concurrently processing tasks of a priority,
+// and the number of tasks of the priority queued before submission blocks.
+// Zero maxWorkerNum means no limit other than the pool size, zero queueDepth keeps the pool buffer size.
+func WithPriorityClass(priority Priority, maxWorkerNum int, queueDepth int) PoolOption {
+	return func(wp *WorkerPool) {
+		class := wp.classes[classIndex(priority)]
+		class.maxActive = maxWorkerNum
+		if queueDepth > 0 {
+			class.depth = queueDepth
+		}
+	}
+}
+
+// WithAgingInterval sets the waiting time raising a queued task by one priority class,
+// so that lower priorities are not starved by a steady flow of higher ones. Zero disables aging.
+func WithAgingInterval(interval time.Duration) PoolOption {
+	return func(wp *WorkerPool) {
+		wp.agingInterval = interval
+	}
+}
+
+// WithRingBuffer buffers queued tasks of each priority class in a lock-free ring buffer instead of a channel,
+// which suits many goroutines submitting tasks concurrently. A zero queue depth is a depth of one.
+func WithRingBuffer() PoolOption {
+	return func(wp *WorkerPool) {
+		wp.ringBuffer = true
+	}
+}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	}
+	return strconv.Itoa(int(p))
+}
+
+// GetPriority returns the priority of the task.
+func (bt *BaseTask) GetPriority() Priority { return bt.Priority }
+
+func priorityOf(task ITask) Priority {
+	if t, ok := task.(IPriorityTask); ok {
+		return t.GetPriority()
+	}
+	return PriorityNormal
+}
+
+func classIndex(priority Priority) int {
+	return int(max(PriorityLow, min(PriorityHigh, priority)) - PriorityLow)
+}
+
+func (st *scheduledTask) IsIgnoreable() bool {
+	// Always processed by workers to release the class slot
+	return false
+}
+
+func (st *scheduledTask) Process() {
+	defer st.release()
+	if st.ITask.IsIgnoreable() {
+		return
+	}
+
+	wp := st.pool
+	wp.active.Add(1)
+	defer wp.active.Add(-1)
+
+	start := time.Now()
+	wp.metrics.observeWait(st.priority, start.Sub(st.enqueued))
+	wp.process(st.ITask)
+	wp.metrics.observeRun(st.priority, time.Since(start))
+}
+
+func (st *scheduledTask) release() {
+	st.class.active.Add(-1)
+	select {
+	case st.pool.released <- struct{}{}:
+	default:
+	}
+}
+
+// available checks if a worker can be spared for the class.
+func (pc *priorityClass) available() bool {
+	return pc.maxActive <= 0 || int(pc.active.Load()) < pc.maxActive
+}
+
+// enqueue queues a task, waiting for room until ctx is done.
+func (pc *priorityClass) enqueue(ctx context.Context, task *scheduledTask) error {
+	if pc.ring != nil {
+		if err := pc.ring.PushWait(ctx, task); err != nil {
+			return err
+		}
+		select {
+		case pc.queued <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+
+	// Prefer queueing if there is room, even if ctx is done
+	select {
+	case pc.queue <- task:
+		return nil
+	default:
+	}
+	select {
+	case pc.queue <- task:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// dequeue takes the oldest queued task without waiting.
+func (pc *priorityClass) dequeue() (*scheduledTask, bool) {
+	if pc.ring != nil {
+		return pc.ring.Pop()
+	}
+	select {
+	case task, ok := <-pc.queue:
+		return task, ok
+	default:
+		return nil, false
+	}
+}
+
+// length counts queued tasks.
+func (pc *priorityClass) length() int {
+	if pc.ring != nil {
+		return int(pc.ring.Len())
+	}
+	return len(pc.queue)
+}
+
+// score is the priority of a queued task raised by the time it has waited.
+func (wp *WorkerPool) score(task *scheduledTask, now time.Time) float64 {
+	score := float64(task.priority)
+	if wp.agingInterval > 0 {
+		score += float64(now.Sub(task.enqueued)) / float64(wp.agingInterval)
+	}
+	return score
+}
+
+// schedule hands queued tasks to workers, choosing among the heads of priority classes
+// the available one with the highest score, until the pool is shut down.
+func (wp *WorkerPool) schedule() {
+	defer close(wp.stopped)
+
+	var heads [classNum]*scheduledTask
+	defer func() {
+		for _, head := range heads {
+			if head != nil {
+				head.ITask.Cancel()
+			}
+		}
+	}()
+
+	// receive returns the queue of a class if its head is empty
+	receive := func(index int) chan *scheduledTask {
+		if heads[index] != nil {
+			return nil
+		}
+		return wp.classes[index].queue
+	}
+	// notify returns the channel notified of tasks queued in the ring buffer of a class if its head is empty
+	notify := func(index int) chan struct{} {
+		if heads[index] != nil {
+			return nil
+		}
+		return wp.classes[index].queued
+	}
+
+	for {
+		// Fill empty heads
+		for i, class := range wp.classes {
+			for heads[i] == nil {
+				task, ok := class.dequeue()
+				if !ok {
+					break
+				}
+				if !task.ITask.IsIgnoreable() {
+					heads[i] = task
+				}
+			}
+		}
+
+		// Pick the available head of the highest score
+		picked := -1
+		now := time.Now()
+		for i := len(heads) - 1; i >= 0; i-- {
+			if heads[i] == nil || !wp.classes[i].available() {
+				continue
+			}
+			if picked == -1 || wp.score(heads[i], now) > wp.score(heads[picked], now) {
+				picked = i
+			}
+		}
+
+		var task *scheduledTask
+		var tasks chan ITask
+		var tokens chan struct{}
+		if picked != -1 {
+			task = heads[picked]
+			tasks, tokens = wp.tasks, wp.tokens
+			task.class.active.Add(1)
+		}
+
+		// Hand the picked task to a worker, or wait for more tasks and released slots
+		select {
+		case tasks <- task:
+			heads[picked] = nil
+			continue
+		case tokens <- struct{}{}:
+			heads[picked] = nil
+			NewWorker(wp.tasks, wp.tokens, task)
+			continue
+		case head := <-receive(0):
+			heads[0] = head
+		case head := <-receive(1):
+			heads[1] = head
+		case head := <-receive(2):
+			heads[2] = head
+		case <-notify(0):
+		case <-notify(1):
+		case <-notify(2):
+		case <-wp.released:
+		case <-wp.quit:
+		}
+		if task != nil {
+			task.class.active.Add(-1)
+		}
+
+		select {
+		case <-wp.quit:
+			return
+		default:
+		}
+	}
+}
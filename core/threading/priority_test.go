@@ -0,0 +1,196 @@
+package threading
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type mockPriorityTask struct {
+	BaseTask
+	process func(id string)
+}
+
+func newMockPriorityTask(id string, priority Priority, process func(id string)) *mockPriorityTask {
+	return &mockPriorityTask{
+		BaseTask: BaseTask{
+			ID:       id,
+			Priority: priority,
+		},
+		process: process,
+	}
+}
+
+func (m *mockPriorityTask) Process() {
+	m.process(m.ID)
+}
+
+// recorder records the order tasks are processed in.
+type recorder struct {
+	mu    sync.Mutex
+	wg    sync.WaitGroup
+	order []string
+}
+
+// block submits a task occupying a worker until gate is closed, and waits for it to be processed.
+func (r *recorder) block(wp *WorkerPool, gate chan struct{}) {
+	started := make(chan struct{})
+	wp.Submit(newMockPriorityTask("blocker", PriorityNormal, func(id string) {
+		close(started)
+		<-gate
+		r.record(id)
+	}))
+	<-started
+}
+
+func (r *recorder) record(id string) {
+	r.mu.Lock()
+	r.order = append(r.order, id)
+	r.mu.Unlock()
+	r.wg.Done()
+}
+
+func TestPriorityScheduling(t *testing.T) {
+	wp := NewWorkerPool(0, 1, 16, WithAgingInterval(0))
+	defer wp.Shutdown()
+
+	r := &recorder{}
+	r.wg.Add(5)
+
+	// occupy the only worker until all other tasks are queued
+	gate := make(chan struct{})
+	r.block(wp, gate)
+	wp.Submit(newMockPriorityTask("low", PriorityLow, r.record))
+	wp.Submit(newMockPriorityTask("normal", PriorityNormal, r.record))
+	wp.Submit(newMockPriorityTask("high", PriorityHigh+10, r.record))
+	wp.Submit(NewMockTerminateTask("unprioritized", &r.wg))
+	time.Sleep(10 * time.Millisecond)
+	close(gate)
+	r.wg.Wait()
+
+	expected := []string{"blocker", "high", "normal", "low"}
+	for i, id := range expected {
+		if r.order[i] != id {
+			t.Fatalf("tasks are expected to be processed in order %v, but are processed in order %v", expected, r.order)
+		}
+	}
+}
+
+func TestPriorityAging(t *testing.T) {
+	wp := NewWorkerPool(0, 1, 16, WithAgingInterval(time.Millisecond))
+	defer wp.Shutdown()
+
+	r := &recorder{}
+	r.wg.Add(3)
+
+	gate := make(chan struct{})
+	r.block(wp, gate)
+	wp.Submit(newMockPriorityTask("low", PriorityLow, r.record))
+	time.Sleep(20 * time.Millisecond)
+	wp.Submit(newMockPriorityTask("high", PriorityHigh, r.record))
+	time.Sleep(10 * time.Millisecond)
+	close(gate)
+	r.wg.Wait()
+
+	if r.order[1] != "low" {
+		t.Fatalf("low priority task waiting long enough is expected to be processed first, but order is %v", r.order)
+	}
+}
+
+func TestPriorityClassLimits(t *testing.T) {
+	wp := NewWorkerPool(0, 4, 16, WithPriorityClass(PriorityLow, 1, 1))
+	defer wp.Shutdown()
+
+	var active, maxActive atomic.Int32
+	r := &recorder{}
+	gate := make(chan struct{})
+	lowTask := func(id string) ITask {
+		return newMockPriorityTask(id, PriorityLow, func(id string) {
+			if n := active.Add(1); n > maxActive.Load() {
+				maxActive.Store(n)
+			}
+			<-gate
+			active.Add(-1)
+			r.record(id)
+		})
+	}
+
+	// one low task runs, one waits as head of the class and one is queued
+	r.wg.Add(4)
+	for _, id := range []string{"low-0", "low-1", "low-2"} {
+		if _, err := wp.SubmitTimeout(time.Second, lowTask(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := wp.SubmitTimeout(50*time.Millisecond, lowTask("low-3")); err != ErrProcessTimeout {
+		t.Fatalf("submission to a full class queue is expected to time out, but got %v", err)
+	}
+
+	// other classes are not limited by the low one
+	done := make(chan struct{})
+	wp.Submit(newMockPriorityTask("high", PriorityHigh, func(id string) { close(done) }))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("high priority task is expected to be processed while low priority tasks are limited")
+	}
+
+	close(gate)
+	r.wg.Add(-1)
+	r.wg.Wait()
+	if maxActive.Load() != 1 {
+		t.Fatalf("at most 1 low priority task is expected to be processed concurrently, but got %d", maxActive.Load())
+	}
+}
+
+func TestRingBufferPool(t *testing.T) {
+	wp := NewWorkerPool(0, 1, 1, WithAgingInterval(0), WithRingBuffer())
+	defer wp.Shutdown()
+
+	r := &recorder{}
+	r.wg.Add(4)
+
+	gate := make(chan struct{})
+	r.block(wp, gate)
+	wp.Submit(newMockPriorityTask("low", PriorityLow, r.record))
+	wp.Submit(newMockPriorityTask("high", PriorityHigh, r.record))
+	time.Sleep(10 * time.Millisecond)
+
+	// the scheduler holds the first low priority task, and the queue of one is full with the second
+	wp.Submit(newMockPriorityTask("low2", PriorityLow, r.record))
+	if depth := wp.GetQueueDepth(PriorityLow); depth != 1 {
+		t.Fatalf("queue depth of low priority is expected to be 1, but got %v", depth)
+	}
+	if _, err := wp.SubmitTimeout(10*time.Millisecond, newMockPriorityTask("rejected", PriorityLow, r.record)); err != ErrProcessTimeout {
+		t.Fatalf("submission to a full queue is expected to time out, but got %v", err)
+	}
+	close(gate)
+	r.wg.Wait()
+
+	expected := []string{"blocker", "high", "low", "low2"}
+	for i, id := range expected {
+		if r.order[i] != id {
+			t.Fatalf("tasks are expected to be processed in order %v, but are processed in order %v", expected, r.order)
+		}
+	}
+
+	// tasks submitted concurrently are all processed
+	var processed atomic.Int32
+	var wg sync.WaitGroup
+	wg.Add(400)
+	for range 4 {
+		go func() {
+			for range 100 {
+				wp.Submit(newMockPriorityTask("task", PriorityNormal, func(string) {
+					processed.Add(1)
+					wg.Done()
+				}))
+			}
+		}()
+	}
+	wg.Wait()
+	if processed.Load() != 400 {
+		t.Fatalf("400 tasks are expected to be processed, but got %v", processed.Load())
+	}
+}
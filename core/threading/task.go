@@ -1,31 +1,121 @@
 package threading
 
 import (
+	"context"
+	"fmt"
+	"sync"
 	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrTaskTimeout is the error a task is completed with when its processing exceeds its deadline.
+	ErrTaskTimeout = fmt.Errorf("task error: deadline exceeded")
+
+	// ErrTaskCanceled is the error a task is completed with when it is canceled before being processed.
+	ErrTaskCanceled = fmt.Errorf("task error: canceled")
 )
 
 type (
 	// BaseTask is the basic structure for a Task interface.
 	BaseTask struct {
-		ID        string
+		ID       string
+		Priority Priority
+		// Timeout bounds the processing time of the task, zero falls back to the timeout of the pool.
+		Timeout   time.Duration
 		done      atomic.Bool
 		cancelled atomic.Bool
+
+		mu       sync.Mutex
+		finished chan struct{}
+		err      error
 	}
 
 	// TaskCancelFunc is used to cancel the execution of a task. Return false if task has been done.
 	TaskCancelFunc func() bool
+
+	// ITimeoutTask is the interface for a task bounding its processing time.
+	ITimeoutTask interface {
+		GetTimeout() time.Duration
+	}
+
+	// IContextTask is the interface for a task processed with a context.
+	// The context handed to ProcessCtx derives from Context and is done once the deadline of the task is exceeded,
+	// so that in-flight work bound to it, such as http requests or commands, is canceled.
+	IContextTask interface {
+		Context() context.Context
+		ProcessCtx(ctx context.Context)
+	}
+
+	// IFinishableTask is the interface for a task completed with an error,
+	// used by WorkerPool to complete a task exceeding its deadline.
+	IFinishableTask interface {
+		Finish(err error) bool
+	}
 )
 
-func (bt *BaseTask) GetID() string      { return bt.ID }
-func (bt *BaseTask) Complete()          { bt.done.Store(true) }
-func (bt *BaseTask) IsCompleted() bool  { return bt.done.Load() }
-func (bt *BaseTask) IsCanceled() bool   { return bt.cancelled.Load() }
-func (bt *BaseTask) IsIgnoreable() bool { return bt.cancelled.Load() || bt.done.Load() }
-func (bt *BaseTask) Cancel() bool {
-	if !bt.done.Load() {
-		bt.done.Store(true)
-		bt.cancelled.Store(true)
-		return true
-	}
-	return false
+func (bt *BaseTask) GetID() string             { return bt.ID }
+func (bt *BaseTask) GetTimeout() time.Duration { return bt.Timeout }
+func (bt *BaseTask) Complete()                 { bt.finish(nil, false) }
+func (bt *BaseTask) IsCompleted() bool         { return bt.done.Load() }
+func (bt *BaseTask) IsCanceled() bool          { return bt.cancelled.Load() }
+func (bt *BaseTask) IsIgnoreable() bool        { return bt.cancelled.Load() || bt.done.Load() }
+func (bt *BaseTask) Cancel() bool              { return bt.finish(ErrTaskCanceled, true) }
+func (bt *BaseTask) Finish(err error) bool     { return bt.finish(err, false) }
+func (bt *BaseTask) Done() <-chan struct{}     { return bt.doneChan() }
+
+// Err returns the error the task is completed with, nil if it is not done or succeeded.
+func (bt *BaseTask) Err() error {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	return bt.err
+}
+
+// Wait waits for the task to be done for at most timeout, and returns the error it is completed with.
+// ErrProcessTimeout is returned if the task is not done in time.
+func (bt *BaseTask) Wait(timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-bt.doneChan():
+		return bt.Err()
+	case <-timer.C:
+		return ErrProcessTimeout
+	}
+}
+
+// WaitCtx waits for the task to be done until ctx is done, and returns the error it is completed with.
+func (bt *BaseTask) WaitCtx(ctx context.Context) error {
+	select {
+	case <-bt.doneChan():
+		return bt.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (bt *BaseTask) doneChan() chan struct{} {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	if bt.finished == nil {
+		bt.finished = make(chan struct{})
+	}
+	return bt.finished
+}
+
+// finish completes the task once, returning false if it has been done.
+func (bt *BaseTask) finish(err error, cancelled bool) bool {
+	finished := bt.doneChan()
+
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	if bt.done.Load() {
+		return false
+	}
+	bt.err = err
+	bt.cancelled.Store(cancelled)
+	bt.done.Store(true)
+	close(finished)
+	return true
 }
@@ -1,8 +1,9 @@
 package threading
 
 import (
-	"fmt"
 	"time"
+
+	"github.com/world-in-progress/yggdrasil/core/logger"
 )
 
 type Worker struct {
@@ -25,7 +26,7 @@ func NewWorker(taskChan chan ITask, tokenChan chan struct{}, firstEntry ITask) *
 		defer timer.Stop()
 
 		if firstEntry != nil && !firstEntry.IsIgnoreable() {
-			firstEntry.Process()
+			RunSafe(firstEntry.Process) // keep worker alive if task panics
 			firstEntry.Complete()
 			firstEntry = nil // cut off reference
 		}
@@ -53,10 +54,10 @@ func NewWorker(taskChan chan ITask, tokenChan chan struct{}, firstEntry ITask) *
 
 func (w *Worker) processTask(task ITask) {
 	if task.IsIgnoreable() {
-		fmt.Printf("Task (ID: %s) has been canceled or done\n", task.GetID())
+		logger.With(logger.Fields{logger.TaskField: task.GetID()}).Debug("Task has been canceled or done")
 		return
 	}
-	task.Process()
+	RunSafe(task.Process) // keep worker alive if task panics
 	task.Complete()
 	w.lastActive = time.Now()
 }
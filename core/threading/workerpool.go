@@ -1,9 +1,14 @@
 package threading
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/world-in-progress/yggdrasil/core/structure"
 )
 
 // ErrProcessTimeout returned by WorkerPool to indicate that there no free goroutines during some period of time.
@@ -21,37 +26,82 @@ type (
 		IsIgnoreable() bool
 	}
 
+	// WorkerPool processes tasks with a number of workers growing on demand up to a maximum.
+	// Queued tasks are scheduled by priority, see IPriorityTask and WithPriorityClass.
+	// Processing of tasks is bounded by their deadline, see ITimeoutTask, IContextTask and WithTaskTimeout.
 	WorkerPool struct {
-		minWorkerNum int
-		tasks        chan ITask
-		tokens       chan struct{}
-		mu           sync.RWMutex
+		minWorkerNum  int
+		tasks         chan ITask
+		tokens        chan struct{}
+		classes       [classNum]*priorityClass
+		agingInterval time.Duration
+		taskTimeout   time.Duration
+		ringBuffer    bool
+		active        atomic.Int32
+		metrics       *poolMetrics
+		released      chan struct{}
+		quit          chan struct{}
+		stopped       chan struct{}
+		mu            sync.RWMutex
 	}
 )
 
-func NewWorkerPool(minWorkerNum int, maxWorkerNum int, bufferSize int) *WorkerPool {
+func NewWorkerPool(minWorkerNum int, maxWorkerNum int, bufferSize int, opts ...PoolOption) *WorkerPool {
 
 	wp := &WorkerPool{
-		minWorkerNum: minWorkerNum,
-		tasks:        make(chan ITask, bufferSize),
-		tokens:       make(chan struct{}, maxWorkerNum),
+		minWorkerNum:  minWorkerNum,
+		tasks:         make(chan ITask),
+		tokens:        make(chan struct{}, maxWorkerNum),
+		agingInterval: defaultAgingInterval,
+		metrics:       &poolMetrics{},
+		released:      make(chan struct{}, 1),
+		quit:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	for i := range wp.classes {
+		wp.classes[i] = &priorityClass{depth: bufferSize}
+	}
+
+	for _, opt := range opts {
+		opt(wp)
+	}
+	for _, class := range wp.classes {
+		if wp.ringBuffer {
+			class.ring = structure.NewRingBuffer[*scheduledTask](class.depth)
+			class.queued = make(chan struct{}, 1)
+		} else {
+			class.queue = make(chan *scheduledTask, class.depth)
+		}
 	}
 
 	for range minWorkerNum {
 		wp.tokens <- struct{}{}
 		NewWorker(wp.tasks, wp.tokens, nil)
 	}
+	GoSafe(wp.schedule)
 	return wp
 }
 
 func (wp *WorkerPool) Shutdown() {
-	close(wp.tasks)
+	close(wp.quit)
+	<-wp.stopped
 
-	for task := range wp.tasks {
-		task.Cancel()
+	for _, class := range wp.classes {
+		if class.queue != nil {
+			close(class.queue)
+		}
+		for task, ok := class.dequeue(); ok; task, ok = class.dequeue() {
+			task.ITask.Cancel()
+		}
 	}
 
+	close(wp.tasks)
+
 	close(wp.tokens)
+
+	if wp.metrics.unregister != nil {
+		wp.metrics.unregister()
+	}
 }
 
 func (wp *WorkerPool) GetWorkerCount() int {
@@ -60,26 +110,49 @@ func (wp *WorkerPool) GetWorkerCount() int {
 	return len(wp.tokens)
 }
 
+// GetActiveWorkerCount counts workers processing a task.
+func (wp *WorkerPool) GetActiveWorkerCount() int {
+	return int(wp.active.Load())
+}
+
+// GetQueueDepth counts tasks of a priority waiting for a worker.
+func (wp *WorkerPool) GetQueueDepth(priority Priority) int {
+	return wp.classes[classIndex(priority)].length()
+}
+
 func (wp *WorkerPool) Submit(task ITask) (TaskCancelFunc, error) {
-	return wp.dispatch(task, nil)
+	return wp.dispatchCtx(context.Background(), task)
 }
 
 func (wp *WorkerPool) SubmitTimeout(timeout time.Duration, task ITask) (TaskCancelFunc, error) {
-	return wp.dispatch(task, time.After(timeout))
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cancelFunc, err := wp.dispatchCtx(ctx, task)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, ErrProcessTimeout
+	}
+	return cancelFunc, err
 }
 
-func (wp *WorkerPool) dispatch(task ITask, timeout <-chan time.Time) (TaskCancelFunc, error) {
-	if timeout == nil {
-		timeout = make(chan time.Time)
+// SubmitCtx submits a task, giving up with the error of ctx if ctx is done before the task is accepted.
+func (wp *WorkerPool) SubmitCtx(ctx context.Context, task ITask) (TaskCancelFunc, error) {
+	return wp.dispatchCtx(ctx, task)
+}
+
+func (wp *WorkerPool) dispatchCtx(ctx context.Context, task ITask) (TaskCancelFunc, error) {
+	priority := max(PriorityLow, min(PriorityHigh, priorityOf(task)))
+	class := wp.classes[classIndex(priority)]
+	scheduled := &scheduledTask{
+		ITask:    task,
+		class:    class,
+		priority: priority,
+		enqueued: time.Now(),
+		pool:     wp,
 	}
 
-	select {
-	case <-timeout:
-		return nil, ErrProcessTimeout
-	case wp.tasks <- task:
-		return task.Cancel, nil
-	case wp.tokens <- struct{}{}:
-		NewWorker(wp.tasks, wp.tokens, task)
-		return task.Cancel, nil
+	if err := class.enqueue(ctx, scheduled); err != nil {
+		return nil, err
 	}
+	return task.Cancel, nil
 }
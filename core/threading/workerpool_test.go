@@ -99,3 +99,26 @@ func NewMockTerminateTask(id string, wg *sync.WaitGroup) *mockTerminateTask {
 func (m *mockTerminateTask) Process() {
 	m.wg.Done()
 }
+
+func TestWorkerPanic(t *testing.T) {
+	wp := NewWorkerPool(0, 1, 16)
+	defer wp.Shutdown()
+
+	// the only worker is expected to survive a panicking task
+	wp.Submit(newMockPriorityTask("panic", PriorityNormal, func(id string) { panic(id) }))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	wp.Submit(NewMockTerminateTask("next", &wg))
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("task submitted after a panicking one is expected to be processed")
+	}
+}
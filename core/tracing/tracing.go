@@ -0,0 +1,52 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the tracer spans of yggdrasil are created by.
+// Spans are exported through the global tracer provider set by otel.SetTracerProvider.
+const TracerName = "github.com/world-in-progress/yggdrasil"
+
+// TaskIDKey is the attribute linking spans of the stages of a task.
+const TaskIDKey = attribute.Key("yggdrasil.task.id")
+
+type taskIDKey struct{}
+
+// WithTaskID returns a copy of ctx carrying a task ID, which is set on every span started with it.
+func WithTaskID(ctx context.Context, taskID string) context.Context {
+	return context.WithValue(ctx, taskIDKey{}, taskID)
+}
+
+// TaskIDFromContext returns the task ID carried by ctx, or an empty string if there is none.
+func TaskIDFromContext(ctx context.Context) string {
+	taskID, _ := ctx.Value(taskIDKey{}).(string)
+	return taskID
+}
+
+// Start starts a span as a child of the span in ctx, attributed with the task ID carried by ctx.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if taskID := TaskIDFromContext(ctx); taskID != "" {
+		opts = append(opts, trace.WithAttributes(TaskIDKey.String(taskID)))
+	}
+	return otel.Tracer(TracerName).Start(ctx, name, opts...)
+}
+
+// RecordError records err in span and marks the span as failed, if err is not nil.
+func RecordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// End records err in span if it is not nil, then ends the span.
+func End(span trace.Span, err error) {
+	RecordError(span, err)
+	span.End()
+}
@@ -0,0 +1,465 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+
+	"github.com/google/uuid"
+	nodeinterface "github.com/world-in-progress/yggdrasil/node/interface"
+)
+
+// ErrNoDocuments is returned by ReadOne when no record matches the filter.
+var ErrNoDocuments = errors.New("memory: no documents in result")
+
+// MemoryRepository is an in-process repository keeping records in maps.
+// It follows the subset of MongoDB filter and update semantics used by this module,
+// so that trees, schema managers and component managers can run without a database.
+type MemoryRepository struct {
+	tables map[string][]map[string]any
+	mu     sync.RWMutex
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		tables: make(map[string][]map[string]any),
+	}
+}
+
+func (r *MemoryRepository) Create(ctx context.Context, table string, record map[string]any) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record = deepCopy(record).(map[string]any)
+	if _, ok := record["_id"]; !ok {
+		record["_id"] = uuid.New().String()
+	}
+	ID, ok := record["_id"].(string)
+	if !ok {
+		return "", fmt.Errorf("memory: _id of record must be a string")
+	}
+	for _, existing := range r.tables[table] {
+		if existing["_id"] == ID {
+			return "", fmt.Errorf("memory: duplicate key %s in table %s", ID, table)
+		}
+	}
+
+	r.tables[table] = append(r.tables[table], record)
+	return ID, nil
+}
+
+func (r *MemoryRepository) ReadOne(ctx context.Context, table string, filter map[string]any) (map[string]any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, record := range r.tables[table] {
+		if matches(record, filter) {
+			return deepCopy(record).(map[string]any), nil
+		}
+	}
+	return map[string]any{}, ErrNoDocuments
+}
+
+func (r *MemoryRepository) ReadAll(ctx context.Context, table string, filter map[string]any) ([]map[string]any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var results []map[string]any
+	for _, record := range r.tables[table] {
+		if matches(record, filter) {
+			results = append(results, deepCopy(record).(map[string]any))
+		}
+	}
+	return results, nil
+}
+
+func (r *MemoryRepository) Update(ctx context.Context, table string, filter map[string]any, update map[string]any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, record := range r.tables[table] {
+		if matches(record, filter) {
+			return applyUpdate(record, update)
+		}
+	}
+	return nil
+}
+
+// FindOneAndUpdate atomically updates the first record matching the filter and returns it as it is before or after
+// the update, or nil if no record matches.
+func (r *MemoryRepository) FindOneAndUpdate(ctx context.Context, table string, filter map[string]any, update map[string]any, returnDocument nodeinterface.ReturnDocument) (map[string]any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, record := range r.tables[table] {
+		if matches(record, filter) {
+			before := deepCopy(record).(map[string]any)
+			if err := applyUpdate(record, update); err != nil {
+				return nil, err
+			}
+			if returnDocument == nodeinterface.ReturnBefore {
+				return before, nil
+			}
+			return deepCopy(record).(map[string]any), nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *MemoryRepository) Delete(ctx context.Context, table string, filter map[string]any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	records := r.tables[table]
+	for i, record := range records {
+		if matches(record, filter) {
+			r.tables[table] = append(records[:i], records[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) Count(ctx context.Context, table string, filter map[string]any) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var count int64
+	for _, record := range r.tables[table] {
+		if matches(record, filter) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// matches reports whether a record satisfies a filter.
+// Supported operators are $eq, $ne, $lt, $lte, $gt, $gte, $in, $nin, $exists and $regex.
+func matches(record map[string]any, filter map[string]any) bool {
+	for key, cond := range filter {
+		value, exists := record[key]
+
+		ops, isOps := cond.(map[string]any)
+		if !isOps || !hasOperator(ops) {
+			if !exists || !equal(value, cond) {
+				return false
+			}
+			continue
+		}
+
+		for op, arg := range ops {
+			switch op {
+			case "$eq":
+				if !exists || !equal(value, arg) {
+					return false
+				}
+			case "$ne":
+				if exists && equal(value, arg) {
+					return false
+				}
+			case "$lt", "$lte", "$gt", "$gte":
+				if !exists || !compare(op, value, arg) {
+					return false
+				}
+			case "$in":
+				if !exists || !contains(arg, value) {
+					return false
+				}
+			case "$nin":
+				if exists && contains(arg, value) {
+					return false
+				}
+			case "$exists":
+				if want, _ := arg.(bool); want != exists {
+					return false
+				}
+			case "$regex":
+				pattern, _ := arg.(string)
+				s, ok := value.(string)
+				if !ok {
+					return false
+				}
+				if matched, err := regexp.MatchString(pattern, s); err != nil || !matched {
+					return false
+				}
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// applyUpdate applies an update document to a record in place.
+// Supported operators are $set, $unset, $push, $pull and $inc.
+func applyUpdate(record map[string]any, update map[string]any) error {
+	for op, argRaw := range update {
+		args, ok := argRaw.(map[string]any)
+		if !ok {
+			return fmt.Errorf("memory: argument of %s must be type of map[string]any", op)
+		}
+
+		switch op {
+		case "$set":
+			for key, value := range args {
+				record[key] = deepCopy(value)
+			}
+		case "$unset":
+			for key := range args {
+				delete(record, key)
+			}
+		case "$push":
+			for key, value := range args {
+				record[key] = appendValue(record[key], deepCopy(value))
+			}
+		case "$pull":
+			for key, value := range args {
+				record[key] = removeValue(record[key], value)
+			}
+		case "$inc":
+			for key, value := range args {
+				sum, err := addNumbers(record[key], value)
+				if err != nil {
+					return fmt.Errorf("memory: cannot increase %s: %v", key, err)
+				}
+				record[key] = sum
+			}
+		default:
+			return fmt.Errorf("memory: unsupported update operator %s", op)
+		}
+	}
+	return nil
+}
+
+func hasOperator(m map[string]any) bool {
+	for key := range m {
+		if len(key) > 0 && key[0] == '$' {
+			return true
+		}
+	}
+	return false
+}
+
+func equal(a, b any) bool {
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			return fa == fb
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compare compares numbers or strings by a comparison operator.
+func compare(op string, a, b any) bool {
+	var c int
+	ia, okIA := toInt(a)
+	ib, okIB := toInt(b)
+	fa, okA := toFloat(a)
+	fb, okB := toFloat(b)
+	sa, okSA := a.(string)
+	sb, okSB := b.(string)
+	switch {
+	case okIA && okIB:
+		// compared exactly, as timestamps in nanoseconds exceed the precision of float64
+		c = cmp.Compare(ia, ib)
+	case okA && okB:
+		c = cmp.Compare(fa, fb)
+	case okSA && okSB:
+		c = cmp.Compare(sa, sb)
+	default:
+		return false
+	}
+
+	switch op {
+	case "$lt":
+		return c < 0
+	case "$lte":
+		return c <= 0
+	case "$gt":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+func contains(list any, value any) bool {
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice {
+		return false
+	}
+	for i := range rv.Len() {
+		if equal(rv.Index(i).Interface(), value) {
+			return true
+		}
+	}
+	return false
+}
+
+func appendValue(list any, value any) any {
+	if list == nil {
+		return []any{value}
+	}
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice {
+		return []any{list, value}
+	}
+	vv := reflect.ValueOf(value)
+	if vv.IsValid() && vv.Type().AssignableTo(rv.Type().Elem()) {
+		return reflect.Append(rv, vv).Interface()
+	}
+	items := make([]any, 0, rv.Len()+1)
+	for i := range rv.Len() {
+		items = append(items, rv.Index(i).Interface())
+	}
+	return append(items, value)
+}
+
+func removeValue(list any, value any) any {
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice {
+		return list
+	}
+	kept := reflect.MakeSlice(rv.Type(), 0, rv.Len())
+	for i := range rv.Len() {
+		if item := rv.Index(i); !equal(item.Interface(), value) {
+			kept = reflect.Append(kept, item)
+		}
+	}
+	return kept.Interface()
+}
+
+func addNumbers(a, b any) (any, error) {
+	if a == nil {
+		return b, nil
+	}
+	switch x := a.(type) {
+	case int:
+		if y, ok := b.(int); ok {
+			return x + y, nil
+		}
+	case int64:
+		if y, ok := b.(int64); ok {
+			return x + y, nil
+		}
+	}
+	fa, okA := toFloat(a)
+	fb, okB := toFloat(b)
+	if !okA || !okB {
+		return nil, fmt.Errorf("operands %v and %v are not numbers", a, b)
+	}
+	return fa + fb, nil
+}
+
+func toInt(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	}
+	return 0, false
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+// deepCopy copies maps and slices recursively while keeping their concrete types,
+// so records handed out never alias the ones held by the repository.
+func deepCopy(v any) any {
+	if v == nil {
+		return nil
+	}
+	switch t := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(t))
+		for key, value := range t {
+			m[key] = deepCopy(value)
+		}
+		return m
+	case []any:
+		s := make([]any, len(t))
+		for i, value := range t {
+			s[i] = deepCopy(value)
+		}
+		return s
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice:
+		if rv.IsNil() {
+			return v
+		}
+		s := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		for i := range rv.Len() {
+			if copied := deepCopy(rv.Index(i).Interface()); copied != nil {
+				s.Index(i).Set(reflect.ValueOf(copied))
+			}
+		}
+		return s.Interface()
+	case reflect.Map:
+		if rv.IsNil() {
+			return v
+		}
+		m := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			value := reflect.Zero(rv.Type().Elem())
+			if copied := deepCopy(iter.Value().Interface()); copied != nil {
+				value = reflect.ValueOf(copied)
+			}
+			m.SetMapIndex(iter.Key(), value)
+		}
+		return m.Interface()
+	default:
+		return v
+	}
+}
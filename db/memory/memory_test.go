@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+
+	ID, err := repo.Create(ctx, "node", map[string]any{"name": "Node", "tags": []any{"a"}, "count": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Create(ctx, "node", map[string]any{"_id": ID}); err == nil {
+		t.Fatalf("creating a record of an existing ID is expected to fail")
+	}
+	if _, err := repo.Create(ctx, "node", map[string]any{"_id": "other", "name": "Other"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Records handed out do not alias the ones held
+	record, err := repo.ReadOne(ctx, "node", map[string]any{"_id": ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	record["tags"].([]any)[0] = "changed"
+	if record, _ := repo.ReadOne(ctx, "node", map[string]any{"_id": ID}); record["tags"].([]any)[0] != "a" {
+		t.Fatalf("held record is not expected to be changed through a copy")
+	}
+	if _, err := repo.ReadOne(ctx, "node", map[string]any{"_id": "missing"}); !errors.Is(err, ErrNoDocuments) {
+		t.Fatalf("reading a missing record is expected to fail by ErrNoDocuments, but got %v", err)
+	}
+
+	// Filter operators
+	for _, test := range []struct {
+		filter map[string]any
+		count  int64
+	}{
+		{map[string]any{"_id": map[string]any{"$in": []string{ID, "missing"}}}, 1},
+		{map[string]any{"_id": map[string]any{"$nin": []any{ID}}}, 1},
+		{map[string]any{"name": map[string]any{"$ne": "Node"}}, 1},
+		{map[string]any{"tags": map[string]any{"$exists": true}}, 1},
+		{map[string]any{"name": map[string]any{"$regex": "^O"}}, 1},
+		{map[string]any{}, 2},
+	} {
+		if count, err := repo.Count(ctx, "node", test.filter); err != nil || count != test.count {
+			t.Fatalf("%v records are expected to match %v, but got %v, %v", test.count, test.filter, count, err)
+		}
+	}
+
+	// Update operators
+	err = repo.Update(ctx, "node", map[string]any{"_id": ID}, map[string]any{
+		"$set":  map[string]any{"name": "Updated"},
+		"$push": map[string]any{"tags": "b"},
+		"$inc":  map[string]any{"count": 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Update(ctx, "node", map[string]any{"_id": ID}, map[string]any{"$pull": map[string]any{"tags": "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	record, _ = repo.ReadOne(ctx, "node", map[string]any{"_id": ID})
+	if record["name"] != "Updated" || len(record["tags"].([]any)) != 1 || record["tags"].([]any)[0] != "b" || record["count"] != 3 {
+		t.Fatalf("record is not expected: %v", record)
+	}
+
+	if err := repo.Delete(ctx, "node", map[string]any{"_id": ID}); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := repo.Count(ctx, "node", map[string]any{}); count != 1 {
+		t.Fatalf("1 record is expected to be left, but got %v", count)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := repo.ReadAll(canceled, "node", map[string]any{}); err == nil {
+		t.Fatalf("reading with a canceled context is expected to fail")
+	}
+}
@@ -0,0 +1,166 @@
+package mongo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/world-in-progress/yggdrasil/core/invalidation"
+	"github.com/world-in-progress/yggdrasil/core/logger"
+	"github.com/world-in-progress/yggdrasil/core/threading"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// invalidationTable is the collection invalidation events are published to.
+	invalidationTable = "invalidation"
+
+	// invalidationTTL is the time invalidation events are kept, allowing change streams to resume after a failure.
+	invalidationTTL = time.Hour
+
+	watchRetryInterval = time.Second
+)
+
+type (
+	// ChangeStreamBus is an invalidation bus shared by instances using one MongoDB database.
+	// Events are inserted into the collection "invalidation", and delivered by a change stream watching it,
+	// which requires MongoDB to run as a replica set.
+	ChangeStreamBus struct {
+		repo *MongoRepository
+
+		mu       sync.Mutex
+		handlers map[*invalidation.Handler]struct{}
+		cancel   context.CancelFunc
+	}
+
+	invalidationRecord struct {
+		ID        string    `bson:"_id"`
+		Source    string    `bson:"source"`
+		Table     string    `bson:"table"`
+		RecordID  string    `bson:"recordId"`
+		CreatedAt time.Time `bson:"createdAt"`
+	}
+)
+
+func NewChangeStreamBus(repo *MongoRepository) *ChangeStreamBus {
+	return &ChangeStreamBus{
+		repo:     repo,
+		handlers: make(map[*invalidation.Handler]struct{}),
+	}
+}
+
+// Publish inserts an event into the collection watched by subscribers.
+func (b *ChangeStreamBus) Publish(ctx context.Context, event invalidation.Event) error {
+	ctx, span := b.repo.startSpan(ctx, "insert", invalidationTable)
+	defer span.End()
+
+	timeoutCtx, cancel := b.repo.withTimeout(ctx)
+	defer cancel()
+
+	_, err := b.repo.getCollection(invalidationTable).InsertOne(timeoutCtx, invalidationRecord{
+		ID:        uuid.New().String(),
+		Source:    event.Source,
+		Table:     event.Table,
+		RecordID:  event.ID,
+		CreatedAt: time.Now(),
+	})
+	return err
+}
+
+// Subscribe runs handler for every event published from now on, until unsubscribe is called.
+// The change stream is opened by the first subscription and closed once no subscription is left.
+func (b *ChangeStreamBus) Subscribe(handler invalidation.Handler) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := &handler
+	b.handlers[key] = struct{}{}
+	if b.cancel == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		b.cancel = cancel
+		threading.GoSafe(func() { b.watch(ctx) })
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.handlers, key)
+			if len(b.handlers) == 0 && b.cancel != nil {
+				b.cancel()
+				b.cancel = nil
+			}
+		})
+	}
+}
+
+// watch delivers inserted events until ctx is done, resuming the change stream after failures.
+func (b *ChangeStreamBus) watch(ctx context.Context) {
+	coll := b.repo.getCollection(invalidationTable)
+	if _, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "createdAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(invalidationTTL.Seconds())),
+	}); err != nil {
+		logger.FromContext(ctx).WithError(err).Warn("Failed to index collection %s", invalidationTable)
+	}
+
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.D{{Key: "operationType", Value: "insert"}}}}}
+	var resumeToken bson.Raw
+	for ctx.Err() == nil {
+		opts := options.ChangeStream()
+		if resumeToken != nil {
+			opts.SetResumeAfter(resumeToken)
+		}
+		stream, err := coll.Watch(ctx, pipeline, opts)
+		if err != nil {
+			logger.FromContext(ctx).WithError(err).Error("Failed to watch collection %s", invalidationTable)
+			b.sleep(ctx)
+			continue
+		}
+
+		for stream.Next(ctx) {
+			resumeToken = stream.ResumeToken()
+			var change struct {
+				FullDocument invalidationRecord `bson:"fullDocument"`
+			}
+			if err := stream.Decode(&change); err != nil {
+				logger.FromContext(ctx).WithError(err).Warn("Failed to decode invalidation event")
+				continue
+			}
+			b.deliver(invalidation.Event{
+				Source: change.FullDocument.Source,
+				Table:  change.FullDocument.Table,
+				ID:     change.FullDocument.RecordID,
+			})
+		}
+		if err := stream.Err(); err != nil && ctx.Err() == nil {
+			logger.FromContext(ctx).WithError(err).Error("Change stream of collection %s failed", invalidationTable)
+			b.sleep(ctx)
+		}
+		stream.Close(context.Background())
+	}
+}
+
+func (b *ChangeStreamBus) deliver(event invalidation.Event) {
+	b.mu.Lock()
+	handlers := make([]invalidation.Handler, 0, len(b.handlers))
+	for handler := range b.handlers {
+		handlers = append(handlers, *handler)
+	}
+	b.mu.Unlock()
+
+	for _, handler := range handlers {
+		threading.RunSafe(func() { handler(event) })
+	}
+}
+
+func (b *ChangeStreamBus) sleep(ctx context.Context) {
+	select {
+	case <-time.After(watchRetryInterval):
+	case <-ctx.Done():
+	}
+}
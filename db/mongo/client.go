@@ -2,6 +2,7 @@ package mongo
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
@@ -20,12 +21,16 @@ type MongoClient struct {
 
 var (
 	instance *MongoClient
-	once     sync.Once
+	mu       sync.Mutex
 )
 
-// GetMongoClient gets the instance of Mongo client
-func GetMongoClient() *MongoClient {
-	once.Do(func() {
+// GetMongoClient gets the instance of Mongo client, connecting it if not connected yet.
+// A failed connection is retried by the next call.
+func GetMongoClient() (*MongoClient, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if instance == nil {
 		cfg := config.LoadMongoConfig()
 		clientOptions := options.Client().
 			ApplyURI(cfg.URI).
@@ -41,14 +46,19 @@ func GetMongoClient() *MongoClient {
 		err = backoff.Retry(func() error {
 			client, err = mongo.Connect(context.Background(), clientOptions)
 			if err != nil {
-				logger.Fatal("Failed to connect MongoDB: %v", err)
+				logger.Error("Failed to connect MongoDB: %v", err)
+				return err
+			}
+			if err := client.Ping(context.Background(), nil); err != nil {
+				client.Disconnect(context.Background())
 				return err
 			}
-			return client.Ping(context.Background(), nil)
+			return nil
 		}, retry)
 
 		if err != nil {
-			logger.Fatal("MongoDB reconnection failed: %v", err)
+			logger.Error("MongoDB reconnection failed: %v", err)
+			return nil, fmt.Errorf("failed to connect MongoDB: %v", err)
 		}
 
 		instance = &MongoClient{
@@ -57,9 +67,9 @@ func GetMongoClient() *MongoClient {
 			Config:   cfg,
 		}
 		logger.Info("MongoDB connection successful: %s", cfg.URI)
-	})
+	}
 
-	return instance
+	return instance, nil
 }
 
 func (m *MongoClient) Close() {
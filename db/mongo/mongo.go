@@ -6,22 +6,32 @@ import (
 	"time"
 
 	"github.com/world-in-progress/yggdrasil/core/logger"
+	"github.com/world-in-progress/yggdrasil/core/tracing"
+	nodeinterface "github.com/world-in-progress/yggdrasil/node/interface"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type MongoRepository struct {
+	client      *mongo.Client
 	db          *mongo.Database
 	timeout     time.Duration
 	collections sync.Map
 }
 
-func NewMongoRepository() *MongoRepository {
-	client := GetMongoClient()
+func NewMongoRepository() (*MongoRepository, error) {
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, err
+	}
 	return &MongoRepository{
+		client:  client.Client,
 		db:      client.Database,
 		timeout: time.Duration(client.Config.Timeout) * time.Second,
-	}
+	}, nil
 }
 
 func (r *MongoRepository) getCollection(table string) *mongo.Collection {
@@ -33,31 +43,52 @@ func (r *MongoRepository) getCollection(table string) *mongo.Collection {
 	return coll
 }
 
+// startSpan starts a client span of an operation on a collection.
+func (r *MongoRepository) startSpan(ctx context.Context, operation string, table string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "mongo."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "mongodb"),
+			attribute.String("db.namespace", r.db.Name()),
+			attribute.String("db.collection.name", table),
+			attribute.String("db.operation.name", operation),
+		),
+	)
+}
+
 func (r *MongoRepository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
 	return context.WithTimeout(ctx, r.timeout)
 }
 
 func (r *MongoRepository) Create(ctx context.Context, table string, record map[string]any) (string, error) {
+	ctx, span := r.startSpan(ctx, "insert", table)
+	defer span.End()
+
 	coll := r.getCollection(table)
 	timeoutCtx, cancel := r.withTimeout(ctx)
 	defer cancel()
 
 	res, err := coll.InsertOne(timeoutCtx, bson.M(record))
 	if err != nil {
-		logger.Error("Insert failed for collection %s: %v", table, err)
+		logger.FromContext(ctx).Error("Insert failed for collection %s: %v", table, err)
+		tracing.RecordError(span, err)
 		return "", err
 	}
 	return res.InsertedID.(string), nil
 }
 
 func (r *MongoRepository) ReadAll(ctx context.Context, table string, filter map[string]any) ([]map[string]any, error) {
+	ctx, span := r.startSpan(ctx, "find", table)
+	defer span.End()
+
 	coll := r.getCollection(table)
 	timeoutCtx, cancel := r.withTimeout(ctx)
 	defer cancel()
 
 	cursor, err := coll.Find(timeoutCtx, bson.M(filter))
 	if err != nil {
-		logger.Error("Query failed for collection %s: %v", table, err)
+		logger.FromContext(ctx).Error("Query failed for collection %s: %v", table, err)
+		tracing.RecordError(span, err)
 		return nil, err
 	}
 	defer cursor.Close(timeoutCtx)
@@ -65,7 +96,8 @@ func (r *MongoRepository) ReadAll(ctx context.Context, table string, filter map[
 	var results []map[string]any
 	err = cursor.All(timeoutCtx, &results)
 	if err != nil {
-		logger.Error("Failed to decode results for collection %s: %v", table, err)
+		logger.FromContext(ctx).Error("Failed to decode results for collection %s: %v", table, err)
+		tracing.RecordError(span, err)
 		return nil, err
 	}
 
@@ -77,6 +109,9 @@ func (r *MongoRepository) ReadAll(ctx context.Context, table string, filter map[
 }
 
 func (r *MongoRepository) ReadOne(ctx context.Context, table string, filter map[string]any) (map[string]any, error) {
+	ctx, span := r.startSpan(ctx, "findOne", table)
+	defer span.End()
+
 	coll := r.getCollection(table)
 	timeoutCtx, cancel := r.withTimeout(ctx)
 	defer cancel()
@@ -87,39 +122,78 @@ func (r *MongoRepository) ReadOne(ctx context.Context, table string, filter map[
 		return map[string]any{}, mongo.ErrNoDocuments
 	}
 	if err != nil {
-		logger.Error("Query failed for collection %s: %v", table, err)
+		logger.FromContext(ctx).Error("Query failed for collection %s: %v", table, err)
+		tracing.RecordError(span, err)
 		return nil, err
 	}
 	return result, nil
 }
 
 func (r *MongoRepository) Update(ctx context.Context, table string, filter map[string]any, update map[string]any) error {
+	ctx, span := r.startSpan(ctx, "update", table)
+	defer span.End()
+
 	coll := r.getCollection(table)
 	timeoutCtx, cancel := r.withTimeout(ctx)
 	defer cancel()
 
 	_, err := coll.UpdateOne(timeoutCtx, bson.M(filter), update)
 	if err != nil {
-		logger.Error("Update failed for collection %s: %v", table, err)
+		logger.FromContext(ctx).Error("Update failed for collection %s: %v", table, err)
+		tracing.RecordError(span, err)
 		return err
 	}
 	return nil
 }
 
+// FindOneAndUpdate atomically updates the first document matching the filter and returns it as it is before or after
+// the update, or nil if no document matches.
+func (r *MongoRepository) FindOneAndUpdate(ctx context.Context, table string, filter map[string]any, update map[string]any, returnDocument nodeinterface.ReturnDocument) (map[string]any, error) {
+	ctx, span := r.startSpan(ctx, "findOneAndUpdate", table)
+	defer span.End()
+
+	coll := r.getCollection(table)
+	timeoutCtx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var result map[string]any
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if returnDocument == nodeinterface.ReturnBefore {
+		opts.SetReturnDocument(options.Before)
+	}
+	err := coll.FindOneAndUpdate(timeoutCtx, bson.M(filter), update, opts).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("Find and update failed for collection %s: %v", table, err)
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	return result, nil
+}
+
 func (r *MongoRepository) Delete(ctx context.Context, table string, filter map[string]any) error {
+	ctx, span := r.startSpan(ctx, "delete", table)
+	defer span.End()
+
 	coll := r.getCollection(table)
 	timeoutCtx, cancel := r.withTimeout(ctx)
 	defer cancel()
 
 	_, err := coll.DeleteOne(timeoutCtx, bson.M(filter))
 	if err != nil {
-		logger.Error("Delete failed for collection %s: %v", table, err)
+		logger.FromContext(ctx).Error("Delete failed for collection %s: %v", table, err)
+		tracing.RecordError(span, err)
 		return err
 	}
 	return nil
 }
 
 func (r *MongoRepository) Count(ctx context.Context, table string, filter map[string]any) (int64, error) {
+	ctx, span := r.startSpan(ctx, "count", table)
+	defer span.End()
+
 	coll := r.getCollection(table)
 	timeoutCtx, cancel := r.withTimeout(ctx)
 	defer cancel()
@@ -133,7 +207,8 @@ func (r *MongoRepository) Count(ctx context.Context, table string, filter map[st
 
 	count, err := coll.CountDocuments(timeoutCtx, filterDoc)
 	if err != nil {
-		logger.Error("Count failed for collection %s: %v", table, err)
+		logger.FromContext(ctx).Error("Count failed for collection %s: %v", table, err)
+		tracing.RecordError(span, err)
 		return 0, err
 	}
 
@@ -148,31 +223,33 @@ func (r *MongoRepository) EnsureIndexes(ctx context.Context, table string, index
 	indexView := coll.Indexes()
 	_, err := indexView.CreateMany(timeoutCtx, indexes)
 	if err != nil {
-		logger.Error("Index creation failed for collection %s: %v", table, err)
+		logger.FromContext(ctx).Error("Index creation failed for collection %s: %v", table, err)
 		return err
 	}
-	logger.Info("Index created successfully for collection %s", table)
+	logger.FromContext(ctx).Info("Index created successfully for collection %s", table)
 	return nil
 }
 
-func (r *MongoRepository) WithTransaction(ctx context.Context, fn func(sessionContext mongo.SessionContext) error) error {
-	client := GetMongoClient().Client
-	session, err := client.StartSession()
+// WithTransaction runs fn in a transaction, which is committed if fn succeeds and aborted otherwise.
+// Operations take part in the transaction if they are run with the context given to fn.
+func (r *MongoRepository) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := r.client.StartSession()
 	if err != nil {
-		logger.Error("Failed to launch session: %v", err)
+		logger.FromContext(ctx).Error("Failed to launch session: %v", err)
 		return err
 	}
 	defer session.EndSession(ctx)
 
 	err = session.StartTransaction()
 	if err != nil {
-		logger.Error("Failed to start transaction: %v", err)
+		logger.FromContext(ctx).Error("Failed to start transaction: %v", err)
+		return err
 	}
 
 	err = mongo.WithSession(ctx, session, func(sessionContext mongo.SessionContext) error {
 		if err := fn(sessionContext); err != nil {
 			session.AbortTransaction(sessionContext)
-			logger.Error("Failed to execute transaction: %v", err)
+			logger.FromContext(ctx).Error("Failed to execute transaction: %v", err)
 			return err
 		}
 		return session.CommitTransaction(sessionContext)
@@ -181,6 +258,6 @@ func (r *MongoRepository) WithTransaction(ctx context.Context, fn func(sessionCo
 	if err != nil {
 		return err
 	}
-	logger.Info("Transaction executed successfully")
+	logger.FromContext(ctx).Info("Transaction executed successfully")
 	return nil
 }
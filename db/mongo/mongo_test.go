@@ -14,7 +14,10 @@ func TestMongo(t *testing.T) {
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath("../../test")
 
-	repo := NewMongoRepository()
+	repo, err := NewMongoRepository()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	node := map[string]any{
 		"_id":  uuid.New().String(),
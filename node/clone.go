@@ -0,0 +1,145 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// CloneSubtree copies a node and its descendants under a new parent, or as a root if newParentID is empty,
+// and returns the IDs of the copies by the IDs of the nodes they are copied from. Copies have new IDs and
+// keep the components and templates of their nodes. Overrides are attributes set on copies, by the IDs of
+// the nodes they are copied from and then by attribute paths, such as "config.rate" for a nested attribute.
+func (t *Tree) CloneSubtree(rootID, newParentID string, overrides map[string]map[string]any) (map[string]string, error) {
+	return t.CloneSubtreeCtx(context.Background(), rootID, newParentID, overrides)
+}
+
+// CloneSubtreeCtx copies a node and its descendants under a new parent with context.
+// Every copy is validated before any is recorded, and copies recorded are deleted if others fail.
+func (t *Tree) CloneSubtreeCtx(ctx context.Context, rootID, newParentID string, overrides map[string]map[string]any) (map[string]string, error) {
+	if newParentID != "" {
+		if count, err := t.repo.Count(ctx, "node", map[string]any{"_id": newParentID}); err != nil || count == 0 {
+			return nil, fmt.Errorf("failed to clone node %s: parent node %s does not exist", rootID, newParentID)
+		}
+	}
+
+	records, err := t.ReadSubtreeCtx(ctx, rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone node %s: %v", rootID, err)
+	}
+
+	// Map IDs, parents before children
+	IDs := make(map[string]string, len(records))
+	for _, record := range records {
+		ID := record["_id"].(string)
+		IDs[ID] = strings.Split(ID, "-")[0] + "-" + uuid.New().String()
+	}
+	for ID := range overrides {
+		if _, ok := IDs[ID]; !ok {
+			return nil, fmt.Errorf("failed to clone node %s: overridden node %s is not in the subtree", rootID, ID)
+		}
+	}
+
+	// Copy and validate records
+	copies := make([]map[string]any, 0, len(records))
+	for _, record := range records {
+		ID := record["_id"].(string)
+		nodeInfo := deepCopy(record).(map[string]any)
+		delete(nodeInfo, versionField)
+		nodeInfo["_id"] = IDs[ID]
+		if ID == rootID {
+			delete(nodeInfo, "parent")
+			if newParentID != "" {
+				nodeInfo["parent"] = newParentID
+			}
+		} else {
+			nodeInfo["parent"] = IDs[record["parent"].(string)]
+		}
+
+		for path, value := range overrides[ID] {
+			if err := setAttribute(nodeInfo, path, deepCopy(value)); err != nil {
+				return nil, fmt.Errorf("failed to override node %s: %v", ID, err)
+			}
+		}
+		if err := t.SchemaMgr.ValidateCtx(ctx, strings.Split(ID, "-")[0], nodeInfo); err != nil {
+			return nil, fmt.Errorf("copy of node %s is invalid: %v", ID, err)
+		}
+		copies = append(copies, nodeInfo)
+	}
+
+	// Record copies
+	for i, nodeInfo := range copies {
+		if err := t.createNode(ctx, nodeInfo); err != nil {
+			if i > 0 {
+				if delErr := t.DeleteNodeCtx(ctx, IDs[rootID]); delErr != nil {
+					return nil, fmt.Errorf("failed to clone node %s: %v, and failed to delete copies: %v", rootID, err, delErr)
+				}
+			}
+			return nil, fmt.Errorf("failed to clone node %s: %v", rootID, err)
+		}
+	}
+	return IDs, nil
+}
+
+// ReadSubtree reads records of a node and its descendants level by level, parents before children.
+// Active nodes are written back before being read, so that records hold their latest attributes.
+func (t *Tree) ReadSubtree(rootID string) ([]map[string]any, error) {
+	return t.ReadSubtreeCtx(context.Background(), rootID)
+}
+
+// ReadSubtreeCtx reads records of a node and its descendants level by level with context.
+func (t *Tree) ReadSubtreeCtx(ctx context.Context, rootID string) ([]map[string]any, error) {
+	var records []map[string]any
+	for level := []string{rootID}; len(level) > 0; {
+		for _, ID := range level {
+			if err := t.FlushNodeCtx(ctx, ID); err != nil {
+				return nil, fmt.Errorf("failed to write back node %s: %v", ID, err)
+			}
+		}
+		levelRecords, err := t.repo.ReadAll(ctx, "node", map[string]any{"_id": map[string]any{"$in": level}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read nodes: %v", err)
+		}
+		if len(levelRecords) != len(level) {
+			return nil, fmt.Errorf("records of some nodes of %v do not exist", level)
+		}
+		records = append(records, levelRecords...)
+
+		children, err := t.repo.ReadAll(ctx, "node", map[string]any{"parent": map[string]any{"$in": level}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to find children of nodes: %v", err)
+		}
+		level = make([]string, 0, len(children))
+		for _, child := range children {
+			level = append(level, child["_id"].(string))
+		}
+	}
+	return records, nil
+}
+
+// setAttribute sets an attribute by a dotted path, creating objects missing along the path.
+func setAttribute(attributes map[string]any, path string, value any) error {
+	names := strings.Split(path, ".")
+	switch names[0] {
+	case "_id", "parent", versionField:
+		return fmt.Errorf("attribute %s cannot be overridden", names[0])
+	}
+
+	current := attributes
+	for _, name := range names[:len(names)-1] {
+		next, ok := current[name]
+		if !ok || next == nil {
+			next = make(map[string]any)
+			current[name] = next
+		}
+		object, ok := next.(map[string]any)
+		if !ok {
+			return fmt.Errorf("attribute %s of path %s is not an object", name, path)
+		}
+		current = object
+	}
+	current[names[len(names)-1]] = value
+	return nil
+}
@@ -0,0 +1,86 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/world-in-progress/yggdrasil/db/memory"
+)
+
+func TestTreeCloneSubtree(t *testing.T) {
+	tree, err := NewTree("Test tree", memory.NewMemoryRepository(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.RegistserNodeSchemaFromJson("node_schema_test.json"); err != nil {
+		t.Fatal(err)
+	}
+	rootID := newSubtree(t, tree)
+	root, _ := tree.GetNode(rootID)
+	childID := root.GetChildIDs()[0]
+	if err := tree.UpdateNodeAttribute(childID, "components", []any{"RESTFUL-component"}); err != nil {
+		t.Fatal(err)
+	}
+	parentID, err := tree.RegisterNode("BaseNode", map[string]any{"name": "Parent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Invalid copies are not recorded
+	if _, err := tree.CloneSubtree(rootID, parentID, map[string]map[string]any{rootID: {"name": 1}}); err == nil {
+		t.Fatalf("cloning is expected to fail by an invalid override")
+	}
+	if count, _ := tree.GetNodeRecordNum(); count != 14 {
+		t.Fatalf("no copy is expected to be recorded, but got %v node records", count)
+	}
+
+	IDs, err := tree.CloneSubtree(rootID, parentID, map[string]map[string]any{rootID: {"name": "Copy"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(IDs) != 13 {
+		t.Fatalf("13 nodes are expected to be cloned, but got %v", len(IDs))
+	}
+	if count, _ := tree.GetNodeRecordNum(); count != 27 {
+		t.Fatalf("13 copies are expected to be recorded, but got %v node records", count)
+	}
+
+	copied, err := tree.GetNode(IDs[rootID])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied.GetName() != "Copy" || copied.GetParentID() != parentID || len(copied.GetChildIDs()) != 3 {
+		t.Fatalf("copied root is not expected: %v", copied.Snapshot())
+	}
+	copiedChild, err := tree.GetNode(IDs[childID])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copiedChild.GetParentID() != IDs[rootID] || len(copiedChild.GetChildIDs()) != 3 {
+		t.Fatalf("copied child is expected to be under the copied root: %v", copiedChild.Snapshot())
+	}
+	if components, _ := copiedChild.GetParam("components").([]any); len(components) != 1 || components[0] != "RESTFUL-component" {
+		t.Fatalf("copied child is expected to keep its component, but got %v", copiedChild.GetParam("components"))
+	}
+	if root.GetName() != "Root" {
+		t.Fatalf("original root is not expected to be overridden")
+	}
+}
+
+func TestSetAttribute(t *testing.T) {
+	attributes := map[string]any{"name": "Node", "config": map[string]any{"rate": 1}}
+	if err := setAttribute(attributes, "config.rate", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := setAttribute(attributes, "extra.nested.value", true); err != nil {
+		t.Fatal(err)
+	}
+	if attributes["config"].(map[string]any)["rate"] != 2 || attributes["extra"].(map[string]any)["nested"].(map[string]any)["value"] != true {
+		t.Fatalf("attributes are not expected: %v", attributes)
+	}
+	if err := setAttribute(attributes, "name.first", "Node"); err == nil {
+		t.Fatalf("attributes which are not objects are not expected to be overridden")
+	}
+	if err := setAttribute(attributes, "_id", "Other"); err == nil {
+		t.Fatalf("ID is not expected to be overridden")
+	}
+}
@@ -0,0 +1,277 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	nodeinterface "github.com/world-in-progress/yggdrasil/node/interface"
+)
+
+// ErrNoHistoryStore is returned by history APIs of a tree without history store.
+var ErrNoHistoryStore = errors.New("tree has no history store")
+
+type (
+	SourceType string
+
+	// ChangeSource describes who or what changed a node attribute.
+	ChangeSource struct {
+		Type        SourceType
+		PrincipalID string // ID of the principal updating or reverting the attribute
+		ComponentID string // ID of the component whose output is written back
+		TaskID      string // ID of the task writing component output back
+		TemplateID  string // ID of the template a node is registered from
+	}
+
+	// AttributeChange is a history record of a node attribute update.
+	AttributeChange struct {
+		NodeID    string
+		Attribute string
+		OldValue  any
+		Existed   bool // whether the attribute existed before the change, as OldValue may be nil either way
+		Removed   bool // whether the attribute is removed by the change, rather than updated to NewValue
+		NewValue  any
+		Source    ChangeSource
+		Time      time.Time
+	}
+
+	// IHistoryStore is the interface for a store recording node attribute changes.
+	IHistoryStore interface {
+		// Record records an attribute change.
+		Record(ctx context.Context, change AttributeChange) error
+		// List lists attribute changes of a node sorted by time.
+		List(ctx context.Context, nodeID string) ([]AttributeChange, error)
+	}
+
+	// RepositoryHistoryStore records attribute changes as records of the table "nodehistory" of a repository.
+	RepositoryHistoryStore struct {
+		repo nodeinterface.IRepository
+	}
+
+	changeSourceKey struct{}
+)
+
+const (
+	UserSource      SourceType = "USER"
+	ComponentSource SourceType = "COMPONENT"
+	TemplateSource  SourceType = "TEMPLATE"
+	RevertSource    SourceType = "REVERT"
+)
+
+// WithChangeSource returns a copy of ctx carrying the source of attribute changes made with it.
+func WithChangeSource(ctx context.Context, source ChangeSource) context.Context {
+	return context.WithValue(ctx, changeSourceKey{}, source)
+}
+
+// ChangeSourceFromContext returns the change source carried by ctx, or a user source if there is none.
+func ChangeSourceFromContext(ctx context.Context) ChangeSource {
+	if source, ok := ctx.Value(changeSourceKey{}).(ChangeSource); ok {
+		return source
+	}
+	return ChangeSource{Type: UserSource}
+}
+
+func NewRepositoryHistoryStore(repo nodeinterface.IRepository) *RepositoryHistoryStore {
+	return &RepositoryHistoryStore{
+		repo: repo,
+	}
+}
+
+func (s *RepositoryHistoryStore) Record(ctx context.Context, change AttributeChange) error {
+	record := map[string]any{
+		"node":      change.NodeID,
+		"attribute": change.Attribute,
+		"old":       change.OldValue,
+		"existed":   change.Existed,
+		"new":       change.NewValue,
+		"removed":   change.Removed,
+		"time":      change.Time.UnixNano(),
+		"source": map[string]any{
+			"type":      string(change.Source.Type),
+			"principal": change.Source.PrincipalID,
+			"component": change.Source.ComponentID,
+			"task":      change.Source.TaskID,
+			"template":  change.Source.TemplateID,
+		},
+	}
+	if _, err := s.repo.Create(ctx, "nodehistory", record); err != nil {
+		return fmt.Errorf("failed to create history record of node %s: %v", change.NodeID, err)
+	}
+	return nil
+}
+
+func (s *RepositoryHistoryStore) List(ctx context.Context, nodeID string) ([]AttributeChange, error) {
+	records, err := s.repo.ReadAll(ctx, "nodehistory", map[string]any{"node": nodeID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history records of node %s: %v", nodeID, err)
+	}
+
+	changes := make([]AttributeChange, 0, len(records))
+	for _, record := range records {
+		change := AttributeChange{
+			NodeID:   nodeID,
+			OldValue: record["old"],
+			NewValue: record["new"],
+		}
+		change.Attribute, _ = record["attribute"].(string)
+		change.Removed, _ = record["removed"].(bool)
+		if existed, ok := record["existed"].(bool); ok {
+			change.Existed = existed
+		} else {
+			// Records made before existence was recorded
+			change.Existed = change.OldValue != nil
+		}
+		switch nanos := record["time"].(type) {
+		case int64:
+			change.Time = time.Unix(0, nanos)
+		case int32:
+			change.Time = time.Unix(0, int64(nanos))
+		case float64:
+			change.Time = time.Unix(0, int64(nanos))
+		}
+		if source, ok := record["source"].(map[string]any); ok {
+			sourceType, _ := source["type"].(string)
+			change.Source.Type = SourceType(sourceType)
+			change.Source.PrincipalID, _ = source["principal"].(string)
+			change.Source.ComponentID, _ = source["component"].(string)
+			change.Source.TaskID, _ = source["task"].(string)
+			change.Source.TemplateID, _ = source["template"].(string)
+		}
+		changes = append(changes, change)
+	}
+
+	// Records created at the same time keep their repository order
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Time.Before(changes[j].Time) })
+	return changes, nil
+}
+
+// SetHistoryStore sets the store recording attribute changes of nodes.
+// A nil store stops recording.
+func (t *Tree) SetHistoryStore(store IHistoryStore) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.history = store
+}
+
+func (t *Tree) historyStore() IHistoryStore {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.history
+}
+
+// recordChange records an attribute change with the source carried by ctx if the tree has a history store.
+func (t *Tree) recordChange(ctx context.Context, ID, name string, old any, existed bool, update any) error {
+	return t.record(ctx, AttributeChange{NodeID: ID, Attribute: name, OldValue: old, Existed: existed, NewValue: update})
+}
+
+// record records a change with the source carried by ctx and the current time if the tree has a history store.
+func (t *Tree) record(ctx context.Context, change AttributeChange) error {
+	store := t.historyStore()
+	if store == nil {
+		return nil
+	}
+
+	change.Source = ChangeSourceFromContext(ctx)
+	change.Time = time.Now()
+	return store.Record(ctx, change)
+}
+
+// GetNodeHistory lists attribute changes of a node sorted by time.
+func (t *Tree) GetNodeHistory(ID string) ([]AttributeChange, error) {
+	return t.GetNodeHistoryCtx(context.Background(), ID)
+}
+
+// GetNodeHistoryCtx lists attribute changes of a node sorted by time with context.
+func (t *Tree) GetNodeHistoryCtx(ctx context.Context, ID string) ([]AttributeChange, error) {
+	store := t.historyStore()
+	if store == nil {
+		return nil, ErrNoHistoryStore
+	}
+	return store.List(ctx, ID)
+}
+
+// GetNodeAsOf returns a copy of node attributes as they were at a point in time,
+// by undoing the recorded changes made after it. Changes made while no history store was set are not undone.
+func (t *Tree) GetNodeAsOf(ID string, at time.Time) (map[string]any, error) {
+	return t.GetNodeAsOfCtx(context.Background(), ID, at)
+}
+
+// GetNodeAsOfCtx returns a copy of node attributes as they were at a point in time with context.
+func (t *Tree) GetNodeAsOfCtx(ctx context.Context, ID string, at time.Time) (map[string]any, error) {
+	changes, err := t.GetNodeHistoryCtx(ctx, ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history of node %s: %v", ID, err)
+	}
+
+	node, err := t.GetNodeCtx(ctx, ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node %s: %v", ID, err)
+	}
+	attributes := node.Snapshot()
+
+	for i := len(changes) - 1; i >= 0 && changes[i].Time.After(at); i-- {
+		if !changes[i].Existed {
+			delete(attributes, changes[i].Attribute)
+		} else {
+			attributes[changes[i].Attribute] = changes[i].OldValue
+		}
+	}
+	return attributes, nil
+}
+
+// RevertNodeAttribute updates a node attribute back to its value at a point in time.
+// The update is recorded as a change of revert source.
+func (t *Tree) RevertNodeAttribute(ID string, name string, at time.Time) error {
+	return t.RevertNodeAttributeCtx(context.Background(), ID, name, at)
+}
+
+// RevertNodeAttributeCtx updates a node attribute back to its value at a point in time with context.
+func (t *Tree) RevertNodeAttributeCtx(ctx context.Context, ID string, name string, at time.Time) error {
+	attributes, err := t.GetNodeAsOfCtx(ctx, ID, at)
+	if err != nil {
+		return err
+	}
+	source := ChangeSourceFromContext(ctx)
+	source.Type = RevertSource
+	ctx = WithChangeSource(ctx, source)
+
+	value, ok := attributes[name]
+	if !ok {
+		return t.removeNodeAttribute(ctx, ID, name)
+	}
+	return t.UpdateNodeAttributeCtx(ctx, ID, name, value)
+}
+
+// removeNodeAttribute removes an attribute from a node record, unless the schema of the node requires it.
+// An active node is written back and deactivated first, so that it is activated again without the attribute.
+func (t *Tree) removeNodeAttribute(ctx context.Context, ID string, name string) error {
+	schema, err := t.SchemaMgr.LoadSchema(ctx, strings.Split(ID, "-")[0])
+	if err != nil {
+		return fmt.Errorf("failed to remove attribute %s of node %s: %v", name, ID, err)
+	}
+	if field, ok := schema.Fields[name]; ok && field.Required {
+		return fmt.Errorf("failed to remove attribute %s of node %s: attribute is required", name, ID)
+	}
+
+	if err := t.deactivateNodeCtx(ctx, ID); err != nil {
+		return fmt.Errorf("failed to remove attribute %s of node %s: %v", name, ID, err)
+	}
+	updateData := map[string]any{
+		"$unset": map[string]any{name: ""},
+		"$inc":   map[string]any{versionField: int64(1)},
+	}
+	before, err := t.updateRecord(ctx, ID, updateData, nil)
+	if err != nil {
+		return fmt.Errorf("failed to remove attribute %s of node %s: %v", name, ID, err)
+	}
+
+	old, existed := before[name]
+	change := AttributeChange{NodeID: ID, Attribute: name, OldValue: old, Existed: existed, Removed: true}
+	if err := t.record(ctx, change); err != nil {
+		return fmt.Errorf("attribute %s of node %s is removed but failed to record the change: %v", name, ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/world-in-progress/yggdrasil/db/memory"
+)
+
+func TestNodeHistory(t *testing.T) {
+	repo := memory.NewMemoryRepository()
+	tree, err := NewTree("Test tree", repo, 1) // only one node can be stored in the runtime cache
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tree.RegistserNodeSchemaFromJson("node_schema_test.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tree.GetNodeHistory("any"); err != ErrNoHistoryStore {
+		t.Fatalf("listing history without history store is expected to fail, but got %v", err)
+	}
+	tree.SetHistoryStore(NewRepositoryHistoryStore(repo))
+
+	nodeID, err := tree.RegisterNode("BaseNode", map[string]any{"name": "v0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.UpdateNodeAttribute(nodeID, "name", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	beforeV2 := time.Now()
+	time.Sleep(time.Millisecond)
+
+	// update the node while it is inactive, on behalf of a component
+	if _, err := tree.RegisterNode("BaseNode", map[string]any{"name": "Other"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, loaded := tree.cache.Peek(nodeID); loaded {
+		t.Fatal("node is expected to be inactive")
+	}
+	ctx := WithChangeSource(context.Background(), ChangeSource{Type: ComponentSource, ComponentID: "RESTFUL-compo", TaskID: "task"})
+	if err := tree.UpdateNodeAttributeCtx(ctx, nodeID, "name", "v2"); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := tree.GetNodeHistory(nodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("2 changes are expected, but got %v", changes)
+	}
+	if changes[0].OldValue != "v0" || changes[0].NewValue != "v1" || changes[0].Source.Type != UserSource {
+		t.Fatalf("first change is unexpected: %+v", changes[0])
+	}
+	if changes[1].OldValue != "v1" || changes[1].NewValue != "v2" || changes[1].Source.ComponentID != "RESTFUL-compo" || changes[1].Source.TaskID != "task" {
+		t.Fatalf("second change is unexpected: %+v", changes[1])
+	}
+
+	// point-in-time reads
+	attributes, err := tree.GetNodeAsOf(nodeID, beforeV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attributes["name"] != "v1" {
+		t.Fatalf("name as of before v2 is expected to be v1, but is %v", attributes["name"])
+	}
+	node, _ := tree.GetNode(nodeID)
+	if node.GetName() != "v2" {
+		t.Fatalf("reading node as of a time is expected not to change it, but name is %v", node.GetName())
+	}
+
+	// revert
+	if err := tree.RevertNodeAttribute(nodeID, "name", beforeV2); err != nil {
+		t.Fatal(err)
+	}
+	if node.GetName() != "v1" {
+		t.Fatalf("name is expected to be reverted to v1, but is %v", node.GetName())
+	}
+	changes, _ = tree.GetNodeHistory(nodeID)
+	if last := changes[len(changes)-1]; len(changes) != 3 || last.Source.Type != RevertSource || last.NewValue != "v1" {
+		t.Fatalf("revert is expected to be recorded, but history is %+v", changes)
+	}
+}
+
+func TestNodeHistoryPreImage(t *testing.T) {
+	repo := memory.NewMemoryRepository()
+	tree, err := NewTree("Test tree", repo, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tree.RegistserNodeSchemaFromJson("node_schema_test.json"); err != nil {
+		t.Fatal(err)
+	}
+	tree.SetHistoryStore(NewRepositoryHistoryStore(repo))
+
+	// an inactive node recorded with a nil attribute and without another
+	ID := "ExtendNode-00000000-0000-0000-0000-000000000000"
+	if _, err := repo.Create(context.Background(), "node", map[string]any{"_id": ID, "name": "v0", "components": nil}); err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent updates record the values they replace
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tree.UpdateNodeAttribute(ID, "name", fmt.Sprintf("v%d", i+1))
+		}()
+	}
+	wg.Wait()
+	changes, err := tree.GetNodeHistory(ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaced := map[any]int{}
+	for _, change := range changes {
+		replaced[change.OldValue]++
+	}
+	record, _ := repo.ReadOne(context.Background(), "node", map[string]any{"_id": ID})
+	for _, change := range changes {
+		if change.NewValue != record["name"] && replaced[change.NewValue] != 1 {
+			t.Fatalf("each value is expected to be replaced once, but history is %+v", changes)
+		}
+	}
+	if len(changes) != 8 || replaced["v0"] != 1 {
+		t.Fatalf("each value is expected to be replaced once, but history is %+v", changes)
+	}
+
+	time.Sleep(time.Millisecond)
+	before := time.Now()
+	time.Sleep(time.Millisecond)
+	if err := tree.UpdateNodeAttribute(ID, "components", []any{"RESTFUL-compo"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.UpdateNodeAttribute(ID, "time", "now"); err != nil {
+		t.Fatal(err)
+	}
+
+	// nil values are kept apart from absent attributes
+	attributes, err := tree.GetNodeAsOf(ID, before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if components, ok := attributes["components"]; !ok || components != nil {
+		t.Fatalf("components are expected to be nil as of before, but got %v, %v", components, ok)
+	}
+	if _, ok := attributes["time"]; ok {
+		t.Fatalf("time is expected to be absent as of before, but got %v", attributes["time"])
+	}
+
+	// reverting to absent removes the attribute
+	if err := tree.RevertNodeAttribute(ID, "time", before); err != nil {
+		t.Fatal(err)
+	}
+	node, err := tree.GetNode(ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := node.Snapshot()["time"]; ok {
+		t.Fatalf("time is expected to be removed by the revert")
+	}
+	changes, _ = tree.GetNodeHistory(ID)
+	if last := changes[len(changes)-1]; !last.Removed || last.OldValue != "now" || last.Source.Type != RevertSource {
+		t.Fatalf("removal is expected to be recorded, but got %+v", last)
+	}
+	if err := tree.removeNodeAttribute(context.Background(), ID, "name"); err == nil {
+		t.Fatalf("removing a required attribute is expected to fail")
+	}
+}
@@ -3,6 +3,9 @@ package nodeinterface
 import "context"
 
 type (
+	// ReturnDocument selects whether FindOneAndUpdate returns a record as it is before or after the update.
+	ReturnDocument int
+
 	IRepository interface {
 		Create(ctx context.Context, table string, record map[string]any) (string, error)
 		ReadOne(ctx context.Context, table string, filter map[string]any) (map[string]any, error)
@@ -11,4 +14,16 @@ type (
 		Delete(ctx context.Context, table string, filter map[string]any) error
 		Count(ctx context.Context, table string, filter map[string]any) (int64, error)
 	}
+
+	// IAtomicRepository is the interface for a repository updating a record and reading it atomically,
+	// used by trees to update node records by compare-and-set. FindOneAndUpdate returns nil if no record matches.
+	IAtomicRepository interface {
+		IRepository
+		FindOneAndUpdate(ctx context.Context, table string, filter map[string]any, update map[string]any, returnDocument ReturnDocument) (map[string]any, error)
+	}
+)
+
+const (
+	ReturnAfter ReturnDocument = iota
+	ReturnBefore
 )
@@ -0,0 +1,61 @@
+package node
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/world-in-progress/yggdrasil/core/invalidation"
+	"github.com/world-in-progress/yggdrasil/core/logger"
+)
+
+// treeBus is the invalidation bus of a tree, with the ID the tree publishes events as.
+type treeBus struct {
+	bus         invalidation.IBus
+	source      string
+	unsubscribe func()
+}
+
+// SetInvalidationBus shares invalidations of node records with other trees subscribing to bus.
+// Records written by the tree are published as invalidated, and nodes whose records are written by other trees
+// are deactivated, so that they are loaded again once requested. A dirty node is written back before,
+// see SetMergeFunc. A nil bus stops sharing invalidations.
+func (t *Tree) SetInvalidationBus(bus invalidation.IBus) {
+	var tb *treeBus
+	if bus != nil {
+		tb = &treeBus{bus: bus, source: uuid.New().String()}
+		tb.unsubscribe = bus.Subscribe(func(event invalidation.Event) {
+			if event.Source == tb.source || event.Table != "node" {
+				return
+			}
+			t.invalidate(event.ID)
+		})
+	}
+	if old := t.bus.Swap(tb); old != nil {
+		old.unsubscribe()
+	}
+}
+
+// publish publishes records of IDs as invalidated.
+func (t *Tree) publish(ctx context.Context, IDs ...string) {
+	tb := t.bus.Load()
+	if tb == nil {
+		return
+	}
+
+	for _, ID := range IDs {
+		if ID == "" {
+			continue
+		}
+		if err := tb.bus.Publish(ctx, invalidation.Event{Source: tb.source, Table: "node", ID: ID}); err != nil {
+			logger.FromContext(ctx).WithError(err).Warn("Failed to publish invalidation of node %s", ID)
+		}
+	}
+}
+
+// invalidate deactivates a node whose record is written by another tree.
+func (t *Tree) invalidate(ID string) {
+	ctx := context.Background()
+	if err := t.deactivateNodeCtx(ctx, ID); err != nil {
+		logger.FromContext(ctx).WithError(err).Warn("Failed to invalidate node %s", ID)
+	}
+}
@@ -2,26 +2,56 @@ package node
 
 import (
 	"fmt"
+	"reflect"
+	"slices"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// versionField is the attribute of node records holding their version.
+const versionField = "_version"
+
+// ErrVersionConflict is matched by every VersionConflictError with errors.Is.
+var ErrVersionConflict = fmt.Errorf("node error: version conflict")
+
 type (
+	// Node is a runtime node of a tree, safe for concurrent readers and writers.
+	// Every update raises its version, so that writers can detect updates made since they read it.
+	// The version starts from the one of the node record, which is not an attribute of the node.
 	Node struct {
+		mu          sync.RWMutex
 		childrenIDs []string
-		callTime    time.Time
-		dirty       atomic.Bool
 		attributes  map[string]any
+		version     uint64
+		// persisted is the version of the node record the node is loaded from or flushed to
+		persisted uint64
+
+		callTime atomic.Int64
+		dirty    atomic.Bool
+	}
+
+	// VersionConflictError is returned by compare-and-set updates of a node at another version than expected.
+	// Current is the version of the active node, or the one of the node record for updates made to the repository.
+	VersionConflictError struct {
+		ID       string
+		Expected uint64
+		Current  uint64
 	}
 )
 
 func NewNode(attributes map[string]any) *Node {
 	n := &Node{
-		callTime:    time.Now(),
 		attributes:  attributes,
 		childrenIDs: make([]string, 0),
 	}
+	n.touch()
 
+	if version, ok := n.attributes[versionField]; ok {
+		n.version = toVersion(version)
+		n.persisted = n.version
+		delete(n.attributes, versionField)
+	}
 	if _, ok := n.attributes["components"]; !ok {
 		n.attributes["components"] = make([]string, 0)
 	}
@@ -30,7 +60,7 @@ func NewNode(attributes map[string]any) *Node {
 }
 
 func (n *Node) GetCallTime() time.Time {
-	return n.callTime
+	return time.Unix(0, n.callTime.Load())
 }
 
 func (n *Node) IsDirty() bool {
@@ -41,18 +71,31 @@ func (n *Node) MakeDirty() {
 	n.dirty.Store(false)
 }
 
+// Version returns the version of the node, raised by every update.
+func (n *Node) Version() uint64 {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.version
+}
+
 func (n *Node) GetID() string {
-	n.callTime = time.Now()
+	n.touch()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
 	return n.attributes["_id"].(string)
 }
 
 func (n *Node) GetName() string {
-	n.callTime = time.Now()
+	n.touch()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
 	return n.attributes["name"].(string)
 }
 
 func (n *Node) GetParentID() string {
-	n.callTime = time.Now()
+	n.touch()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
 	if parentID, ok := n.attributes["parent"]; ok {
 		return parentID.(string)
 	} else {
@@ -60,13 +103,19 @@ func (n *Node) GetParentID() string {
 	}
 }
 
+// GetChildIDs returns a copy of IDs of children.
 func (n *Node) GetChildIDs() []string {
-	n.callTime = time.Now()
-	return n.childrenIDs
+	n.touch()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return deepCopy(n.childrenIDs).([]string)
 }
 
+// GetParam returns an attribute. Attribute values must be treated as read-only, see Snapshot.
 func (n *Node) GetParam(name string) any {
-	n.callTime = time.Now()
+	n.touch()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
 	if param, ok := n.attributes[name]; ok {
 		return param
 	} else {
@@ -76,11 +125,18 @@ func (n *Node) GetParam(name string) any {
 
 func (n *Node) AddChild(childID string) {
 	// Do not update calltime because AddChild is not called for functional using by outside.
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if slices.Contains(n.childrenIDs, childID) {
+		return
+	}
 	n.childrenIDs = append(n.childrenIDs, childID)
 }
 
 func (n *Node) RemoveChild(childID string) {
 	// Do not update calltime because AddChild is not called for functional using by outside.
+	n.mu.Lock()
+	defer n.mu.Unlock()
 	for i, ID := range n.childrenIDs {
 		if ID == childID {
 			n.childrenIDs[i], n.childrenIDs[len(n.childrenIDs)-1] = n.childrenIDs[len(n.childrenIDs)-1], n.childrenIDs[i]
@@ -90,17 +146,39 @@ func (n *Node) RemoveChild(childID string) {
 }
 
 func (n *Node) UpdateAttribute(name string, update any) (any, error) {
-	n.dirty.Store(true)
-	n.callTime = time.Now()
-	old, ok := n.attributes[name]
-	if !ok {
-		return nil, fmt.Errorf("node (ID: %s, Name: %s) does not hanve attribute named %s", n.attributes["_id"], n.attributes["nam"], name)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.updateLocked(name, update)
+}
+
+// CompareAndUpdateAttribute updates an attribute if the node is at version, and returns the old value and the new
+// version of the node. A VersionConflictError is returned if the node has been updated since version.
+func (n *Node) CompareAndUpdateAttribute(name string, update any, version uint64) (any, uint64, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.version != version {
+		return nil, n.version, &VersionConflictError{ID: n.idLocked(), Expected: version, Current: n.version}
 	}
-	n.attributes[name] = update
-	return old, nil
+	old, err := n.updateLocked(name, update)
+	return old, n.version, err
+}
+
+// CompareAndUpdateAttributes updates several attributes at once if the node is at version, and returns their old
+// values and the new version of the node, which is incremented once. No attribute is updated if one does not exist.
+func (n *Node) CompareAndUpdateAttributes(updates map[string]any, version uint64) (map[string]any, uint64, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.version != version {
+		return nil, n.version, &VersionConflictError{ID: n.idLocked(), Expected: version, Current: n.version}
+	}
+	old, err := n.updateAllLocked(updates)
+	return old, n.version, err
 }
 
 func (n *Node) AddComponent(compoID string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
 	// If component exists, then return
 	components, _ := n.attributes["components"].([]string)
 	for _, id := range components {
@@ -110,19 +188,25 @@ func (n *Node) AddComponent(compoID string) bool {
 	}
 
 	n.dirty.Store(true)
-	n.callTime = time.Now()
-	n.attributes["components"] = append(n.attributes["components"].([]string), compoID)
+	n.touch()
+	n.version++
+	n.attributes["components"] = append(components[:len(components):len(components)], compoID)
 	return true
 }
 
 func (n *Node) DeleteComponent(compoID string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
 	components, _ := n.attributes["components"].([]string)
 	for i, id := range components {
 		if id == compoID {
 			n.dirty.Store(true)
-			n.callTime = time.Now()
+			n.touch()
+			n.version++
 
-			n.attributes["components"] = append(components[:i], components[i+1:]...)
+			// Build a new slice, as readers may hold the old one
+			n.attributes["components"] = append(append(make([]string, 0, len(components)-1), components[:i]...), components[i+1:]...)
 			return true
 		}
 	}
@@ -130,6 +214,144 @@ func (n *Node) DeleteComponent(compoID string) bool {
 	return false
 }
 
+// Snapshot returns a deep copy of attributes, which is not affected by later updates of the node.
+func (n *Node) Snapshot() map[string]any {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return deepCopy(n.attributes).(map[string]any)
+}
+
+// Serialize returns a snapshot of attributes, see Snapshot.
 func (n *Node) Serialize() map[string]any {
-	return n.attributes
+	return n.Snapshot()
+}
+
+// state returns a snapshot of attributes, the version and the persisted version of the node at once.
+func (n *Node) state() (map[string]any, uint64, uint64) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return deepCopy(n.attributes).(map[string]any), n.version, n.persisted
+}
+
+// persist marks the node flushed to its record at version, which is clean unless the node is updated since.
+func (n *Node) persist(version uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.persisted = version
+	if n.version == version {
+		n.dirty.Store(false)
+	}
+}
+
+func (n *Node) touch() {
+	n.callTime.Store(time.Now().UnixNano())
+}
+
+func (n *Node) idLocked() string {
+	ID, _ := n.attributes["_id"].(string)
+	return ID
+}
+
+func (n *Node) updateLocked(name string, update any) (any, error) {
+	old, ok := n.attributes[name]
+	if !ok {
+		return nil, fmt.Errorf("node (ID: %s, Name: %s) does not hanve attribute named %s", n.attributes["_id"], n.attributes["name"], name)
+	}
+	n.dirty.Store(true)
+	n.touch()
+	n.version++
+	n.attributes[name] = update
+	return old, nil
+}
+
+func (n *Node) updateAllLocked(updates map[string]any) (map[string]any, error) {
+	old := make(map[string]any, len(updates))
+	for name := range updates {
+		value, ok := n.attributes[name]
+		if !ok {
+			return nil, fmt.Errorf("node (ID: %s, Name: %s) does not hanve attribute named %s", n.attributes["_id"], n.attributes["name"], name)
+		}
+		old[name] = value
+	}
+	n.dirty.Store(true)
+	n.touch()
+	n.version++
+	for name, update := range updates {
+		n.attributes[name] = update
+	}
+	return old, nil
+}
+
+// deepCopy copies maps and slices of attribute values recursively.
+func deepCopy(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for key, val := range v {
+			copied[key] = deepCopy(val)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(v))
+		for i, val := range v {
+			copied[i] = deepCopy(val)
+		}
+		return copied
+	}
+
+	// Maps and slices of other types, such as those decoded by the Mongo driver
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.IsNil() {
+			return value
+		}
+		copied := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+		for iter := rv.MapRange(); iter.Next(); {
+			copied.SetMapIndex(iter.Key(), copyValue(iter.Value(), rv.Type().Elem()))
+		}
+		return copied.Interface()
+	case reflect.Slice:
+		if rv.IsNil() {
+			return value
+		}
+		copied := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		for i := range rv.Len() {
+			copied.Index(i).Set(copyValue(rv.Index(i), rv.Type().Elem()))
+		}
+		return copied.Interface()
+	}
+	return value
+}
+
+// copyValue deep copies a map or slice element of type typ.
+func copyValue(v reflect.Value, typ reflect.Type) reflect.Value {
+	copied := deepCopy(v.Interface())
+	if copied == nil {
+		return reflect.Zero(typ)
+	}
+	return reflect.ValueOf(copied)
+}
+
+// toVersion converts a version decoded from a node record.
+func toVersion(v any) uint64 {
+	switch n := v.(type) {
+	case int:
+		return uint64(n)
+	case int32:
+		return uint64(n)
+	case int64:
+		return uint64(n)
+	case float64:
+		return uint64(n)
+	}
+	return 0
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("node %v is at version %v rather than expected version %v", e.ID, e.Current, e.Expected)
+}
+
+func (e *VersionConflictError) Is(target error) bool {
+	return target == ErrVersionConflict
 }
@@ -0,0 +1,97 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestNodeSnapshot(t *testing.T) {
+	n := NewNode(map[string]any{
+		"_id":    "BaseNode-1",
+		"name":   "Node",
+		"nested": map[string]any{"values": []any{1.0, 2.0}},
+	})
+
+	snapshot := n.Snapshot()
+	if _, err := n.UpdateAttribute("name", "Renamed"); err != nil {
+		t.Fatal(err)
+	}
+	n.AddComponent("RESTFUL-1")
+	snapshot["nested"].(map[string]any)["values"].([]any)[0] = 42.0
+
+	if snapshot["name"] != "Node" || len(snapshot["components"].([]string)) != 0 {
+		t.Fatalf("snapshot is expected not to be affected by updates, but got %v", snapshot)
+	}
+	if values := n.GetParam("nested").(map[string]any)["values"].([]any); values[0] != 1.0 {
+		t.Fatalf("node is expected not to be affected by changes of a snapshot, but got %v", values)
+	}
+}
+
+func TestNodeVersion(t *testing.T) {
+	n := NewNode(map[string]any{"_id": "BaseNode-1", "name": "Node"})
+	version := n.Version()
+
+	_, current, err := n.CompareAndUpdateAttribute("name", "v1", version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != version+1 {
+		t.Fatalf("version is expected to be raised to %v, but got %v", version+1, current)
+	}
+
+	// A writer holding the old version loses
+	_, _, err = n.CompareAndUpdateAttribute("name", "v2", version)
+	var conflict *VersionConflictError
+	if !errors.As(err, &conflict) || !errors.Is(err, ErrVersionConflict) || conflict.Current != current {
+		t.Fatalf("update of an old version is expected to conflict at version %v, but got %v", current, err)
+	}
+	if n.GetParam("name") != "v1" {
+		t.Fatalf("conflicting update is expected not to be applied, but name is %v", n.GetParam("name"))
+	}
+}
+
+// TestNodeConcurrency updates, reads and snapshots a node concurrently. Run it with -race.
+func TestNodeConcurrency(t *testing.T) {
+	n := NewNode(map[string]any{"_id": "BaseNode-1", "name": "Node", "count": 0})
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				n.UpdateAttribute("count", j)
+				compoID := fmt.Sprintf("RESTFUL-%d-%d", i, j)
+				n.AddComponent(compoID)
+				n.DeleteComponent(compoID)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				n.GetParam("components")
+				n.GetChildIDs()
+				n.GetCallTime()
+				n.Snapshot()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				childID := fmt.Sprintf("BaseNode-%d-%d", i, j)
+				n.AddChild(childID)
+				n.RemoveChild(childID)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if version := n.Version(); version != 4*100*3 {
+		t.Fatalf("every update is expected to raise the version, but version is %v", version)
+	}
+	if components := n.GetParam("components").([]string); len(components) != 0 {
+		t.Fatalf("components are expected to be deleted, but got %v", components)
+	}
+}
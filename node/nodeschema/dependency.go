@@ -0,0 +1,214 @@
+package nodeschema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+)
+
+// ErrSchemaInUse is returned by DeleteSchema when other schemas or nodes still depend on the schema.
+var ErrSchemaInUse = errors.New("schema is in use")
+
+// ListSchemas lists all registered schemas sorted by name.
+func (sm *SchemaManager) ListSchemas() ([]*SchemaDefinition, error) {
+	return sm.ListSchemasCtx(context.Background())
+}
+
+// ListSchemasCtx lists all registered schemas sorted by name with context.
+func (sm *SchemaManager) ListSchemasCtx(ctx context.Context) ([]*SchemaDefinition, error) {
+	records, err := sm.repo.ReadAll(ctx, "nodeschema", map[string]any{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schemas from repository: %v", err)
+	}
+
+	schemas := make([]*SchemaDefinition, 0, len(records))
+	for _, record := range records {
+		name, _ := record["name"].(string)
+		schema, err := sm.LoadSchema(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load schema %s: %v", name, err)
+		}
+		schemas = append(schemas, schema)
+	}
+
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].Name < schemas[j].Name })
+	return schemas, nil
+}
+
+// DependencyGraph returns, for every registered schema, the names of the schemas it extends or refers to.
+func (sm *SchemaManager) DependencyGraph() (map[string][]string, error) {
+	return sm.DependencyGraphCtx(context.Background())
+}
+
+// DependencyGraphCtx returns the dependency graph of all registered schemas with context.
+func (sm *SchemaManager) DependencyGraphCtx(ctx context.Context) (map[string][]string, error) {
+	records, err := sm.repo.ReadAll(ctx, "nodeschema", map[string]any{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schemas from repository: %v", err)
+	}
+
+	graph := make(map[string][]string, len(records))
+	for _, record := range records {
+		name, _ := record["name"].(string)
+		graph[name] = infoDependencies(record)
+	}
+	return graph, nil
+}
+
+// GetDependencies returns the names of the schemas a schema extends or refers to directly.
+func (sm *SchemaManager) GetDependencies(schemaName string) ([]string, error) {
+	return sm.GetDependenciesCtx(context.Background(), schemaName)
+}
+
+// GetDependenciesCtx returns the names of the schemas a schema depends on directly with context.
+func (sm *SchemaManager) GetDependenciesCtx(ctx context.Context, schemaName string) ([]string, error) {
+	graph, err := sm.DependencyGraphCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deps, ok := graph[schemaName]
+	if !ok {
+		return nil, fmt.Errorf("schema %s does not exist", schemaName)
+	}
+	return deps, nil
+}
+
+// GetDependents returns the names of the schemas extending or referring to a schema, directly or transitively.
+func (sm *SchemaManager) GetDependents(schemaName string) ([]string, error) {
+	return sm.GetDependentsCtx(context.Background(), schemaName)
+}
+
+// GetDependentsCtx returns the names of the schemas depending on a schema with context.
+func (sm *SchemaManager) GetDependentsCtx(ctx context.Context, schemaName string) ([]string, error) {
+	graph, err := sm.DependencyGraphCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := graph[schemaName]; !ok {
+		return nil, fmt.Errorf("schema %s does not exist", schemaName)
+	}
+	return dependentsOf(graph, schemaName), nil
+}
+
+// DeleteSchema deletes a schema from cache and repository.
+// Deletion is refused with ErrSchemaInUse while other schemas depend on the schema or nodes of the schema exist,
+// unless force is true. Cached schemas depending on a deleted schema are invalidated as well,
+// and will fail to load until the deleted schema is registered again.
+func (sm *SchemaManager) DeleteSchema(schemaName string, force bool) error {
+	return sm.DeleteSchemaCtx(context.Background(), schemaName, force)
+}
+
+// DeleteSchemaCtx deletes a schema from cache and repository with context.
+func (sm *SchemaManager) DeleteSchemaCtx(ctx context.Context, schemaName string, force bool) error {
+	graph, err := sm.DependencyGraphCtx(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := graph[schemaName]; !ok {
+		return fmt.Errorf("schema %s does not exist", schemaName)
+	}
+	dependents := dependentsOf(graph, schemaName)
+
+	if !force {
+		if len(dependents) > 0 {
+			return fmt.Errorf("%w: schema %s is depended on by schemas %v", ErrSchemaInUse, schemaName, dependents)
+		}
+		nodeNum, err := sm.repo.Count(ctx, "node", nodeFilterOf(schemaName))
+		if err != nil {
+			return fmt.Errorf("failed to count nodes of schema %s: %v", schemaName, err)
+		}
+		if nodeNum > 0 {
+			return fmt.Errorf("%w: %d nodes of schema %s exist", ErrSchemaInUse, nodeNum, schemaName)
+		}
+	}
+
+	if err := sm.repo.Delete(ctx, "nodeschema", map[string]any{"name": schemaName}); err != nil {
+		return fmt.Errorf("failed to delete schema %s from repository: %v", schemaName, err)
+	}
+
+	sm.invalidate(append(dependents, schemaName)...)
+	return nil
+}
+
+// invalidate removes schemas from cache.
+func (sm *SchemaManager) invalidate(schemaNames ...string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	for _, name := range schemaNames {
+		delete(sm.cache, name)
+	}
+}
+
+// nodeFilterOf builds the repository filter matching nodes of a schema, whose IDs are prefixed by the schema name.
+func nodeFilterOf(schemaName string) map[string]any {
+	return map[string]any{"_id": map[string]any{"$regex": "^" + regexp.QuoteMeta(schemaName) + "-"}}
+}
+
+// dependentsOf collects the schemas depending on a schema, directly or transitively, sorted by name.
+func dependentsOf(graph map[string][]string, schemaName string) []string {
+	reversed := make(map[string][]string)
+	for name, deps := range graph {
+		for _, dep := range deps {
+			reversed[dep] = append(reversed[dep], name)
+		}
+	}
+
+	visited := map[string]bool{schemaName: true}
+	queue := []string{schemaName}
+	dependents := make([]string, 0)
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dependent := range reversed[current] {
+			if !visited[dependent] {
+				visited[dependent] = true
+				dependents = append(dependents, dependent)
+				queue = append(queue, dependent)
+			}
+		}
+	}
+
+	sort.Strings(dependents)
+	return dependents
+}
+
+// infoDependencies lists the schemas a native schema info or record extends or refers to.
+func infoDependencies(info map[string]any) []string {
+	deps := make([]string, 0)
+	if extends, ok := info["extends"].(string); ok && extends != "" {
+		deps = append(deps, extends)
+	}
+
+	var walk func(fields map[string]any)
+	var walkField func(field map[string]any)
+	walkField = func(field map[string]any) {
+		if ref, ok := field["ref"].(string); ok && ref != "" {
+			deps = append(deps, ref)
+		} else if t, ok := field["type"].(string); ok && t != "" && !basicTypes[t] && t != "object" {
+			deps = append(deps, t)
+		}
+		if nested, ok := field["fields"].(map[string]any); ok {
+			walk(nested)
+		}
+		if item, ok := field["item"].(map[string]any); ok {
+			walkField(item)
+		}
+	}
+	walk = func(fields map[string]any) {
+		for _, fieldRaw := range fields {
+			if field, ok := fieldRaw.(map[string]any); ok {
+				walkField(field)
+			}
+		}
+	}
+	if fields, ok := info["fields"].(map[string]any); ok {
+		walk(fields)
+	}
+
+	slices.Sort(deps)
+	return slices.Compact(deps)
+}
@@ -0,0 +1,84 @@
+package nodeschema
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSchemaDependencies(t *testing.T) {
+	schemaMgr := newTestSchemaManager(t)
+
+	// register a schema referring to BaseNode by a field
+	if _, err := schemaMgr.RegisterSchema(map[string]any{
+		"name": "Link",
+		"fields": map[string]any{
+			"target": map[string]any{"type": "BaseNode"},
+		},
+	}); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	schemas, err := schemaMgr.ListSchemas()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	names := make([]string, 0, len(schemas))
+	for _, schema := range schemas {
+		names = append(names, schema.Name)
+	}
+	if !slices.Equal(names, []string{"BaseNode", "ExtendNode", "Link", "MongoDocument"}) {
+		t.Fatalf("unexpected schema list: %v", names)
+	}
+
+	deps, err := schemaMgr.GetDependencies("Link")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !slices.Equal(deps, []string{"BaseNode"}) {
+		t.Fatalf("Link is expected to depend on BaseNode, but depends on %v", deps)
+	}
+
+	dependents, err := schemaMgr.GetDependents("MongoDocument")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !slices.Equal(dependents, []string{"BaseNode", "ExtendNode", "Link"}) {
+		t.Fatalf("unexpected dependents of MongoDocument: %v", dependents)
+	}
+}
+
+func TestDeleteSchema(t *testing.T) {
+	schemaMgr := newTestSchemaManager(t)
+
+	// schemas having dependents cannot be deleted
+	if err := schemaMgr.DeleteSchema("BaseNode", false); !errors.Is(err, ErrSchemaInUse) {
+		t.Fatalf("deleting BaseNode is expected to be refused, but got %v", err)
+	}
+
+	// schemas having nodes cannot be deleted
+	if _, err := schemaMgr.repo.Create(context.Background(), "node", map[string]any{
+		"_id":  "ExtendNode-6c1b1c52-6f0e-4d59-9a55-4b4c34e1c2f1",
+		"name": "Extend Node",
+	}); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := schemaMgr.DeleteSchema("ExtendNode", false); !errors.Is(err, ErrSchemaInUse) {
+		t.Fatalf("deleting ExtendNode is expected to be refused, but got %v", err)
+	}
+
+	// forced deletion invalidates dependents
+	if err := schemaMgr.DeleteSchema("BaseNode", true); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if schemaMgr.HasSchema("BaseNode") {
+		t.Fatalf("BaseNode is expected to be deleted")
+	}
+	if schemaMgr.HasSchema("ExtendNode") {
+		t.Fatalf("ExtendNode is expected not to be loadable without its base schema")
+	}
+	if !schemaMgr.HasSchema("MongoDocument") {
+		t.Fatalf("MongoDocument is expected to be kept")
+	}
+}
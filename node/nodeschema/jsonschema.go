@@ -0,0 +1,507 @@
+package nodeschema
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// JSONSchemaDialect is the JSON Schema draft that ExportJSONSchema produces and ImportJSONSchema accepts.
+const JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+const defsPrefix = "#/$defs/"
+
+var (
+	// nativeToJSONTypes maps basic native field types to JSON Schema types.
+	nativeToJSONTypes = map[string]string{
+		"string":  "string",
+		"int":     "integer",
+		"float64": "number",
+		"bool":    "boolean",
+	}
+
+	// jsonToNativeTypes maps JSON Schema types to basic native field types.
+	jsonToNativeTypes = map[string]string{
+		"string":  "string",
+		"integer": "int",
+		"number":  "float64",
+		"boolean": "bool",
+	}
+)
+
+type schemaExporter struct {
+	ctx     context.Context
+	sm      *SchemaManager
+	flatten bool
+	defs    map[string]any
+}
+
+// ExportJSONSchema exports a registered schema as a JSON Schema draft 2020-12 document.
+// If flatten is true, fields inherited through extends are inlined into the properties of the schema.
+// Otherwise the inheritance is kept as allOf referencing the base schema, which is declared in $defs.
+// Schemas referenced by fields are always declared in $defs.
+func (sm *SchemaManager) ExportJSONSchema(schemaName string, flatten bool) (map[string]any, error) {
+	return sm.ExportJSONSchemaCtx(context.Background(), schemaName, flatten)
+}
+
+// ExportJSONSchemaCtx exports a registered schema as a JSON Schema draft 2020-12 document with context.
+func (sm *SchemaManager) ExportJSONSchemaCtx(ctx context.Context, schemaName string, flatten bool) (map[string]any, error) {
+	e := &schemaExporter{
+		ctx:     ctx,
+		sm:      sm,
+		flatten: flatten,
+		defs:    make(map[string]any),
+	}
+
+	schema, err := sm.LoadSchema(e.ctx, schemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := e.exportSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	doc["$schema"] = JSONSchemaDialect
+	if len(e.defs) > 0 {
+		doc["$defs"] = e.defs
+	}
+	return doc, nil
+}
+
+func (e *schemaExporter) exportSchema(schema *SchemaDefinition) (map[string]any, error) {
+	if e.flatten || schema.Extends == "" {
+		body, err := e.exportObject(schema.Fields)
+		if err != nil {
+			return nil, err
+		}
+		body["title"] = schema.Name
+		return body, nil
+	}
+
+	if err := e.declare(schema.Extends); err != nil {
+		return nil, err
+	}
+	own, err := e.exportObject(schema.own)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"title": schema.Name,
+		"allOf": []any{
+			map[string]any{"$ref": defsPrefix + schema.Extends},
+			own,
+		},
+	}, nil
+}
+
+// declare adds a referenced schema to $defs if it has not been declared yet.
+func (e *schemaExporter) declare(schemaName string) error {
+	if _, declared := e.defs[schemaName]; declared {
+		return nil
+	}
+	e.defs[schemaName] = nil // mark as visiting to stop recursive references
+
+	schema, err := e.sm.LoadSchema(e.ctx, schemaName)
+	if err != nil {
+		return fmt.Errorf("failed to load referenced schema %s: %v", schemaName, err)
+	}
+	def, err := e.exportSchema(schema)
+	if err != nil {
+		return err
+	}
+	e.defs[schemaName] = def
+	return nil
+}
+
+func (e *schemaExporter) exportObject(fields map[string]*FieldDefinition) (map[string]any, error) {
+	properties := make(map[string]any, len(fields))
+	required := make([]string, 0)
+	for name, def := range fields {
+		property, err := e.exportField(def)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export field %s: %v", name, err)
+		}
+		properties[name] = property
+		if def.Required {
+			required = append(required, name)
+		}
+	}
+
+	object := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		object["required"] = required
+	}
+	return object, nil
+}
+
+func (e *schemaExporter) exportField(def *FieldDefinition) (map[string]any, error) {
+	if ref := referencedSchema(def); ref != "" {
+		if err := e.declare(ref); err != nil {
+			return nil, err
+		}
+		return map[string]any{"$ref": defsPrefix + ref}, nil
+	}
+
+	if jsonType, ok := nativeToJSONTypes[def.Type]; ok {
+		return map[string]any{"type": jsonType}, nil
+	}
+
+	switch def.Type {
+	case "object":
+		return e.exportObject(def.Fields)
+
+	case "array":
+		property := map[string]any{"type": "array"}
+		if def.Item != nil {
+			item, err := e.exportField(def.Item)
+			if err != nil {
+				return nil, err
+			}
+			property["items"] = item
+		}
+		return property, nil
+
+	case "map":
+		property := map[string]any{"type": "object", "additionalProperties": true}
+		if def.Item != nil {
+			item, err := e.exportField(def.Item)
+			if err != nil {
+				return nil, err
+			}
+			property["additionalProperties"] = item
+		}
+		return property, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported type %s", def.Type)
+	}
+}
+
+// referencedSchema returns the name of the schema a field refers to, or an empty string for other fields.
+func referencedSchema(def *FieldDefinition) string {
+	if def.Ref != "" {
+		return def.Ref
+	}
+	if basicTypes[def.Type] || def.Type == "object" {
+		return ""
+	}
+	return def.Type
+}
+
+// ImportJSONSchema converts a JSON Schema draft 2020-12 document into schema infos accepted by RegisterSchema.
+// The root schema is named by name, or by its title if name is empty.
+// Schemas declared in $defs are converted too, named by their keys,
+// and every schema is placed after the schemas it extends or refers to.
+func ImportJSONSchema(doc map[string]any, name string) ([]map[string]any, error) {
+	if name == "" {
+		name, _ = doc["title"].(string)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("JSON schema has no title and no name is provided")
+	}
+	if dialect, ok := doc["$schema"].(string); ok && dialect != JSONSchemaDialect {
+		return nil, fmt.Errorf("JSON schema dialect %s is not supported", dialect)
+	}
+
+	infos := make(map[string]map[string]any)
+	if defsRaw, ok := doc["$defs"]; ok {
+		defs, ok := defsRaw.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("$defs of JSON schema must be an object")
+		}
+		for defName, defRaw := range defs {
+			def, ok := defRaw.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("definition %s of JSON schema must be an object", defName)
+			}
+			info, err := importSchema(defName, def)
+			if err != nil {
+				return nil, err
+			}
+			infos[defName] = info
+		}
+	}
+	if _, exists := infos[name]; exists {
+		return nil, fmt.Errorf("schema name %s is declared both as root and in $defs", name)
+	}
+	info, err := importSchema(name, doc)
+	if err != nil {
+		return nil, err
+	}
+	infos[name] = info
+
+	return sortByDependencies(infos)
+}
+
+// RegisterJSONSchema imports a JSON Schema document and registers the resulting schemas.
+// Schemas in $defs that have already been registered are skipped, the root schema must be new.
+// It returns the IDs of the registered schemas by their names.
+func (sm *SchemaManager) RegisterJSONSchema(doc map[string]any, name string) (map[string]string, error) {
+	return sm.RegisterJSONSchemaCtx(context.Background(), doc, name)
+}
+
+// RegisterJSONSchemaCtx imports a JSON Schema document and registers the resulting schemas with context.
+func (sm *SchemaManager) RegisterJSONSchemaCtx(ctx context.Context, doc map[string]any, name string) (map[string]string, error) {
+	infos, err := ImportJSONSchema(doc, name)
+	if err != nil {
+		return nil, err
+	}
+
+	rootName := name
+	if rootName == "" {
+		rootName, _ = doc["title"].(string)
+	}
+
+	IDs := make(map[string]string, len(infos))
+	for _, info := range infos {
+		schemaName := info["name"].(string)
+		if schemaName != rootName && sm.HasSchemaCtx(ctx, schemaName) {
+			continue
+		}
+		ID, err := sm.RegisterSchemaCtx(ctx, info)
+		if err != nil {
+			return IDs, fmt.Errorf("failed to register imported schema %s: %v", schemaName, err)
+		}
+		IDs[schemaName] = ID
+	}
+	return IDs, nil
+}
+
+func importSchema(name string, doc map[string]any) (map[string]any, error) {
+	info := map[string]any{
+		"name":   name,
+		"fields": map[string]any{},
+	}
+
+	// Inheritance is expressed as allOf holding one reference and any number of object schemas.
+	parts := []map[string]any{doc}
+	if allOfRaw, ok := doc["allOf"]; ok {
+		allOf, ok := allOfRaw.([]any)
+		if !ok {
+			return nil, fmt.Errorf("schema %s: allOf must be an array", name)
+		}
+		for _, partRaw := range allOf {
+			part, ok := partRaw.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("schema %s: items of allOf must be objects", name)
+			}
+			if ref, ok := part["$ref"].(string); ok {
+				if _, exists := info["extends"]; exists {
+					return nil, fmt.Errorf("schema %s: only one base schema can be referenced in allOf", name)
+				}
+				base, err := refName(ref)
+				if err != nil {
+					return nil, fmt.Errorf("schema %s: %v", name, err)
+				}
+				info["extends"] = base
+				continue
+			}
+			parts = append(parts, part)
+		}
+	}
+	if _, ok := doc["$ref"]; ok {
+		return nil, fmt.Errorf("schema %s: root $ref is not supported, use allOf to extend a schema", name)
+	}
+
+	fields := info["fields"].(map[string]any)
+	for _, part := range parts {
+		if t, ok := part["type"]; ok && t != "object" {
+			return nil, fmt.Errorf("schema %s: type must be object", name)
+		}
+		partFields, err := importProperties(part)
+		if err != nil {
+			return nil, fmt.Errorf("schema %s: %v", name, err)
+		}
+		for fieldName, field := range partFields {
+			fields[fieldName] = field
+		}
+	}
+	return info, nil
+}
+
+func importProperties(object map[string]any) (map[string]any, error) {
+	fields := make(map[string]any)
+	propertiesRaw, ok := object["properties"]
+	if !ok {
+		return fields, nil
+	}
+	properties, ok := propertiesRaw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("properties must be an object")
+	}
+
+	required := make(map[string]bool)
+	if requiredRaw, ok := object["required"].([]any); ok {
+		for _, r := range requiredRaw {
+			if s, ok := r.(string); ok {
+				required[s] = true
+			}
+		}
+	} else if requiredRaw, ok := object["required"].([]string); ok {
+		for _, s := range requiredRaw {
+			required[s] = true
+		}
+	}
+
+	for name, propertyRaw := range properties {
+		property, ok := propertyRaw.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("property %s must be an object", name)
+		}
+		field, err := importField(property)
+		if err != nil {
+			return nil, fmt.Errorf("property %s: %v", name, err)
+		}
+		if required[name] {
+			field["required"] = true
+		}
+		fields[name] = field
+	}
+	return fields, nil
+}
+
+func importField(property map[string]any) (map[string]any, error) {
+	if ref, ok := property["$ref"].(string); ok {
+		schemaName, err := refName(ref)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": schemaName}, nil
+	}
+
+	jsonType, err := propertyType(property)
+	if err != nil {
+		return nil, err
+	}
+
+	if nativeType, ok := jsonToNativeTypes[jsonType]; ok {
+		return map[string]any{"type": nativeType}, nil
+	}
+
+	switch jsonType {
+	case "array":
+		field := map[string]any{"type": "array"}
+		if itemsRaw, ok := property["items"]; ok {
+			items, ok := itemsRaw.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("items must be an object")
+			}
+			item, err := importField(items)
+			if err != nil {
+				return nil, fmt.Errorf("items: %v", err)
+			}
+			delete(item, "required")
+			field["item"] = item
+		}
+		return field, nil
+
+	case "object":
+		if _, ok := property["properties"]; ok {
+			nested, err := importProperties(property)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]any{"type": "object", "fields": nested}, nil
+		}
+		if additional, ok := property["additionalProperties"].(map[string]any); ok {
+			item, err := importField(additional)
+			if err != nil {
+				return nil, fmt.Errorf("additionalProperties: %v", err)
+			}
+			return map[string]any{"type": "map", "item": item}, nil
+		}
+		return map[string]any{"type": "map"}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported type %s", jsonType)
+	}
+}
+
+// propertyType resolves the JSON type of a property, accepting nullable type lists such as ["string", "null"].
+func propertyType(property map[string]any) (string, error) {
+	switch t := property["type"].(type) {
+	case string:
+		return t, nil
+	case []any:
+		var types []string
+		for _, item := range t {
+			if s, ok := item.(string); ok && s != "null" {
+				types = append(types, s)
+			}
+		}
+		if len(types) != 1 {
+			return "", fmt.Errorf("type %v is not supported", t)
+		}
+		return types[0], nil
+	case nil:
+		if _, ok := property["properties"]; ok {
+			return "object", nil
+		}
+		if _, ok := property["items"]; ok {
+			return "array", nil
+		}
+		return "", fmt.Errorf("missing type")
+	default:
+		return "", fmt.Errorf("type %v is not supported", t)
+	}
+}
+
+func refName(ref string) (string, error) {
+	if !strings.HasPrefix(ref, defsPrefix) || len(ref) == len(defsPrefix) {
+		return "", fmt.Errorf("reference %s is not supported, only local references into $defs are", ref)
+	}
+	return strings.TrimPrefix(ref, defsPrefix), nil
+}
+
+// sortByDependencies orders schema infos so that extended and referenced schemas come first.
+// Dependencies on schemas outside infos are expected to be registered already.
+func sortByDependencies(infos map[string]map[string]any) ([]map[string]any, error) {
+	names := make([]string, 0, len(infos))
+	for name := range infos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := make(map[string]int, len(infos))
+	sorted := make([]map[string]any, 0, len(infos))
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch states[name] {
+		case visiting:
+			return fmt.Errorf("schema %s depends on itself", name)
+		case visited:
+			return nil
+		}
+		states[name] = visiting
+		for _, dep := range infoDependencies(infos[name]) {
+			if _, local := infos[dep]; local && dep != name {
+				if err := visit(dep); err != nil {
+					return err
+				}
+			}
+		}
+		states[name] = visited
+		sorted = append(sorted, infos[name])
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
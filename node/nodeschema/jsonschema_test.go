@@ -0,0 +1,148 @@
+package nodeschema
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/world-in-progress/yggdrasil/db/memory"
+)
+
+func newTestSchemaManager(t *testing.T) *SchemaManager {
+	file, err := os.Open("../node_schema_test.json")
+	if err != nil {
+		t.Fatalf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	var nodeSchemas map[string]any
+	if err := json.NewDecoder(file).Decode(&nodeSchemas); err != nil {
+		t.Fatalf("error decoding json: %v", err)
+	}
+
+	schemaMgr := NewSchemaManager(memory.NewMemoryRepository())
+	for _, schema := range nodeSchemas["schemas"].([]any) {
+		if _, err := schemaMgr.RegisterSchema(schema.(map[string]any)); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	return schemaMgr
+}
+
+func TestExportJSONSchema(t *testing.T) {
+	schemaMgr := newTestSchemaManager(t)
+
+	// flattened export inlines inherited fields
+	doc, err := schemaMgr.ExportJSONSchema("ExtendNode", true)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if doc["$schema"] != JSONSchemaDialect || doc["title"] != "ExtendNode" {
+		t.Fatalf("unexpected header of flattened schema: %v", doc)
+	}
+	properties := doc["properties"].(map[string]any)
+	for _, field := range []string{"_id", "name", "parent", "components", "time"} {
+		if _, ok := properties[field]; !ok {
+			t.Fatalf("flattened schema is expected to have property %s, but properties are %v", field, properties)
+		}
+	}
+	if required := doc["required"].([]string); len(required) != 1 || required[0] != "name" {
+		t.Fatalf("flattened schema is expected to require name, but requires %v", required)
+	}
+	if items := properties["components"].(map[string]any)["items"]; items.(map[string]any)["type"] != "string" {
+		t.Fatalf("items of components are expected to be strings, but are %v", items)
+	}
+
+	// export keeping inheritance references base schemas through allOf
+	doc, err = schemaMgr.ExportJSONSchema("ExtendNode", false)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	allOf := doc["allOf"].([]any)
+	if ref := allOf[0].(map[string]any)["$ref"]; ref != "#/$defs/BaseNode" {
+		t.Fatalf("base reference is expected to be #/$defs/BaseNode, but is %v", ref)
+	}
+	if own := allOf[1].(map[string]any)["properties"].(map[string]any); len(own) != 1 {
+		t.Fatalf("own properties are expected to hold time only, but are %v", own)
+	}
+	defs := doc["$defs"].(map[string]any)
+	if _, ok := defs["MongoDocument"]; !ok {
+		t.Fatalf("the whole extends chain is expected in $defs, but $defs are %v", defs)
+	}
+}
+
+func TestImportJSONSchema(t *testing.T) {
+	schemaMgr := newTestSchemaManager(t)
+
+	doc, err := schemaMgr.ExportJSONSchema("ExtendNode", false)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// import the exported document as a new schema
+	IDs, err := schemaMgr.RegisterJSONSchema(doc, "ImportedNode")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(IDs) != 1 || IDs["ImportedNode"] == "" {
+		t.Fatalf("only ImportedNode is expected to be registered, but registered schemas are %v", IDs)
+	}
+	if err := schemaMgr.Validate("ImportedNode", map[string]any{"name": "Imported", "time": "now"}); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := schemaMgr.Validate("ImportedNode", map[string]any{"time": "now"}); err == nil {
+		t.Fatalf("inherited required field name is expected to be checked")
+	}
+
+	// import a standalone document having nested objects, maps and references
+	standalone := map[string]any{
+		"$schema":  JSONSchemaDialect,
+		"title":    "Station",
+		"type":     "object",
+		"required": []any{"location"},
+		"properties": map[string]any{
+			"location": map[string]any{"$ref": "#/$defs/Point"},
+			"tags": map[string]any{
+				"type":                 "object",
+				"additionalProperties": map[string]any{"type": "string"},
+			},
+			"readings": map[string]any{
+				"type":  "array",
+				"items": map[string]any{"type": []any{"number", "null"}},
+			},
+		},
+		"$defs": map[string]any{
+			"Point": map[string]any{
+				"type":     "object",
+				"required": []any{"x", "y"},
+				"properties": map[string]any{
+					"x": map[string]any{"type": "number"},
+					"y": map[string]any{"type": "number"},
+				},
+			},
+		},
+	}
+	infos, err := ImportJSONSchema(standalone, "")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(infos) != 2 || infos[0]["name"] != "Point" || infos[1]["name"] != "Station" {
+		t.Fatalf("referenced schema Point is expected before Station, but infos are %v", infos)
+	}
+	if _, err := schemaMgr.RegisterJSONSchema(standalone, ""); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	station := map[string]any{
+		"location": map[string]any{"x": 1.0, "y": 2.0},
+		"tags":     map[string]any{"kind": "weather"},
+		"readings": []any{0.5, 1.5},
+	}
+	if err := schemaMgr.Validate("Station", station); err != nil {
+		t.Fatalf("%v", err)
+	}
+	station["location"] = map[string]any{"x": 1.0}
+	if err := schemaMgr.Validate("Station", station); err == nil {
+		t.Fatalf("required field y of referenced schema Point is expected to be checked")
+	}
+}
@@ -35,12 +35,15 @@ type (
 		Name    string
 		Extends string
 		Fields  map[string]*FieldDefinition
+
+		own map[string]*FieldDefinition // fields declared by the schema itself, without inherited ones
 	}
 
 	SchemaManager struct {
-		repo  nodeinterface.IRepository
-		cache map[string]*SchemaDefinition
-		mu    sync.RWMutex
+		repo    nodeinterface.IRepository
+		records map[string]map[string]any // schema records read before the repository, see ValidateSchemas
+		cache   map[string]*SchemaDefinition
+		mu      sync.RWMutex
 	}
 )
 
@@ -52,8 +55,11 @@ func NewSchemaManager(repo nodeinterface.IRepository) *SchemaManager {
 }
 
 func (sm *SchemaManager) RegisterSchema(schemaInfo map[string]any) (string, error) {
-	ctx := context.Background()
+	return sm.RegisterSchemaCtx(context.Background(), schemaInfo)
+}
 
+// RegisterSchemaCtx registers a schema to cache and repository with context.
+func (sm *SchemaManager) RegisterSchemaCtx(ctx context.Context, schemaInfo map[string]any) (string, error) {
 	// Check if schema info is empty.
 	if len(schemaInfo) == 0 {
 		return "", fmt.Errorf("schemaInfo cannot be empty")
@@ -88,7 +94,7 @@ func (sm *SchemaManager) RegisterSchema(schemaInfo map[string]any) (string, erro
 		if !ok {
 			return "", fmt.Errorf("extends of schema info must be a string")
 		}
-		if extends != "" && !sm.HasSchema(extends) {
+		if extends != "" && !sm.HasSchemaCtx(ctx, extends) {
 			return "", fmt.Errorf("base schema %s does not exist", extends)
 		}
 	}
@@ -114,6 +120,7 @@ func (sm *SchemaManager) RegisterSchema(schemaInfo map[string]any) (string, erro
 	if err := ParseFields(rawFields, fields, nil); err != nil {
 		return "", err
 	}
+	own := maps.Clone(fields)
 
 	// Second parsing: process inheritance and complex types.
 	if extends != "" {
@@ -129,15 +136,18 @@ func (sm *SchemaManager) RegisterSchema(schemaInfo map[string]any) (string, erro
 	}
 
 	// Write schema to cache.
+	schemaID := uuid.New().String()
 	sm.mu.Lock()
 	sm.cache[name] = &SchemaDefinition{
-		Name:   name,
-		Fields: fields,
+		ID:      schemaID,
+		Name:    name,
+		Extends: extends,
+		Fields:  fields,
+		own:     own,
 	}
 	sm.mu.Unlock()
 
 	// Write schema to repository.
-	schemaID := uuid.New().String()
 	record := map[string]any{
 		"_id":     schemaID,
 		"name":    name,
@@ -154,6 +164,11 @@ func (sm *SchemaManager) RegisterSchema(schemaInfo map[string]any) (string, erro
 
 // GetSchemaID get the ID of a specific shcema by its name
 func (sm *SchemaManager) GetSchemaID(schemaName string) (string, error) {
+	return sm.GetSchemaIDCtx(context.Background(), schemaName)
+}
+
+// GetSchemaIDCtx get the ID of a specific shcema by its name with context.
+func (sm *SchemaManager) GetSchemaIDCtx(ctx context.Context, schemaName string) (string, error) {
 	// Find in cache.
 	sm.mu.RLock()
 	if cached, ok := sm.cache[schemaName]; ok {
@@ -163,8 +178,7 @@ func (sm *SchemaManager) GetSchemaID(schemaName string) (string, error) {
 	sm.mu.RUnlock()
 
 	// Find in repository.
-	ctx := context.Background()
-	record, err := sm.repo.ReadOne(ctx, "nodeschema", map[string]any{"name": schemaName})
+	record, err := sm.readSchema(ctx, schemaName)
 	if err != nil {
 		return "", fmt.Errorf("failed to find schema having name '%s': %v", schemaName, err)
 	}
@@ -174,8 +188,12 @@ func (sm *SchemaManager) GetSchemaID(schemaName string) (string, error) {
 
 // GetSchema gets a specific schema by its ID.
 func (sm *SchemaManager) GetSchema(schemaID string) (*SchemaDefinition, error) {
+	return sm.GetSchemaCtx(context.Background(), schemaID)
+}
+
+// GetSchemaCtx gets a specific schema by its ID with context.
+func (sm *SchemaManager) GetSchemaCtx(ctx context.Context, schemaID string) (*SchemaDefinition, error) {
 	// Query schema from repository.
-	ctx := context.Background()
 	record, err := sm.repo.ReadOne(ctx, "nodeschema", map[string]any{"_id": schemaID})
 	if err != nil {
 		return nil, fmt.Errorf("cannot find schema by ID %s: %v", schemaID, err)
@@ -184,9 +202,10 @@ func (sm *SchemaManager) GetSchema(schemaID string) (*SchemaDefinition, error) {
 		return nil, fmt.Errorf("schema having ID %s does not exist", schemaID)
 	}
 
+	ID, _ := record["_id"].(string)
 	name, _ := record["name"].(string)
 	extends, _ := record["extends"].(string)
-	fieldsRaw, _ := record["field"].(map[string]any)
+	fieldsRaw, _ := record["fields"].(map[string]any)
 
 	sm.mu.RLock()
 	if cached, ok := sm.cache[name]; ok {
@@ -209,6 +228,7 @@ func (sm *SchemaManager) GetSchema(schemaID string) (*SchemaDefinition, error) {
 	if err := ParseFields(rawFields, fields, nil); err != nil {
 		return nil, err
 	}
+	own := maps.Clone(fields)
 
 	// Second parsing: process inheritance and complex types.
 	if extends != "" {
@@ -225,8 +245,11 @@ func (sm *SchemaManager) GetSchema(schemaID string) (*SchemaDefinition, error) {
 
 	// Write schema to cache.
 	schema := &SchemaDefinition{
-		Name:   name,
-		Fields: fields,
+		ID:      ID,
+		Name:    name,
+		Extends: extends,
+		Fields:  fields,
+		own:     own,
 	}
 	sm.mu.Lock()
 	sm.cache[name] = schema
@@ -235,6 +258,53 @@ func (sm *SchemaManager) GetSchema(schemaID string) (*SchemaDefinition, error) {
 	return schema, nil
 }
 
+// ValidateSchemas validates schema records as if they were registered, and returns a manager loading schemas from
+// them before the repository, to validate data against schemas not registered yet. Nothing is written to the
+// repository, and schemas must not be registered through the returned manager.
+func (sm *SchemaManager) ValidateSchemas(records []map[string]any) (*SchemaManager, error) {
+	return sm.ValidateSchemasCtx(context.Background(), records)
+}
+
+// ValidateSchemasCtx validates schema records as if they were registered with context.
+func (sm *SchemaManager) ValidateSchemasCtx(ctx context.Context, records []map[string]any) (*SchemaManager, error) {
+	validator := &SchemaManager{
+		repo:    sm.repo,
+		records: make(map[string]map[string]any, len(records)),
+		cache:   make(map[string]*SchemaDefinition),
+	}
+	for _, record := range records {
+		name, ok := record["name"].(string)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("schema name must be a non-empty string")
+		}
+		if _, ok := validator.records[name]; ok {
+			return nil, fmt.Errorf("schema name %s is duplicated", name)
+		}
+		validator.records[name] = record
+	}
+	for name := range validator.records {
+		// Schemas extending each other would be loaded endlessly
+		for visited, base := map[string]bool{}, name; base != ""; base, _ = validator.records[base]["extends"].(string) {
+			if visited[base] {
+				return nil, fmt.Errorf("schema %s extends itself", name)
+			}
+			visited[base] = true
+		}
+		if _, err := validator.LoadSchema(ctx, name); err != nil {
+			return nil, fmt.Errorf("schema %s is not valid: %v", name, err)
+		}
+	}
+	return validator, nil
+}
+
+// readSchema reads the record of a schema by its name.
+func (sm *SchemaManager) readSchema(ctx context.Context, schemaName string) (map[string]any, error) {
+	if record, ok := sm.records[schemaName]; ok {
+		return record, nil
+	}
+	return sm.repo.ReadOne(ctx, "nodeschema", map[string]any{"name": schemaName})
+}
+
 // LoadSchema loads a specific schema by its name.
 func (sm *SchemaManager) LoadSchema(ctx context.Context, schemaName string) (*SchemaDefinition, error) {
 	sm.mu.RLock()
@@ -245,7 +315,7 @@ func (sm *SchemaManager) LoadSchema(ctx context.Context, schemaName string) (*Sc
 	sm.mu.RUnlock()
 
 	// Query schema from repository.
-	record, err := sm.repo.ReadOne(ctx, "nodeschema", map[string]any{"name": schemaName})
+	record, err := sm.readSchema(ctx, schemaName)
 	if err != nil {
 		return nil, fmt.Errorf("cannot find schema %s: %v", schemaName, err)
 	}
@@ -253,9 +323,10 @@ func (sm *SchemaManager) LoadSchema(ctx context.Context, schemaName string) (*Sc
 		return nil, fmt.Errorf("schema %s does not exist", schemaName)
 	}
 
+	ID, _ := record["_id"].(string)
 	name, _ := record["name"].(string)
 	extends, _ := record["extends"].(string)
-	fieldsRaw, _ := record["field"].(map[string]any)
+	fieldsRaw, _ := record["fields"].(map[string]any)
 
 	fieldsJson, err := json.Marshal(fieldsRaw)
 	if err != nil {
@@ -271,6 +342,7 @@ func (sm *SchemaManager) LoadSchema(ctx context.Context, schemaName string) (*Sc
 	if err := ParseFields(rawFields, fields, nil); err != nil {
 		return nil, err
 	}
+	own := maps.Clone(fields)
 
 	// Second parsing: process inheritance and complex types.
 	if extends != "" {
@@ -287,8 +359,11 @@ func (sm *SchemaManager) LoadSchema(ctx context.Context, schemaName string) (*Sc
 
 	// Write schema to cache.
 	schema := &SchemaDefinition{
-		Name:   name,
-		Fields: fields,
+		ID:      ID,
+		Name:    name,
+		Extends: extends,
+		Fields:  fields,
+		own:     own,
 	}
 	sm.mu.Lock()
 	sm.cache[schemaName] = schema
@@ -298,19 +373,28 @@ func (sm *SchemaManager) LoadSchema(ctx context.Context, schemaName string) (*Sc
 }
 
 func (sm *SchemaManager) HasSchema(schemaName string) bool {
-	ctx := context.Background()
+	return sm.HasSchemaCtx(context.Background(), schemaName)
+}
+
+func (sm *SchemaManager) HasSchemaCtx(ctx context.Context, schemaName string) bool {
 	_, err := sm.LoadSchema(ctx, schemaName)
 	return err == nil
 }
 
 func (sm *SchemaManager) HasSchemaByID(schemaID string) bool {
-	ctx := context.Background()
+	return sm.HasSchemaByIDCtx(context.Background(), schemaID)
+}
+
+func (sm *SchemaManager) HasSchemaByIDCtx(ctx context.Context, schemaID string) bool {
 	_, err := sm.repo.ReadOne(ctx, "nodeschema", map[string]any{"_id": schemaID})
 	return err == nil
 }
 
 func (sm *SchemaManager) Validate(schemaName string, data map[string]any) error {
-	ctx := context.Background()
+	return sm.ValidateCtx(context.Background(), schemaName, data)
+}
+
+func (sm *SchemaManager) ValidateCtx(ctx context.Context, schemaName string, data map[string]any) error {
 	schema, err := sm.LoadSchema(ctx, schemaName)
 	if err != nil {
 		return err
@@ -319,7 +403,10 @@ func (sm *SchemaManager) Validate(schemaName string, data map[string]any) error
 }
 
 func (sm *SchemaManager) ValidateField(schemaName string, fieldName string, data any) error {
-	ctx := context.Background()
+	return sm.ValidateFieldCtx(context.Background(), schemaName, fieldName, data)
+}
+
+func (sm *SchemaManager) ValidateFieldCtx(ctx context.Context, schemaName string, fieldName string, data any) error {
 	schema, err := sm.LoadSchema(ctx, schemaName)
 	if err != nil {
 		return err
@@ -403,7 +490,7 @@ func ParseFields(rawFields map[string]json.RawMessage, fields map[string]*FieldD
 					return fmt.Errorf("field %s: item fields only allowed wity type 'object'", name)
 				}
 				fieldDef.Item.Fields = make(map[string]*FieldDefinition)
-				if err := ParseFields(itemDef.Fields, fieldDef.Fields, schemas); err != nil {
+				if err := ParseFields(itemDef.Fields, fieldDef.Item.Fields, schemas); err != nil {
 					return err
 				}
 			}
@@ -488,7 +575,10 @@ func (sm *SchemaManager) validateField(ctx context.Context, name string, value a
 	}
 
 	// If type of a field is a referenced schema, make recursively loading and validation.
-	if _, isSchema := sm.cache[def.Type]; isSchema || (!basicTypes[def.Type] && def.Type != "object" && def.Type != "array" && def.Type != "map") {
+	sm.mu.RLock()
+	_, isSchema := sm.cache[def.Type]
+	sm.mu.RUnlock()
+	if isSchema || (!basicTypes[def.Type] && def.Type != "object" && def.Type != "array" && def.Type != "map") {
 		schema, err := sm.LoadSchema(ctx, def.Type)
 		if err != nil {
 			return fmt.Errorf("failed to load referenced schema %s: %v", def.Type, err)
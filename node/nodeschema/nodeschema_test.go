@@ -1,6 +1,7 @@
 package nodeschema
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/spf13/viper"
+	"github.com/world-in-progress/yggdrasil/db/memory"
 	"github.com/world-in-progress/yggdrasil/db/mongo"
 )
 
@@ -48,7 +50,10 @@ func TestNodeSchema(t *testing.T) {
 	}
 
 	// init schema manager
-	repo := mongo.NewMongoRepository()
+	repo, err := mongo.NewMongoRepository()
+	if err != nil {
+		t.Fatal(err)
+	}
 	schemaMgr := NewSchemaManager(repo)
 
 	// register schemas
@@ -78,3 +83,75 @@ func TestNodeSchema(t *testing.T) {
 		t.Fatalf("%v", err)
 	}
 }
+
+func TestLoadSchemaFields(t *testing.T) {
+	repo := memory.NewMemoryRepository()
+	if _, err := NewSchemaManager(repo).RegisterSchema(map[string]any{
+		"name": "PointSet",
+		"fields": map[string]any{
+			"name": map[string]any{"type": "string", "required": true},
+			"points": map[string]any{
+				"type": "array",
+				"item": map[string]any{
+					"type":   "object",
+					"fields": map[string]any{"x": map[string]any{"type": "float64", "required": true}},
+				},
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A schema manager loads fields recorded by another one
+	schema, err := NewSchemaManager(repo).LoadSchema(context.Background(), "PointSet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	points, ok := schema.Fields["points"]
+	if !ok || schema.Fields["name"] == nil {
+		t.Fatalf("loaded schema is expected to have its fields, but got %v", schema.Fields)
+	}
+	if points.Fields != nil || points.Item == nil || points.Item.Fields["x"] == nil {
+		t.Fatalf("item fields are expected to be parsed into the item, but got %+v", points)
+	}
+}
+
+func TestValidateSchemas(t *testing.T) {
+	repo := memory.NewMemoryRepository()
+	sm := NewSchemaManager(repo)
+	if _, err := sm.RegisterSchema(map[string]any{
+		"name":   "Base",
+		"fields": map[string]any{"name": map[string]any{"type": "string", "required": true}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Records are validated with the schemas they extend, registered or not
+	validator, err := sm.ValidateSchemas([]map[string]any{
+		{"name": "Child", "extends": "Base", "fields": map[string]any{"rate": map[string]any{"type": "float64"}}},
+		{"name": "GrandChild", "extends": "Child", "fields": map[string]any{}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validator.Validate("GrandChild", map[string]any{"name": "Node", "rate": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := validator.Validate("GrandChild", map[string]any{"rate": 1.0}); err == nil {
+		t.Fatalf("data missing a required inherited field is expected to be invalid")
+	}
+	if count, _ := repo.Count(context.Background(), "nodeschema", map[string]any{}); count != 1 || sm.HasSchema("Child") {
+		t.Fatalf("validated schemas are not expected to be registered")
+	}
+
+	for _, records := range [][]map[string]any{
+		{{"name": "Orphan", "extends": "Missing", "fields": map[string]any{}}},
+		{{"name": "Invalid", "fields": map[string]any{"rate": map[string]any{}}}},
+		{{"name": "A", "extends": "B", "fields": map[string]any{}}, {"name": "B", "extends": "A", "fields": map[string]any{}}},
+		{{"name": "Twice", "fields": map[string]any{}}, {"name": "Twice", "fields": map[string]any{}}},
+	} {
+		if _, err := sm.ValidateSchemas(records); err == nil {
+			t.Fatalf("schemas %v are expected to be invalid", records)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package node
+
+import (
+	"context"
+	"fmt"
+)
+
+// Pin activates a node and keeps it in the runtime cache until it is unpinned or deleted, as well as its descendants
+// if recursive. Nodes are activated by batched reads, see Preload. Pinned nodes are pinned again once they are
+// activated after being invalidated by another tree, but nodes registered later under a pinned node are not pinned.
+func (t *Tree) Pin(ID string, recursive bool) error {
+	return t.PinCtx(context.Background(), ID, recursive)
+}
+
+// PinCtx pins a node, and its descendants if recursive, with context.
+func (t *Tree) PinCtx(ctx context.Context, ID string, recursive bool) error {
+	depth := 0
+	if recursive {
+		depth = -1
+	}
+	if _, err := t.preload(ctx, ID, depth, true); err != nil {
+		return fmt.Errorf("failed to pin node %s: %v", ID, err)
+	}
+	return nil
+}
+
+// Unpin makes a pinned node evictable again, as well as its active descendants if recursive.
+func (t *Tree) Unpin(ID string, recursive bool) {
+	t.pinned.Delete(ID)
+	t.cache.Unpin(ID)
+	if !recursive {
+		return
+	}
+	if node, ok := t.cache.Peek(ID); ok {
+		for _, childID := range node.GetChildIDs() {
+			t.Unpin(childID, true)
+		}
+	}
+}
+
+// IsPinned checks if a node is pinned.
+func (t *Tree) IsPinned(ID string) bool {
+	_, ok := t.pinned.Load(ID)
+	return ok
+}
+
+// Preload activates a node and its descendants down to depth levels below it, or all of them if depth is negative,
+// and returns the number of nodes activated. Each level is read from the repository at once, rather than node by node.
+// Nodes preloaded beyond the cache size are evicted as usual, unless they are pinned.
+func (t *Tree) Preload(rootID string, depth int) (int, error) {
+	return t.PreloadCtx(context.Background(), rootID, depth)
+}
+
+// PreloadCtx activates a node and its descendants down to depth levels below it with context.
+func (t *Tree) PreloadCtx(ctx context.Context, rootID string, depth int) (int, error) {
+	count, err := t.preload(ctx, rootID, depth, false)
+	if err != nil {
+		return count, fmt.Errorf("failed to preload node %s: %v", rootID, err)
+	}
+	return count, nil
+}
+
+// preload activates a subtree level by level, pinning its nodes if pin, and returns the number of nodes activated.
+func (t *Tree) preload(ctx context.Context, rootID string, depth int, pin bool) (int, error) {
+	// Read the root record if the root is inactive
+	records := make(map[string]map[string]any)
+	if _, ok := t.cache.Peek(rootID); !ok {
+		record, err := t.repo.ReadOne(ctx, "node", map[string]any{"_id": rootID})
+		if err != nil {
+			return 0, fmt.Errorf("cannot activate node not existing: %v", err)
+		}
+		records[rootID] = record
+	}
+
+	count, activated := 0, false
+	frontier := []string{rootID}
+	for level := 0; len(frontier) > 0; level++ {
+		// Read children records of the whole level
+		childRecords, err := t.repo.ReadAll(ctx, "node", map[string]any{"parent": map[string]any{"$in": frontier}})
+		if err != nil {
+			return count, fmt.Errorf("failed to find children of nodes: %v", err)
+		}
+		childIDs := make(map[string][]string)
+		next := make([]string, 0, len(childRecords))
+		nextRecords := make(map[string]map[string]any, len(childRecords))
+		for _, record := range childRecords {
+			ID := record["_id"].(string)
+			parentID, _ := record["parent"].(string)
+			childIDs[parentID] = append(childIDs[parentID], ID)
+			next = append(next, ID)
+			nextRecords[ID] = record
+		}
+
+		// Deserialize nodes of the level which are inactive
+		nodes := make([]*Node, 0, len(frontier))
+		for _, ID := range frontier {
+			record, ok := records[ID]
+			if !ok {
+				continue
+			}
+			if _, ok := t.cache.Peek(ID); ok {
+				continue
+			}
+			if err := t.versionRecord(ctx, record); err != nil {
+				return count, err
+			}
+			node := NewNode(record)
+			for _, childID := range childIDs[ID] {
+				node.AddChild(childID)
+			}
+			nodes = append(nodes, node)
+		}
+
+		// Activate nodes of the level
+		added, err := t.addLevelToCache(ctx, frontier, nodes, pin)
+		count += added
+		if err != nil {
+			return count, err
+		}
+		if level == 0 {
+			activated = added > 0
+		}
+
+		if depth >= 0 && level >= depth {
+			break
+		}
+		frontier, records = next, nextRecords
+	}
+
+	// Update ChildIDs of parent node if the root is activated by this call
+	if root, ok := t.cache.Peek(rootID); ok && activated {
+		if parent, ok := t.cache.Peek(root.GetParentID()); ok {
+			parent.AddChild(rootID)
+		}
+	}
+	return count, nil
+}
+
+// addLevelToCache caches nodes unless others of the same IDs are cached, pinning nodes of IDs if pin,
+// and returns the number of nodes cached.
+func (t *Tree) addLevelToCache(ctx context.Context, IDs []string, nodes []*Node, pin bool) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	added := 0
+	for _, node := range nodes {
+		ID := node.GetID()
+		if _, ok := t.cache.Peek(ID); ok {
+			continue
+		}
+		t.cache.Add(ID, node)
+		added++
+	}
+	for _, ID := range IDs {
+		if pin {
+			t.pinned.Store(ID, struct{}{})
+		}
+		t.applyPin(ID)
+	}
+	return added, t.shrinkLocked(ctx)
+}
+
+// applyPin pins a cached node if it is pinned.
+func (t *Tree) applyPin(ID string) {
+	if _, ok := t.pinned.Load(ID); ok {
+		t.cache.Pin(ID)
+	}
+}
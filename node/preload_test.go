@@ -0,0 +1,182 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/world-in-progress/yggdrasil/db/memory"
+)
+
+// countingRepository counts reads of node records.
+type countingRepository struct {
+	*memory.MemoryRepository
+	reads atomic.Int64
+}
+
+func (r *countingRepository) ReadOne(ctx context.Context, table string, filter map[string]any) (map[string]any, error) {
+	r.reads.Add(1)
+	return r.MemoryRepository.ReadOne(ctx, table, filter)
+}
+
+func (r *countingRepository) ReadAll(ctx context.Context, table string, filter map[string]any) ([]map[string]any, error) {
+	r.reads.Add(1)
+	return r.MemoryRepository.ReadAll(ctx, table, filter)
+}
+
+// newSubtree registers a root with 3 children, each of which has 3 children, and returns the ID of the root.
+func newSubtree(t *testing.T, tree *Tree) string {
+	rootID, err := tree.RegisterNode("BaseNode", map[string]any{"name": "Root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 3 {
+		childID, err := tree.RegisterNode("BaseNode", map[string]any{"name": fmt.Sprintf("Child %v", i), "parent": rootID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := range 3 {
+			if _, err := tree.RegisterNode("BaseNode", map[string]any{"name": fmt.Sprintf("Child %v-%v", i, j), "parent": childID}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return rootID
+}
+
+func TestTreePreload(t *testing.T) {
+	repo := &countingRepository{MemoryRepository: memory.NewMemoryRepository()}
+	tree, err := NewTree("Test tree", repo, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.RegistserNodeSchemaFromJson("node_schema_test.json"); err != nil {
+		t.Fatal(err)
+	}
+	rootID := newSubtree(t, tree)
+
+	// A tree restarted on the same repository
+	restarted, err := NewTree("Test tree", repo, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.reads.Store(0)
+	count, err := restarted.Preload(rootID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 || restarted.GetActiveNodeNum() != 4 {
+		t.Fatalf("4 nodes are expected to be preloaded, but got %v and %v active", count, restarted.GetActiveNodeNum())
+	}
+	if reads := repo.reads.Load(); reads != 3 {
+		t.Fatalf("3 reads are expected to preload 2 levels, but got %v", reads)
+	}
+
+	root, err := restarted.GetNode(rootID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.GetChildIDs()) != 3 {
+		t.Fatalf("preloaded root is expected to have 3 children, but got %v", root.GetChildIDs())
+	}
+	child, _ := restarted.cache.Peek(root.GetChildIDs()[0])
+	if child == nil || len(child.GetChildIDs()) != 3 {
+		t.Fatalf("preloaded child is expected to have 3 children")
+	}
+
+	// Active nodes are kept, and the rest of the subtree is loaded
+	if count, err := restarted.Preload(rootID, -1); err != nil || count != 9 {
+		t.Fatalf("9 nodes are expected to be preloaded, but got %v, %v", count, err)
+	}
+	if cached, _ := restarted.cache.Peek(rootID); cached != root {
+		t.Fatalf("active root is not expected to be replaced")
+	}
+}
+
+func TestTreePin(t *testing.T) {
+	repo := memory.NewMemoryRepository()
+	tree, err := NewTree("Test tree", repo, 4) // two nodes are kept
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.RegistserNodeSchemaFromJson("node_schema_test.json"); err != nil {
+		t.Fatal(err)
+	}
+	rootID := newSubtree(t, tree)
+
+	if err := tree.Pin(rootID, true); err != nil {
+		t.Fatal(err)
+	}
+	if tree.GetActiveNodeNum() != 13 {
+		t.Fatalf("13 pinned nodes are expected to be active, but got %v", tree.GetActiveNodeNum())
+	}
+	if _, err := tree.RegisterNode("BaseNode", map[string]any{"name": "Other"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Shrink(); err != nil {
+		t.Fatal(err)
+	}
+	if tree.GetActiveNodeNum() != 13 {
+		t.Fatalf("only pinned nodes are expected to be kept, but got %v active", tree.GetActiveNodeNum())
+	}
+
+	// Pinned nodes are pinned again once they are reloaded
+	if err := tree.deactivateNode(rootID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.GetNode(rootID); err != nil {
+		t.Fatal(err)
+	}
+	if !tree.IsPinned(rootID) || !tree.cache.IsPinned(rootID) {
+		t.Fatalf("reloaded root is expected to be pinned")
+	}
+
+	tree.Unpin(rootID, true)
+	if err := tree.Shrink(); err != nil {
+		t.Fatal(err)
+	}
+	if tree.GetActiveNodeNum() != 2 {
+		t.Fatalf("unpinned nodes are expected to be evicted, but got %v active", tree.GetActiveNodeNum())
+	}
+}
+
+func TestTreePreloadTwice(t *testing.T) {
+	repo := memory.NewMemoryRepository()
+	tree, err := NewTree("Test tree", repo, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.RegistserNodeSchemaFromJson("node_schema_test.json"); err != nil {
+		t.Fatal(err)
+	}
+	rootID := newSubtree(t, tree)
+	root, _ := tree.GetNode(rootID)
+	childID := root.GetChildIDs()[0]
+
+	// Preloading or pinning a cached node does not link it to its parent again
+	for range 2 {
+		if _, err := tree.Preload(childID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tree.Pin(childID, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(root.GetChildIDs()) != 3 {
+		t.Fatalf("root is expected to have 3 children, but got %v", root.GetChildIDs())
+	}
+
+	// A reloaded node is linked to its cached parent once
+	if err := tree.deactivateNode(childID); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if _, err := tree.Preload(childID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(root.GetChildIDs()) != 3 {
+		t.Fatalf("root is expected to have 3 children, but got %v", root.GetChildIDs())
+	}
+}
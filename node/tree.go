@@ -1,58 +1,110 @@
 package node
 
 import (
-	"container/heap"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/google/uuid"
+	"github.com/world-in-progress/yggdrasil/core/logger"
+	"github.com/world-in-progress/yggdrasil/core/metrics"
+	"github.com/world-in-progress/yggdrasil/core/structure"
 	nodeinterface "github.com/world-in-progress/yggdrasil/node/interface"
 	"github.com/world-in-progress/yggdrasil/node/nodeschema"
 )
 
+// maxMergeAttempts is the number of times a node is merged with its record being updated by others.
+const maxMergeAttempts = 3
+
 type (
-	nodeEntry struct {
-		index int
-		node  *Node
-	}
+	// TreeOption configures a tree created by NewTree.
+	TreeOption func(*Tree)
 
-	nodeHeap []*nodeEntry
+	// MergeFunc merges attributes of a node with those of its record updated by others since the node is loaded,
+	// and returns the attributes to write to the record, see Tree.SetMergeFunc. Nil attributes discard the changes
+	// of the node, see DiscardChanges.
+	MergeFunc func(ID string, local, remote map[string]any) (map[string]any, error)
 
 	Tree struct {
+		name      string
 		cacheSize int
-		nodeCache sync.Map
-		heap      nodeHeap
+		stats     metrics.CacheCounters
+		cache     *structure.Cache[string, *Node]
+		loading   sync.Map // channels closed once nodes being activated are cached, by ID
+		pinned    sync.Map // IDs of nodes pinned in the cache, see Pin
+		holds     atomic.Int32
 		repo      nodeinterface.IRepository
+		history   IHistoryStore
+		merge     MergeFunc
+		bus       atomic.Pointer[treeBus]
 		SchemaMgr *nodeschema.SchemaManager
 
 		mu sync.RWMutex
 	}
 )
 
-func NewTree(name string, repo nodeinterface.IRepository, cacheSize uint) (*Tree, error) {
+// WithCachePolicy sets the policy evicting nodes from the runtime cache, the least recently used first by default.
+func WithCachePolicy(policy structure.ICachePolicy[string]) TreeOption {
+	return func(t *Tree) {
+		t.cache = structure.NewCache[string, *Node](policy)
+	}
+}
+
+func NewTree(name string, repo nodeinterface.IRepository, cacheSize uint, opts ...TreeOption) (*Tree, error) {
 	t := &Tree{
+		name:      name,
 		repo:      repo,
-		nodeCache: sync.Map{},
 		cacheSize: int(cacheSize),
-		heap:      make(nodeHeap, 0),
+		cache:     structure.NewCache[string, *Node](structure.NewLRUPolicy[string]()),
+	}
+	for _, opt := range opts {
+		opt(t)
 	}
 
 	// add node schema manager
 	schemaMgr := nodeschema.NewSchemaManager(t.repo)
 	t.SchemaMgr = schemaMgr
 
-	heap.Init(&t.heap)
 	return t, nil
 }
 
+// SetMergeFunc sets the function merging a dirty node with its record if the record has been updated by another
+// tree since the node is loaded. Without it, such a node is not written back and is kept in the runtime cache,
+// even once evicted or invalidated, until it is merged or discarded, see DiscardNode and DiscardChanges.
+// Merging is retried up to 3 times if the record keeps changing.
+func (t *Tree) SetMergeFunc(merge MergeFunc) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.merge = merge
+}
+
+// DiscardChanges is the merge function discarding changes of a node conflicting with its record,
+// so that the node is loaded again from the record once requested.
+func DiscardChanges(ID string, local, remote map[string]any) (map[string]any, error) {
+	return nil, nil
+}
+
+func (t *Tree) mergeFunc() MergeFunc {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.merge
+}
+
 // RegisterNodeSchema registers a node schema to repository.
 // Any node want to be registered to resource tree must follow a specific and existing schema.
 func (t *Tree) RegisterNodeSchema(schemaInfo map[string]any) (string, error) {
-	schemaID, err := t.SchemaMgr.RegisterSchema(schemaInfo)
+	return t.RegisterNodeSchemaCtx(context.Background(), schemaInfo)
+}
+
+// RegisterNodeSchemaCtx registers a node schema to repository with context.
+func (t *Tree) RegisterNodeSchemaCtx(ctx context.Context, schemaInfo map[string]any) (string, error) {
+	schemaID, err := t.SchemaMgr.RegisterSchemaCtx(ctx, schemaInfo)
 	if err != nil {
 		return "", err
 	}
@@ -62,6 +114,11 @@ func (t *Tree) RegisterNodeSchema(schemaInfo map[string]any) (string, error) {
 // RegistserNodeSchemaFromJson registers node schemas to repository by a json file.
 // Schemas in Json file must be organized as an array named "schemas"
 func (t *Tree) RegistserNodeSchemaFromJson(path string) (map[string]any, error) {
+	return t.RegistserNodeSchemaFromJsonCtx(context.Background(), path)
+}
+
+// RegistserNodeSchemaFromJsonCtx registers node schemas to repository by a json file with context.
+func (t *Tree) RegistserNodeSchemaFromJsonCtx(ctx context.Context, path string) (map[string]any, error) {
 	// Read node schema from json file.
 	file, err := os.Open(path)
 	if err != nil {
@@ -85,7 +142,7 @@ func (t *Tree) RegistserNodeSchemaFromJson(path string) (map[string]any, error)
 	schemas := make(map[string]any)
 	for _, schema := range schemasRaw.([]any) {
 		s := schema.(map[string]any)
-		if _, err = t.SchemaMgr.RegisterSchema(s); err != nil {
+		if _, err = t.SchemaMgr.RegisterSchemaCtx(ctx, s); err != nil {
 			return nil, fmt.Errorf("%v", err)
 		}
 		schemas[s["name"].(string)] = schema
@@ -96,162 +153,374 @@ func (t *Tree) RegistserNodeSchemaFromJson(path string) (map[string]any, error)
 
 // RegisterNode records node information to repository and activates the node in the runtime cache.
 func (t *Tree) RegisterNode(schemaName string, nodeInfo map[string]any) (string, error) {
+	return t.RegisterNodeCtx(context.Background(), schemaName, nodeInfo)
+}
+
+// RegisterNodeCtx records node information to repository and activates the node in the runtime cache with context.
+func (t *Tree) RegisterNodeCtx(ctx context.Context, schemaName string, nodeInfo map[string]any) (string, error) {
 	// Check validation
-	if err := t.SchemaMgr.Validate(schemaName, nodeInfo); err != nil {
+	if err := t.SchemaMgr.ValidateCtx(ctx, schemaName, nodeInfo); err != nil {
 		return "", fmt.Errorf("nodeInfo %v provided for node registration is invalid: %v", nodeInfo, err)
 	}
 
 	// Create uuid
 	ID := schemaName + "-" + uuid.New().String()
 	nodeInfo["_id"] = ID
+	if err := t.createNode(ctx, nodeInfo); err != nil {
+		return "", err
+	}
+	return ID, nil
+}
+
+// ImportNode records a node with the ID it carries, such as a node exported from another repository,
+// and activates it in the runtime cache. The ID must be made of the schema name of the node and a UUID.
+func (t *Tree) ImportNode(nodeInfo map[string]any) error {
+	return t.ImportNodeCtx(context.Background(), nodeInfo)
+}
+
+// ImportNodeCtx records a node with the ID it carries and activates it in the runtime cache with context.
+func (t *Tree) ImportNodeCtx(ctx context.Context, nodeInfo map[string]any) error {
+	ID, _ := nodeInfo["_id"].(string)
+	infos := strings.Split(ID, "-")
+	if len(infos) != 6 {
+		return fmt.Errorf("provided ID %s is not valid", ID)
+	}
+	if err := t.SchemaMgr.ValidateCtx(ctx, infos[0], nodeInfo); err != nil {
+		return fmt.Errorf("nodeInfo %v provided for node import is invalid: %v", nodeInfo, err)
+	}
+	return t.createNode(ctx, nodeInfo)
+}
+
+// createNode records a validated node with its ID and activates it.
+func (t *Tree) createNode(ctx context.Context, nodeInfo map[string]any) error {
+	ID := nodeInfo["_id"].(string)
+	nodeInfo[versionField] = int64(0)
 
 	// Create node info to repository
-	ctx := context.Background()
 	if _, err := t.repo.Create(ctx, "node", nodeInfo); err != nil {
-		return "", fmt.Errorf("failed to create node %v: %v", nodeInfo, err)
+		return fmt.Errorf("failed to create node %v: %v", nodeInfo, err)
+	}
+
+	// Children of the parent cached by other trees are changed
+	if parentID, ok := nodeInfo["parent"].(string); ok && parentID != "" {
+		t.publish(ctx, parentID)
 	}
 
 	// Active node
-	if err := t.activateNode(ID); err != nil {
-		return "", fmt.Errorf("failed to active node: %v", err)
+	if _, err := t.activateNode(ctx, ID); err != nil {
+		return fmt.Errorf("failed to active node: %v", err)
 	}
-	return ID, nil
+	return nil
 }
 
 // GetNode gets a node pointer through cache or deserializing from repository record.
 func (t *Tree) GetNode(ID string) (*Node, error) {
+	return t.GetNodeCtx(context.Background(), ID)
+}
+
+// GetNodeCtx gets a node pointer through cache or deserializing from repository record with context.
+func (t *Tree) GetNodeCtx(ctx context.Context, ID string) (*Node, error) {
 	// Get node if it is active
-	if val, loaded := t.nodeCache.Load(ID); loaded {
-		node := val.(*Node)
-		t.updateHeap(node)
+	if node, ok := t.cache.Get(ID); ok {
+		t.stats.Hit()
 		return node, nil
 	}
 
-	if err := t.activateNode(ID); err != nil {
+	t.stats.Miss()
+	node, err := t.activateNode(ctx, ID)
+	if err != nil {
 		return nil, fmt.Errorf("failed to get node in repository: %v", err)
-	} else {
-		return t.GetNode(ID)
 	}
+	return node, nil
 }
 
 // DeleteNode recursively deletes cache and repository record from the provided node
 func (t *Tree) DeleteNode(ID string) error {
+	return t.DeleteNodeCtx(context.Background(), ID)
+}
+
+// DeleteNodeCtx recursively deletes cache and repository record from the provided node with context.
+func (t *Tree) DeleteNodeCtx(ctx context.Context, ID string) error {
 	// Get node
-	node, err := t.GetNode(ID)
+	node, err := t.GetNodeCtx(ctx, ID)
 	if err != nil {
 		return fmt.Errorf("failed to get node: %v", err)
 	}
 
 	// Remove node from parent if parent is active
-	if val, loaded := t.nodeCache.Load(node.GetParentID()); loaded {
-		val.(*Node).RemoveChild(ID)
+	parentID := node.GetParentID()
+	if parent, ok := t.cache.Peek(parentID); ok {
+		parent.RemoveChild(ID)
 	}
 
 	// Recursively remove children
 	for _, childID := range node.GetChildIDs() {
-		if err := t.DeleteNode(childID); err != nil {
+		if err := t.DeleteNodeCtx(ctx, childID); err != nil {
 			return fmt.Errorf("failed to recursively remove children: %v", err)
 		}
 	}
 
 	// Deactivate
-	if err := t.deactivateNode(ID); err != nil {
+	t.pinned.Delete(ID)
+	if err := t.deactivateNodeCtx(ctx, ID); err != nil {
 		return fmt.Errorf("failed to deactivate node: %v", err)
 	}
 
 	// Delete node record in repository
-	ctx := context.Background()
 	if err := t.repo.Delete(ctx, "node", map[string]any{"_id": ID}); err != nil {
 		return fmt.Errorf("failed to delete node record: %v", err)
 	}
+	t.publish(ctx, ID, parentID)
 
 	return nil
 }
 
 func (t *Tree) UpdateNodeAttribute(ID string, name string, update any) error {
+	return t.UpdateNodeAttributeCtx(context.Background(), ID, name, update)
+}
+
+// UpdateNodeAttributeCtx updates an attribute of a node in cache or in repository with context.
+// If the tree has a history store, the change is recorded with the source carried by ctx.
+func (t *Tree) UpdateNodeAttributeCtx(ctx context.Context, ID string, name string, update any) error {
+	_, err := t.updateNodeAttribute(ctx, ID, name, update, nil)
+	return err
+}
+
+func (t *Tree) CompareAndUpdateNodeAttribute(ID string, name string, update any, version uint64) (uint64, error) {
+	return t.CompareAndUpdateNodeAttributeCtx(context.Background(), ID, name, update, version)
+}
+
+// CompareAndUpdateNodeAttributeCtx updates an attribute of a node if it is at version, and returns the new version,
+// see Node.CompareAndUpdateAttribute. The version of an inactive node is compared with the one of its record,
+// if the repository implements IAtomicRepository.
+func (t *Tree) CompareAndUpdateNodeAttributeCtx(ctx context.Context, ID string, name string, update any, version uint64) (uint64, error) {
+	return t.updateNodeAttribute(ctx, ID, name, update, &version)
+}
+
+// updateNodeAttribute updates an attribute of a node, comparing the version of an active node if version is given.
+func (t *Tree) updateNodeAttribute(ctx context.Context, ID string, name string, update any, version *uint64) (uint64, error) {
 	// Get schema name
 	var schemaName string
 	if infos := strings.Split(ID, "-"); len(infos) != 6 {
-		return fmt.Errorf("provided ID %s is not valid", ID)
+		return 0, fmt.Errorf("provided ID %s is not valid", ID)
 	} else {
 		schemaName = infos[0]
-		if !t.SchemaMgr.HasSchema(schemaName) {
-			return fmt.Errorf("schema name %s is not declared in schema manager", schemaName)
+		if !t.SchemaMgr.HasSchemaCtx(ctx, schemaName) {
+			return 0, fmt.Errorf("schema name %s is not declared in schema manager", schemaName)
 		}
 	}
 
 	// Check if update data is valid
-	if err := t.SchemaMgr.ValidateField(schemaName, name, update); err != nil {
-		return fmt.Errorf("update data is not valid: %v", err)
+	if err := t.SchemaMgr.ValidateFieldCtx(ctx, schemaName, name, update); err != nil {
+		return 0, fmt.Errorf("update data is not valid: %v", err)
 	}
 
 	// Update cache if node is active
-	if val, ok := t.nodeCache.Load(ID); ok {
-		node := val.(*Node)
-		if _, err := node.UpdateAttribute(name, update); err != nil {
-			return fmt.Errorf("failed to update node attribute: %v", err)
+	if node, ok := t.cache.Get(ID); ok {
+		var old any
+		var current uint64
+		var err error
+		if version != nil {
+			old, current, err = node.CompareAndUpdateAttribute(name, update, *version)
+		} else {
+			old, err = node.UpdateAttribute(name, update)
 		}
-		t.updateHeap(node)
-		return nil
+		if err != nil {
+			return current, fmt.Errorf("failed to update node attribute: %w", err)
+		}
+		// Attributes of active nodes are only updated if they exist
+		if err := t.recordChange(ctx, ID, name, old, true, update); err != nil {
+			return current, fmt.Errorf("node attribute is updated but failed to record the change: %v", err)
+		}
+		return current, nil
 	}
 
 	// Update repository record if node is inactive
-	ctx := context.Background()
+	updateData := map[string]any{
+		"$set": map[string]any{name: update},
+		"$inc": map[string]any{versionField: int64(1)},
+	}
+	before, err := t.updateRecord(ctx, ID, updateData, version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update node record in repository: %w", err)
+	}
+	old, existed := before[name]
+	if err := t.recordChange(ctx, ID, name, old, existed, update); err != nil {
+		return t.recordVersion(before), fmt.Errorf("node attribute is updated but failed to record the change: %v", err)
+	}
+	return t.recordVersion(before), nil
+}
+
+func (t *Tree) CompareAndUpdateNodeAttributes(ID string, updates map[string]any, version uint64) (uint64, error) {
+	return t.CompareAndUpdateNodeAttributesCtx(context.Background(), ID, updates, version)
+}
+
+// CompareAndUpdateNodeAttributesCtx updates several attributes of a node at once if it is at version, and returns
+// the new version, see Node.CompareAndUpdateAttributes. The record of an inactive node is updated by a single
+// compare-and-set, so that either all attributes are updated or none is.
+func (t *Tree) CompareAndUpdateNodeAttributesCtx(ctx context.Context, ID string, updates map[string]any, version uint64) (uint64, error) {
+	if len(updates) == 0 {
+		return 0, fmt.Errorf("no attribute of node %s to update", ID)
+	}
+
+	// Check if update data is valid
+	infos := strings.Split(ID, "-")
+	if len(infos) != 6 {
+		return 0, fmt.Errorf("provided ID %s is not valid", ID)
+	}
+	schemaName := infos[0]
+	if !t.SchemaMgr.HasSchemaCtx(ctx, schemaName) {
+		return 0, fmt.Errorf("schema name %s is not declared in schema manager", schemaName)
+	}
+	names := make([]string, 0, len(updates))
+	for name, update := range updates {
+		if err := t.SchemaMgr.ValidateFieldCtx(ctx, schemaName, name, update); err != nil {
+			return 0, fmt.Errorf("update data is not valid: %v", err)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Update cache if node is active
+	if node, ok := t.cache.Get(ID); ok {
+		old, current, err := node.CompareAndUpdateAttributes(updates, version)
+		if err != nil {
+			return current, fmt.Errorf("failed to update node attributes: %w", err)
+		}
+		for _, name := range names {
+			if err := t.recordChange(ctx, ID, name, old[name], true, updates[name]); err != nil {
+				return current, fmt.Errorf("node attributes are updated but failed to record the change of %s: %v", name, err)
+			}
+		}
+		return current, nil
+	}
+
+	// Update repository record if node is inactive
+	updateData := map[string]any{
+		"$set": updates,
+		"$inc": map[string]any{versionField: int64(1)},
+	}
+	before, err := t.updateRecord(ctx, ID, updateData, &version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update node record in repository: %w", err)
+	}
+	for _, name := range names {
+		old, existed := before[name]
+		if err := t.recordChange(ctx, ID, name, old, existed, updates[name]); err != nil {
+			return t.recordVersion(before), fmt.Errorf("node attributes are updated but failed to record the change of %s: %v", name, err)
+		}
+	}
+	return t.recordVersion(before), nil
+}
+
+// updateRecord updates a node record, comparing its version if version is given, and returns the record as it is
+// before the update. Versions are not compared if the repository does not implement IAtomicRepository, in which case
+// the record is read before the update if the tree has a history store, and nil is returned otherwise.
+// Copies of the node cached by other trees are invalidated.
+func (t *Tree) updateRecord(ctx context.Context, ID string, update map[string]any, version *uint64) (map[string]any, error) {
 	filter := map[string]any{"_id": ID}
-	updateData := map[string]any{"$set": map[string]any{name: update}}
-	if err := t.repo.Update(ctx, "node", filter, updateData); err != nil {
-		return fmt.Errorf("failed to update node record in repository: %v", err)
+	repo, ok := t.repo.(nodeinterface.IAtomicRepository)
+	if !ok {
+		var before map[string]any
+		if t.historyStore() != nil {
+			record, err := t.repo.ReadOne(ctx, "node", filter)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read node record in repository: %v", err)
+			}
+			before = record
+		}
+		if err := t.repo.Update(ctx, "node", filter, update); err != nil {
+			return nil, err
+		}
+		t.publish(ctx, ID)
+		return before, nil
 	}
-	return nil
+
+	if version != nil {
+		filter[versionField] = int64(*version)
+	}
+	before, err := repo.FindOneAndUpdate(ctx, "node", filter, update, nodeinterface.ReturnBefore)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil && version != nil {
+		return nil, t.conflict(ctx, ID, *version)
+	}
+	t.publish(ctx, ID)
+	return before, nil
+}
+
+// recordVersion returns the version of a node record after an update incrementing it, from the record before
+// the update. Zero is returned if the repository does not implement IAtomicRepository, as versions are not compared.
+func (t *Tree) recordVersion(before map[string]any) uint64 {
+	if _, ok := t.repo.(nodeinterface.IAtomicRepository); !ok || before == nil {
+		return 0
+	}
+	return toVersion(before[versionField]) + 1
+}
+
+// conflict reads the version of a node record updated by others, and returns the conflict with expected version.
+func (t *Tree) conflict(ctx context.Context, ID string, expected uint64) error {
+	record, err := t.repo.ReadOne(ctx, "node", map[string]any{"_id": ID})
+	if err != nil {
+		return fmt.Errorf("failed to read node record in repository: %v", err)
+	}
+	return &VersionConflictError{ID: ID, Expected: expected, Current: toVersion(record[versionField])}
 }
 
 // Must check if node ID is invalid before calling this function.
 func (t *Tree) BindComponentToNode(ID, compoID string) error {
+	return t.BindComponentToNodeCtx(context.Background(), ID, compoID)
+}
+
+// BindComponentToNodeCtx binds a component to a node in cache or in repository with context.
+func (t *Tree) BindComponentToNodeCtx(ctx context.Context, ID, compoID string) error {
 	// Update cache if node is active
-	if val, ok := t.nodeCache.Load(ID); ok {
-		node := val.(*Node)
-		if added := node.AddComponent(compoID); added {
-			t.updateHeap(node)
-		}
+	if node, ok := t.cache.Get(ID); ok {
+		node.AddComponent(compoID)
 		return nil
 	}
 
 	// Update repository record if node is inactive
-	ctx := context.Background()
-	filter := map[string]any{"_id": ID}
-	updateData := map[string]any{"$push": map[string]any{"components": compoID}}
-	if err := t.repo.Update(ctx, "node", filter, updateData); err != nil {
+	updateData := map[string]any{
+		"$push": map[string]any{"components": compoID},
+		"$inc":  map[string]any{versionField: int64(1)},
+	}
+	if _, err := t.updateRecord(ctx, ID, updateData, nil); err != nil {
 		return fmt.Errorf("failed to update node components in repository: %v", err)
 	}
 	return nil
 }
 
 func (t *Tree) DeleteComponentFromNode(ID, compoID string) error {
+	return t.DeleteComponentFromNodeCtx(context.Background(), ID, compoID)
+}
+
+// DeleteComponentFromNodeCtx deletes a component from a node in cache or in repository with context.
+func (t *Tree) DeleteComponentFromNodeCtx(ctx context.Context, ID, compoID string) error {
 	// Get schema name
 	var schemaName string
 	if infos := strings.Split(ID, "-"); len(infos) != 6 {
 		return fmt.Errorf("provided ID %s is not valid", ID)
 	} else {
 		schemaName = infos[0]
-		if !t.SchemaMgr.HasSchema(schemaName) {
+		if !t.SchemaMgr.HasSchemaCtx(ctx, schemaName) {
 			return fmt.Errorf("schema name %s is not declared in schema manager", schemaName)
 		}
 	}
 
 	// Delete in cache if node is active
-	if val, ok := t.nodeCache.Load(ID); ok {
-		node := val.(*Node)
-		if deleted := node.DeleteComponent(compoID); deleted {
-			t.updateHeap(node)
-		}
+	if node, ok := t.cache.Get(ID); ok {
+		node.DeleteComponent(compoID)
 		return nil
 	}
 
 	// Delete in repository if node node is inactive
-	ctx := context.Background()
-	filter := map[string]any{"_id": ID}
-	updateData := map[string]any{"$pull": map[string]any{"components": compoID}}
-	if err := t.repo.Update(ctx, "node", filter, updateData); err != nil {
+	updateData := map[string]any{
+		"$pull": map[string]any{"components": compoID},
+		"$inc":  map[string]any{versionField: int64(1)},
+	}
+	if _, err := t.updateRecord(ctx, ID, updateData, nil); err != nil {
 		return fmt.Errorf("failed to delete node component in repository: %v", err)
 	}
 	return nil
@@ -259,24 +528,95 @@ func (t *Tree) DeleteComponentFromNode(ID, compoID string) error {
 
 // Shrink clear the cache to half its size.
 func (t *Tree) Shrink() error {
+	return t.ShrinkCtx(context.Background())
+}
+
+// ShrinkCtx clear the cache to half its size with context used to flush dirty nodes.
+func (t *Tree) ShrinkCtx(ctx context.Context) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	return t.shrinkLocked()
+	return t.shrinkLocked(ctx)
+}
+
+// HoldEviction stops evicting nodes from the runtime cache until release is called, which shrinks the cache
+// with ctx used to flush dirty nodes. It lets dirty nodes be written back outside of a repository transaction
+// carried by the contexts of operations run meanwhile.
+func (t *Tree) HoldEviction() (release func(ctx context.Context) error) {
+	t.holds.Add(1)
+	var once sync.Once
+	return func(ctx context.Context) error {
+		var err error
+		once.Do(func() {
+			if t.holds.Add(-1) == 0 {
+				err = t.ShrinkCtx(ctx)
+			}
+		})
+		return err
+	}
+}
+
+// FlushNode writes an active node back to its record if it is dirty, keeping it active.
+func (t *Tree) FlushNode(ID string) error {
+	return t.FlushNodeCtx(context.Background(), ID)
+}
+
+// FlushNodeCtx writes an active node back to its record if it is dirty with context.
+// A node merged with its record updated by others, or whose changes are discarded, is deactivated,
+// to be loaded again once requested.
+func (t *Tree) FlushNodeCtx(ctx context.Context, ID string) error {
+	node, ok := t.cache.Peek(ID)
+	if !ok || !node.IsDirty() {
+		return nil
+	}
+
+	version, merged, err := t.flush(ctx, node, t.mergeFunc())
+	if err != nil {
+		return fmt.Errorf("failed to update node record in repository: %w", err)
+	}
+	t.stats.Flush()
+	if merged {
+		t.DiscardNode(ID)
+	} else {
+		node.persist(version)
+	}
+	return nil
+}
+
+// DiscardNode deactivates a node without writing it back, so that changes not written to its record are lost.
+func (t *Tree) DiscardNode(ID string) {
+	t.cache.Remove(ID)
 }
 
 // GetActiveNodeNum counts all active nodes in the cache.
 func (t *Tree) GetActiveNodeNum() int {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	return t.heap.Len()
+	return t.cache.Len()
+}
+
+// CacheStats snapshots the statistics of the runtime cache of the tree.
+func (t *Tree) CacheStats() metrics.CacheStats {
+	return t.stats.Stats(t.cache.Len())
+}
+
+// RegisterMetrics exposes the statistics of the runtime cache of the tree in a registry, labeled by the tree name.
+func (t *Tree) RegisterMetrics(r *metrics.Registry) {
+	metrics.RegisterCache(r, t.name, t.CacheStats)
+}
+
+// UnregisterMetrics removes the statistics of the runtime cache of the tree from a registry.
+func (t *Tree) UnregisterMetrics(r *metrics.Registry) {
+	metrics.UnregisterCache(r, t.name)
 }
 
 // GetNodeRecordNum counts all node records in the repository.
 func (t *Tree) GetNodeRecordNum() (int64, error) {
+	return t.GetNodeRecordNumCtx(context.Background())
+}
+
+// GetNodeRecordNumCtx counts all node records in the repository with context.
+func (t *Tree) GetNodeRecordNumCtx(ctx context.Context) (int64, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	ctx := context.Background()
 	if count, err := t.repo.Count(ctx, "node", nil); err != nil {
 		return 0, fmt.Errorf("failed to count node record in repository: %v", err)
 	} else {
@@ -284,146 +624,189 @@ func (t *Tree) GetNodeRecordNum() (int64, error) {
 	}
 }
 
-// activateNode activates a node from repository record to the runtime cache.
-func (t *Tree) activateNode(ID string) error {
-	// Check if is active
-	if _, loaded := t.nodeCache.LoadOrStore(ID, nil); loaded {
-		return nil
+// activateNode activates a node from repository record to the runtime cache, and returns it.
+// A node being activated by another goroutine is waited for rather than loaded twice.
+func (t *Tree) activateNode(ctx context.Context, ID string) (*Node, error) {
+	for {
+		// Check if is active
+		if node, ok := t.cache.Peek(ID); ok {
+			return node, nil
+		}
+
+		// Wait for the node if it is being activated
+		done := make(chan struct{})
+		if val, loaded := t.loading.LoadOrStore(ID, done); loaded {
+			select {
+			case <-val.(chan struct{}):
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		node, err := t.loadNode(ctx, ID)
+		t.loading.Delete(ID)
+		close(done)
+		return node, err
+	}
+}
+
+// loadNode deserializes a node from its repository record and caches it.
+func (t *Tree) loadNode(ctx context.Context, ID string) (*Node, error) {
+	// Check again if the node is activated since it is looked up
+	if node, ok := t.cache.Peek(ID); ok {
+		return node, nil
 	}
 
 	// Find if is in repository
-	ctx := context.Background()
 	nodeInfo, err := t.repo.ReadOne(ctx, "node", map[string]any{"_id": ID})
 	if err != nil {
-		t.nodeCache.Delete(ID)
-		return fmt.Errorf("cannot activate node not existing: %v", err)
+		return nil, fmt.Errorf("cannot activate node not existing: %v", err)
 	}
 
-	// Activate node
-	node := NewNode(nodeInfo)
-	t.nodeCache.Store(ID, node)
+	if err := t.versionRecord(ctx, nodeInfo); err != nil {
+		return nil, err
+	}
 
 	// Record children ID through repository
+	node := NewNode(nodeInfo)
 	if childInfos, err := t.repo.ReadAll(ctx, "node", map[string]any{"parent": ID}); err != nil {
-		t.nodeCache.Delete(ID)
-		return fmt.Errorf("failed to find children of node: %v", err)
+		return nil, fmt.Errorf("failed to find children of node: %v", err)
 	} else {
 		for _, childInfo := range childInfos {
-			node.childrenIDs = append(node.childrenIDs, childInfo["_id"].(string))
+			node.AddChild(childInfo["_id"].(string))
 		}
 	}
 
 	// Update ChildIDs of parent node
 	if parentID := node.GetParentID(); parentID != "" {
-		if val, loaded := t.nodeCache.Load(parentID); loaded {
-			val.(*Node).AddChild(ID)
+		if parent, ok := t.cache.Peek(parentID); ok {
+			parent.AddChild(ID)
 		}
 	}
 
-	return t.addToHeap(node)
+	// Activate node
+	return t.addToCache(ctx, node)
+}
+
+// versionRecord versions a node record created before versioning.
+func (t *Tree) versionRecord(ctx context.Context, record map[string]any) error {
+	if _, ok := record[versionField]; ok {
+		return nil
+	}
+	filter := map[string]any{"_id": record["_id"], versionField: map[string]any{"$exists": false}}
+	if err := t.repo.Update(ctx, "node", filter, map[string]any{"$set": map[string]any{versionField: int64(0)}}); err != nil {
+		return fmt.Errorf("failed to version node record: %v", err)
+	}
+	return nil
 }
 
 // deactivateNode deactivates a node from the runtime cache and updates its repository record.
 func (t *Tree) deactivateNode(ID string) error {
+	return t.deactivateNodeCtx(context.Background(), ID)
+}
+
+func (t *Tree) deactivateNodeCtx(ctx context.Context, ID string) error {
 	// Check if is inactive
-	val, loaded := t.nodeCache.LoadAndDelete(ID)
-	if !loaded || val == nil {
+	node, ok := t.cache.Remove(ID)
+	if !ok {
 		return nil
 	}
-	node := val.(*Node)
 
-	// Update node record in repository if is dirty
+	// Update node record in repository if is dirty, keeping the node active if it fails,
+	// such as for a version conflict with no merge function
 	if node.IsDirty() {
-		ctx := context.Background()
-		if err := t.repo.Update(ctx, "node", map[string]any{"_id": ID}, map[string]any{"$set": node.Serialize()}); err != nil {
-			t.nodeCache.Store(ID, node) // rollback
-			return fmt.Errorf("failed to update node record in repository: %v", err)
+		if _, _, err := t.flush(ctx, node, t.mergeFunc()); err != nil {
+			t.cache.Add(ID, node) // rollback
+			t.applyPin(ID)
+			return fmt.Errorf("failed to update node record in repository: %w", err)
 		}
+		t.stats.Flush()
 	}
-
-	// Remove from heap
-	t.removeFromHeap(node)
 	return nil
 }
 
-func (t *Tree) shrinkLocked() error {
+func (t *Tree) shrinkLocked(ctx context.Context) error {
+	if t.holds.Load() > 0 {
+		return nil
+	}
+
 	toSize := t.cacheSize / 2
 	if toSize == 0 {
 		toSize = 1
 	}
 
-	for t.heap.Len() > toSize {
-
-		// Remove from heap
-		entry := heap.Pop(&t.heap).(*nodeEntry)
-
-		// Deactivate node
-		node := entry.node
-		ID := node.GetID()
-		t.nodeCache.Delete(ID)
+	var firstErr error
+	for _, entry := range t.cache.Shrink(toSize) {
+		ID, node := entry.Key, entry.Value
+		t.stats.Evict()
 
 		// Update node record in repository if is dirty
 		if node.IsDirty() {
-			ctx := context.Background()
-			if err := t.repo.Update(ctx, "node", map[string]any{"_id": ID}, map[string]any{"$set": node.Serialize()}); err != nil {
-				t.nodeCache.Store(ID, node) // rollback
-				return fmt.Errorf("failed to update node record in repository: %v", err)
+			if _, _, err := t.flush(ctx, node, t.merge); errors.Is(err, ErrVersionConflict) {
+				// The node is kept with its changes, not to fail activation of another node
+				t.cache.Add(ID, node) // rollback
+				logger.FromContext(ctx).WithError(err).Warn("Kept evicted node %s conflicting with its record", ID)
+				continue
+			} else if err != nil {
+				t.cache.Add(ID, node) // rollback
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to update node record in repository: %w", err)
+				}
+				continue
 			}
+			t.stats.Flush()
 		}
 	}
-	return nil
-}
-
-func (t *Tree) addToHeap(node *Node) error {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-
-	entry := &nodeEntry{node: node}
-	heap.Push(&t.heap, entry)
-	return t.shrinkLocked()
+	return firstErr
 }
 
-func (t *Tree) updateHeap(node *Node) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
+// flush writes a dirty node back to its record if the record is still at the version the node is loaded at,
+// merging them by merge otherwise. It returns the version written, and whether the node is merged with its record,
+// or its changes are discarded by merge, in which case nothing is written.
+func (t *Tree) flush(ctx context.Context, node *Node, merge MergeFunc) (uint64, bool, error) {
+	attributes, version, persisted := node.state()
+	ID := attributes["_id"].(string)
+
+	for attempt := 0; ; attempt++ {
+		attributes[versionField] = int64(version)
+		_, err := t.updateRecord(ctx, ID, map[string]any{"$set": attributes}, &persisted)
+		var conflict *VersionConflictError
+		if !errors.As(err, &conflict) {
+			return version, attempt > 0, err
+		}
+		if merge == nil || attempt >= maxMergeAttempts {
+			return version, attempt > 0, err
+		}
 
-	for _, entry := range t.heap {
-		if entry.node == node {
-			heap.Fix(&t.heap, entry.index)
+		// Merge with the record updated by others
+		remote, err := t.repo.ReadOne(ctx, "node", map[string]any{"_id": ID})
+		if err != nil {
+			return version, attempt > 0, fmt.Errorf("failed to read node record in repository: %v", err)
+		}
+		persisted = toVersion(remote[versionField])
+		delete(remote, versionField)
+		delete(attributes, versionField)
+		if attributes, err = merge(ID, attributes, remote); err != nil {
+			return version, attempt > 0, fmt.Errorf("failed to merge node %v with its record: %v", ID, err)
+		}
+		if attributes == nil {
+			return version, true, nil
 		}
+		version = persisted + 1
 	}
 }
 
-func (t *Tree) removeFromHeap(node *Node) {
+// addToCache caches a node unless another one of the same ID is cached, and returns the node cached.
+func (t *Tree) addToCache(ctx context.Context, node *Node) (*Node, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	for i, entry := range t.heap {
-		if entry.node == node {
-			heap.Remove(&t.heap, i)
-			break
-		}
+	ID := node.GetID()
+	if cached, ok := t.cache.Peek(ID); ok {
+		return cached, nil
 	}
-}
-
-func (h nodeHeap) Len() int           { return len(h) }
-func (h nodeHeap) Less(i, j int) bool { return h[i].node.GetCallTime().Before(h[j].node.GetCallTime()) }
-func (h nodeHeap) Swap(i, j int) {
-	h[i], h[j] = h[j], h[i]
-	h[i].index = i
-	h[j].index = j
-}
-func (h *nodeHeap) Push(x any) {
-	entry := x.(*nodeEntry)
-	entry.index = len(*h)
-	*h = append(*h, entry)
-}
-func (h *nodeHeap) Pop() any {
-	old := *h
-	n := len(old)
-	entry := old[n-1]
-	old[n-1] = nil
-	entry.index = -1
-	*h = old[0 : n-1]
-	return entry
+	t.cache.Add(ID, node)
+	t.applyPin(ID)
+	return node, t.shrinkLocked(ctx)
 }
@@ -1,11 +1,17 @@
 package node
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/spf13/viper"
+	"github.com/world-in-progress/yggdrasil/core/invalidation"
+	"github.com/world-in-progress/yggdrasil/core/structure"
+	"github.com/world-in-progress/yggdrasil/db/memory"
 	"github.com/world-in-progress/yggdrasil/db/mongo"
 )
 
@@ -34,7 +40,10 @@ func TestTree(t *testing.T) {
 	// init tree and its dependencies
 	var err error
 	var cacheSize uint = 1 // only one node can be stored in the runtime cache
-	repo := mongo.NewMongoRepository()
+	repo, err := mongo.NewMongoRepository()
+	if err != nil {
+		t.Fatal(err)
+	}
 	tree, err := NewTree("Test tree", repo, cacheSize)
 	if err != nil {
 		t.Fatal(err)
@@ -119,3 +128,315 @@ func TestTree(t *testing.T) {
 		t.Fatalf("nodes should all be deleted but not")
 	}
 }
+
+func TestTreeVersionConflict(t *testing.T) {
+	repo := memory.NewMemoryRepository()
+	newTree := func() *Tree {
+		tree, err := NewTree("Test tree", repo, 1) // only one node can be stored in the runtime cache
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tree
+	}
+	treeA, treeB := newTree(), newTree()
+	if _, err := treeA.RegistserNodeSchemaFromJson("node_schema_test.json"); err != nil {
+		t.Fatal(err)
+	}
+	nodeID, err := treeA.RegisterNode("BaseNode", map[string]any{"name": "Node"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := func() string {
+		record, err := repo.ReadOne(context.Background(), "node", map[string]any{"_id": nodeID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return record["name"].(string)
+	}
+
+	// Both trees cache the node, and tree A writes it back first
+	if _, err := treeB.GetNode(nodeID); err != nil {
+		t.Fatal(err)
+	}
+	if err := treeA.UpdateNodeAttribute(nodeID, "name", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := treeA.RegisterNode("BaseNode", map[string]any{"name": "Other"}); err != nil {
+		t.Fatal(err)
+	}
+	if name() != "a" {
+		t.Fatalf("evicted node is expected to be written back, but name is %v", name())
+	}
+
+	// Changes of tree B made to a stale node are not written back
+	if err := treeB.UpdateNodeAttribute(nodeID, "name", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := treeB.RegisterNode("BaseNode", map[string]any{"name": "Other"}); err != nil {
+		t.Fatal(err)
+	}
+	if name() != "a" {
+		t.Fatalf("stale node is expected not to overwrite the record, but name is %v", name())
+	}
+
+	// Changes of tree B are merged with the record
+	treeB.SetMergeFunc(func(ID string, local, remote map[string]any) (map[string]any, error) {
+		remote["name"] = remote["name"].(string) + "+" + local["name"].(string)
+		return remote, nil
+	})
+	if _, err := treeB.GetNode(nodeID); err != nil {
+		t.Fatal(err)
+	}
+	if err := treeA.UpdateNodeAttribute(nodeID, "name", "a2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := treeB.UpdateNodeAttribute(nodeID, "name", "b2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := treeB.RegisterNode("BaseNode", map[string]any{"name": "Other"}); err != nil {
+		t.Fatal(err)
+	}
+	if name() != "a2+b2" {
+		t.Fatalf("node is expected to be merged with the record, but name is %v", name())
+	}
+
+	// Compare-and-set of an inactive node compares the version of its record
+	record, _ := repo.ReadOne(context.Background(), "node", map[string]any{"_id": nodeID})
+	version := toVersion(record["_version"])
+	var conflict *VersionConflictError
+	if _, err := treeA.CompareAndUpdateNodeAttribute(nodeID, "name", "c", version-1); !errors.As(err, &conflict) || conflict.Current != version {
+		t.Fatalf("update of an old version is expected to conflict at version %v, but got %v", version, err)
+	}
+	if current, err := treeA.CompareAndUpdateNodeAttribute(nodeID, "name", "c", version); err != nil || current != version+1 {
+		t.Fatalf("update of the current version is expected to raise it to %v, but got %v, %v", version+1, current, err)
+	}
+}
+
+func TestTreeConflictWithoutMerge(t *testing.T) {
+	repo := memory.NewMemoryRepository()
+	treeA, _ := NewTree("Test tree", repo, 16)
+	treeB, _ := NewTree("Test tree", repo, 1) // only one node can be stored in the runtime cache
+	if _, err := treeA.RegistserNodeSchemaFromJson("node_schema_test.json"); err != nil {
+		t.Fatal(err)
+	}
+	nodeID, err := treeA.RegisterNode("BaseNode", map[string]any{"name": "Node"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := func() string {
+		record, err := repo.ReadOne(context.Background(), "node", map[string]any{"_id": nodeID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return record["name"].(string)
+	}
+
+	// Tree B changes the node while tree A writes its record
+	n, err := treeB.GetNode(nodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := treeB.UpdateNodeAttribute(nodeID, "name", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := treeA.UpdateNodeAttribute(nodeID, "name", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := treeA.FlushNode(nodeID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The conflicting node is kept with its changes once evicted or deactivated
+	if _, err := treeB.RegisterNode("BaseNode", map[string]any{"name": "Other"}); err != nil {
+		t.Fatal(err)
+	}
+	if cached, err := treeB.GetNode(nodeID); err != nil || cached != n || cached.GetName() != "b" {
+		t.Fatalf("evicted node is expected to be kept with its changes, but got %v, %v", cached, err)
+	}
+	if err := treeB.deactivateNode(nodeID); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("deactivating the node is expected to fail by a version conflict, but got %v", err)
+	}
+	if err := treeB.FlushNode(nodeID); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("flushing the node is expected to fail by a version conflict, but got %v", err)
+	}
+	if cached, _ := treeB.GetNode(nodeID); cached != n || name() != "a" {
+		t.Fatalf("node is expected to be kept, and its record not to be overwritten, but name is %v", name())
+	}
+
+	// Changes are discarded once opted in
+	treeB.SetMergeFunc(DiscardChanges)
+	if err := treeB.FlushNode(nodeID); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := treeB.GetNode(nodeID); err != nil || reloaded == n || reloaded.GetName() != "a" || name() != "a" {
+		t.Fatalf("node is expected to be loaded again from its record once its changes are discarded, but got %v, %v", reloaded, err)
+	}
+}
+
+func TestTreeCompareAndUpdateAttributes(t *testing.T) {
+	repo := memory.NewMemoryRepository()
+	tree, err := NewTree("Test tree", repo, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.RegistserNodeSchemaFromJson("node_schema_test.json"); err != nil {
+		t.Fatal(err)
+	}
+	nodeID, err := tree.RegisterNode("ExtendNode", map[string]any{"name": "Node", "time": "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Attributes of an active node are not updated if it is updated meanwhile
+	n, err := tree.GetNode(nodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version := n.Version()
+	if err := tree.UpdateNodeAttribute(nodeID, "time", "1"); err != nil {
+		t.Fatal(err)
+	}
+	var conflict *VersionConflictError
+	if _, err := tree.CompareAndUpdateNodeAttributes(nodeID, map[string]any{"name": "a", "time": "a"}, version); !errors.As(err, &conflict) {
+		t.Fatalf("update of an old version is expected to conflict, but got %v", err)
+	}
+	if n.GetName() != "Node" || n.GetParam("time") != "1" {
+		t.Fatalf("no attribute is expected to be updated by a conflicting update: %v", n.Snapshot())
+	}
+	if current, err := tree.CompareAndUpdateNodeAttributes(nodeID, map[string]any{"name": "a", "time": "a"}, version+1); err != nil || current != version+2 {
+		t.Fatalf("attributes are expected to be updated at once to version %v, but got %v, %v", version+2, current, err)
+	}
+
+	// Writers of an inactive node racing with each other update all of their attributes or none of them
+	if err := tree.FlushNode(nodeID); err != nil {
+		t.Fatal(err)
+	}
+	tree.DiscardNode(nodeID)
+	readRecord := func() map[string]any {
+		record, err := repo.ReadOne(context.Background(), "node", map[string]any{"_id": nodeID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return record
+	}
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value := fmt.Sprint(i)
+			for {
+				version := toVersion(readRecord()[versionField])
+				_, err := tree.CompareAndUpdateNodeAttributes(nodeID, map[string]any{"name": value, "time": value}, version)
+				if err == nil {
+					return
+				}
+				if !errors.Is(err, ErrVersionConflict) {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if record := readRecord(); record["name"] != record["time"] {
+		t.Fatalf("attributes written back together are expected to come from the same writer: %v", record)
+	}
+}
+
+func TestTreeInvalidation(t *testing.T) {
+	repo := memory.NewMemoryRepository()
+	bus := invalidation.NewMemoryBus()
+	treeA, _ := NewTree("Test tree", repo, 1) // only one node can be stored in the runtime cache
+	treeB, _ := NewTree("Test tree", repo, 16)
+	treeA.SetInvalidationBus(bus)
+	treeB.SetInvalidationBus(bus)
+	defer treeA.SetInvalidationBus(nil)
+	defer treeB.SetInvalidationBus(nil)
+	if _, err := treeA.RegistserNodeSchemaFromJson("node_schema_test.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	// eventually waits for the node cached by tree B to satisfy check
+	eventually := func(ID string, check func(n *Node) bool) {
+		deadline := time.Now().Add(time.Second)
+		for {
+			n, err := treeB.GetNode(ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if check(n) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("node %v cached by tree B is stale: %v, children %v", ID, n.Snapshot(), n.GetChildIDs())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	nodeID, err := treeA.RegisterNode("BaseNode", map[string]any{"name": "Node"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := treeB.GetNode(nodeID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tree A writes the node back once it is evicted
+	if err := treeA.UpdateNodeAttribute(nodeID, "name", "a"); err != nil {
+		t.Fatal(err)
+	}
+	childID, err := treeA.RegisterNode("BaseNode", map[string]any{"name": "Child", "parent": nodeID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(nodeID, func(n *Node) bool {
+		return n.GetParam("name") == "a" && len(n.GetChildIDs()) == 1 && n.GetChildIDs()[0] == childID
+	})
+
+	// Tree A writes the inactive node
+	if err := treeA.UpdateNodeAttribute(nodeID, "name", "a2"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(nodeID, func(n *Node) bool { return n.GetParam("name") == "a2" })
+
+	// Tree A deletes the child
+	if err := treeA.DeleteNode(childID); err != nil {
+		t.Fatal(err)
+	}
+	eventually(nodeID, func(n *Node) bool { return len(n.GetChildIDs()) == 0 })
+}
+
+func TestTreeCachePolicy(t *testing.T) {
+	repo := memory.NewMemoryRepository()
+	tree, err := NewTree("Test tree", repo, 4, WithCachePolicy(structure.NewLFUPolicy[string]())) // two nodes are kept
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.RegistserNodeSchemaFromJson("node_schema_test.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	hotID, err := tree.RegisterNode("BaseNode", map[string]any{"name": "Hot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if _, err := tree.GetNode(hotID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range 3 {
+		if _, err := tree.RegisterNode("BaseNode", map[string]any{"name": fmt.Sprintf("Cold %v", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, ok := tree.cache.Peek(hotID); !ok {
+		t.Fatalf("frequently used node is expected to be kept in the cache")
+	}
+	if stats := tree.CacheStats(); stats.Size != 2 || stats.Evictions != 2 || stats.Hits != 3 {
+		t.Fatalf("unexpected cache stats %+v", stats)
+	}
+}
@@ -0,0 +1,151 @@
+package scene
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/world-in-progress/yggdrasil/auth"
+	"github.com/world-in-progress/yggdrasil/node"
+)
+
+// SetAuthorizer sets the authorizer checking accesses made through the scene.
+// A nil authorizer allows every access.
+func (s *Scene) SetAuthorizer(authorizer auth.IAuthorizer) {
+	s.Authorizer = authorizer
+}
+
+// authorize checks if the principal carried by ctx holds a permission on a node, one of its attributes or components.
+func (s *Scene) authorize(ctx context.Context, permission auth.Permission, nodeID, attribute, compoID string) error {
+	if s.Authorizer == nil {
+		return nil
+	}
+
+	resource, err := s.resourceOf(ctx, nodeID)
+	if err != nil {
+		return err
+	}
+	resource.Attribute = attribute
+	resource.ComponentID = compoID
+
+	principal := auth.PrincipalFromContext(ctx)
+	if !s.Authorizer.Authorize(ctx, principal, permission, resource) {
+		return permissionError(principal, permission, resource)
+	}
+	return nil
+}
+
+// authorizeNew checks if the principal carried by ctx holds a permission on a node to be created under a parent.
+func (s *Scene) authorizeNew(ctx context.Context, permission auth.Permission, schemaName, parentID string) error {
+	if s.Authorizer == nil {
+		return nil
+	}
+
+	resource := auth.Resource{Schema: schemaName}
+	if parentID != "" {
+		parent, err := s.resourceOf(ctx, parentID)
+		if err != nil {
+			return err
+		}
+		resource.Ancestors = append([]string{parentID}, parent.Ancestors...)
+	}
+
+	principal := auth.PrincipalFromContext(ctx)
+	if !s.Authorizer.Authorize(ctx, principal, permission, resource) {
+		return permissionError(principal, permission, resource)
+	}
+	return nil
+}
+
+// authorizeScene checks if the principal carried by ctx holds a permission on the scene as a whole,
+// such as managing components and templates. Only policies not scoped to subtrees or schemas grant it.
+func (s *Scene) authorizeScene(ctx context.Context, permission auth.Permission, compoID string) error {
+	if s.Authorizer == nil {
+		return nil
+	}
+
+	resource := auth.Resource{ComponentID: compoID}
+	principal := auth.PrincipalFromContext(ctx)
+	if !s.Authorizer.Authorize(ctx, principal, permission, resource) {
+		return permissionError(principal, permission, resource)
+	}
+	return nil
+}
+
+// redact returns a copy of node attributes holding only those the principal carried by ctx can read.
+// The node ID is never redacted. Error is returned if no other attribute is readable.
+func (s *Scene) redact(ctx context.Context, nodeID string, attributes map[string]any) (map[string]any, error) {
+	redacted := make(map[string]any, len(attributes))
+	if s.Authorizer == nil {
+		for name, value := range attributes {
+			redacted[name] = value
+		}
+		return redacted, nil
+	}
+
+	resource, err := s.resourceOf(ctx, nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	principal := auth.PrincipalFromContext(ctx)
+	for name, value := range attributes {
+		resource.Attribute = name
+		if name == "_id" || s.Authorizer.Authorize(ctx, principal, auth.Read, resource) {
+			redacted[name] = value
+		}
+	}
+	if len(redacted) <= 1 {
+		resource.Attribute = ""
+		return nil, permissionError(principal, auth.Read, resource)
+	}
+	return redacted, nil
+}
+
+// resourceOf describes a node as an authorization resource, collecting its ancestors through the tree.
+func (s *Scene) resourceOf(ctx context.Context, nodeID string) (auth.Resource, error) {
+	resource := auth.Resource{
+		NodeID: nodeID,
+		Schema: strings.Split(nodeID, "-")[0],
+	}
+
+	visited := map[string]bool{nodeID: true}
+	for ID := nodeID; ; {
+		n, err := s.Tree.GetNodeCtx(ctx, ID)
+		if err != nil {
+			return resource, fmt.Errorf("failed to get node by ID %v: %v", ID, err)
+		}
+		parentID := n.GetParentID()
+		if parentID == "" || visited[parentID] {
+			return resource, nil
+		}
+		visited[parentID] = true
+		resource.Ancestors = append(resource.Ancestors, parentID)
+		ID = parentID
+	}
+}
+
+// userSource attributes attribute changes made with ctx to the principal it carries.
+func userSource(ctx context.Context) context.Context {
+	source := node.ChangeSourceFromContext(ctx)
+	if source.PrincipalID == "" {
+		source.PrincipalID = auth.PrincipalFromContext(ctx).ID
+	}
+	return node.WithChangeSource(ctx, source)
+}
+
+func permissionError(principal auth.Principal, permission auth.Permission, resource auth.Resource) error {
+	target := "node " + resource.NodeID
+	if resource.NodeID == "" && resource.Schema != "" {
+		target = "new node of schema " + resource.Schema
+	} else if resource.NodeID == "" {
+		target = "scene"
+	}
+	if resource.Attribute != "" {
+		target = fmt.Sprintf("attribute %s of %s", resource.Attribute, target)
+	}
+	if resource.ComponentID != "" {
+		target = fmt.Sprintf("component %s of %s", resource.ComponentID, target)
+	}
+	return fmt.Errorf("%w: principal %s has no %s permission on %s", auth.ErrPermissionDenied, principal.ID, permission, target)
+}
@@ -0,0 +1,151 @@
+package scene
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/world-in-progress/yggdrasil/auth"
+	"github.com/world-in-progress/yggdrasil/component"
+	"github.com/world-in-progress/yggdrasil/db/memory"
+)
+
+func newTestScene(t *testing.T) *Scene {
+	scene, err := NewSceneWithRepository("Test scene", memory.NewMemoryRepository(), 1, 4, 16, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(scene.Dispatcher.Shutdown)
+
+	if _, err = scene.Tree.RegistserNodeSchemaFromJson("node_schema_test.json"); err != nil {
+		t.Fatal(err)
+	}
+	return scene
+}
+
+func TestSceneAuthorization(t *testing.T) {
+	scene := newTestScene(t)
+
+	rootID, err := scene.RegisterNode("BaseNode", map[string]any{"name": "Root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	childID, err := scene.RegisterNode("SumNode", map[string]any{"name": "Child", "parent": rootID, "result": 0.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherID, err := scene.RegisterNode("SumNode", map[string]any{"name": "Other", "result": 0.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scene.SetAuthorizer(auth.NewPolicyAuthorizer(
+		auth.Policy{Subjects: []string{"owner"}, Permissions: []auth.Permission{auth.Admin}, Subtree: rootID},
+		auth.Policy{Subjects: []string{"role:viewer"}, Permissions: []auth.Permission{auth.Read}, Attributes: []string{"name"}},
+	))
+	owner := auth.WithPrincipal(context.Background(), auth.Principal{ID: "owner"})
+	viewer := auth.WithPrincipal(context.Background(), auth.Principal{ID: "viewer", Roles: []string{"viewer"}})
+
+	// owner administrates nodes of its subtree only
+	if err := scene.UpdateNodeAttributeCtx(owner, childID, "result", 1.0); err != nil {
+		t.Fatalf("owner is expected to write nodes of its subtree: %v", err)
+	}
+	if err := scene.UpdateNodeAttributeCtx(owner, otherID, "result", 1.0); !errors.Is(err, auth.ErrPermissionDenied) {
+		t.Fatalf("owner is expected not to write nodes out of its subtree, but got %v", err)
+	}
+	if _, err := scene.RegisterNodeCtx(owner, "BaseNode", map[string]any{"name": "Grandchild", "parent": childID}); err != nil {
+		t.Fatalf("owner is expected to register nodes in its subtree: %v", err)
+	}
+
+	// viewer can only see names
+	if _, err := scene.GetNodeCtx(viewer, childID); !errors.Is(err, auth.ErrPermissionDenied) {
+		t.Fatalf("viewer is expected not to get the whole node, but got %v", err)
+	}
+	attributes, err := scene.ReadNodeCtx(viewer, childID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attributes) != 2 || attributes["_id"] != childID || attributes["name"] != "Child" {
+		t.Fatalf("attributes read by viewer are expected to be redacted, but are %v", attributes)
+	}
+
+	// anonymous callers have no permission
+	if _, err := scene.ReadNodeCtx(context.Background(), childID); !errors.Is(err, auth.ErrPermissionDenied) {
+		t.Fatalf("anonymous caller is expected not to read nodes, but got %v", err)
+	}
+	if _, err := scene.InvokeNodeComponentCtx(viewer, string(Sync), childID, "RESTFUL-compo", nil, nil); !errors.Is(err, auth.ErrPermissionDenied) {
+		t.Fatalf("viewer is expected not to invoke components, but got %v", err)
+	}
+	if err := scene.DeleteNode(otherID); !errors.Is(err, auth.ErrPermissionDenied) {
+		t.Fatalf("anonymous caller is expected not to delete nodes, but got %v", err)
+	}
+}
+
+func TestSceneWideAuthorization(t *testing.T) {
+	scene := newTestScene(t)
+	rootID, err := scene.RegisterNode("BaseNode", map[string]any{"name": "Root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compoSchema := map[string]any{
+		"method": "GET",
+		"name":   "Test API",
+		"api":    "http://localhost",
+		"resStatuses": []any{
+			map[string]any{"code": 200, "schema": "application/json"},
+		},
+	}
+	compoID, err := scene.RegisterComponent(component.Restful, compoSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scene.SetAuthorizer(auth.NewPolicyAuthorizer(
+		auth.Policy{Subjects: []string{"admin"}, Permissions: []auth.Permission{auth.Admin}},
+		auth.Policy{Subjects: []string{"owner"}, Permissions: []auth.Permission{auth.Admin}, Subtree: rootID},
+		auth.Policy{Subjects: []string{"schema-owner"}, Permissions: []auth.Permission{auth.Admin}, Schema: "BaseNode"},
+		auth.Policy{Subjects: []string{"reader"}, Permissions: []auth.Permission{auth.Read}},
+	))
+	admin := auth.WithPrincipal(context.Background(), auth.Principal{ID: "admin"})
+	reader := auth.WithPrincipal(context.Background(), auth.Principal{ID: "reader"})
+
+	// policies scoped to subtrees or schemas do not grant permissions on the scene
+	for _, ID := range []string{"owner", "schema-owner"} {
+		ctx := auth.WithPrincipal(context.Background(), auth.Principal{ID: ID})
+		if _, err := scene.RegisterComponentCtx(ctx, component.Restful, compoSchema); !errors.Is(err, auth.ErrPermissionDenied) {
+			t.Fatalf("%s is expected not to register components, but got %v", ID, err)
+		}
+		if _, err := scene.GetComponentCtx(ctx, compoID); !errors.Is(err, auth.ErrPermissionDenied) {
+			t.Fatalf("%s is expected not to get components, but got %v", ID, err)
+		}
+		if err := scene.DeleteComponentCtx(ctx, compoID); !errors.Is(err, auth.ErrPermissionDenied) {
+			t.Fatalf("%s is expected not to delete components, but got %v", ID, err)
+		}
+		if _, err := scene.RegisterNodeTemplateCtx(ctx, "Template", "BaseNode", nil); !errors.Is(err, auth.ErrPermissionDenied) {
+			t.Fatalf("%s is expected not to register templates, but got %v", ID, err)
+		}
+	}
+
+	// readers of the scene get components only
+	if _, err := scene.GetComponentCtx(reader, compoID); err != nil {
+		t.Fatalf("reader is expected to get components: %v", err)
+	}
+	if err := scene.DeleteComponentCtx(reader, compoID); !errors.Is(err, auth.ErrPermissionDenied) {
+		t.Fatalf("reader is expected not to delete components, but got %v", err)
+	}
+
+	// admins of the scene manage templates and components
+	templateID, err := scene.RegisterNodeTemplateCtx(admin, "Template", "BaseNode", []string{compoID})
+	if err != nil {
+		t.Fatalf("admin is expected to register templates: %v", err)
+	}
+	if err := scene.DeleteNodeTemplateCtx(reader, templateID); !errors.Is(err, auth.ErrPermissionDenied) {
+		t.Fatalf("reader is expected not to delete templates, but got %v", err)
+	}
+	if err := scene.DeleteNodeTemplateCtx(admin, templateID); err != nil {
+		t.Fatalf("admin is expected to delete templates: %v", err)
+	}
+	if err := scene.DeleteComponentCtx(admin, compoID); err != nil {
+		t.Fatalf("admin is expected to delete components: %v", err)
+	}
+}
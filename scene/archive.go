@@ -0,0 +1,602 @@
+package scene
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/world-in-progress/yggdrasil/auth"
+	"github.com/world-in-progress/yggdrasil/component"
+	"github.com/world-in-progress/yggdrasil/component/restfulcomponent"
+)
+
+// ArchiveVersion is the version of archives written by Export. Import reads archives up to this version.
+const ArchiveVersion = 1
+
+const (
+	// ConflictFail fails an import if a record of the archive conflicts with an existing one.
+	ConflictFail ConflictPolicy = iota
+	// ConflictSkip keeps the existing record, which imported records refer to instead.
+	ConflictSkip
+	// ConflictRemap imports a node or component conflicting by ID with a new ID.
+	// Schemas and templates conflicting by name are kept as with ConflictSkip.
+	ConflictRemap
+)
+
+type (
+	// ConflictPolicy decides how records of an archive conflicting with existing ones are imported.
+	// Nodes and components conflict if their IDs are kept and exist already,
+	// schemas and templates if others of their names exist and differ from them.
+	ConflictPolicy int
+
+	// ImportOptions configures an import of an archive, see Scene.ImportCtx.
+	ImportOptions struct {
+		ParentID   string // node the root of the archive is imported under, none by default
+		KeepIDs    bool   // keeps IDs of nodes, components and templates, rather than generating new ones
+		OnConflict ConflictPolicy
+	}
+
+	// archiveEntry is a line of an archive. The first line is the header, which carries the version
+	// and the root node, and every other line carries a record of a schema, component, template or node.
+	archiveEntry struct {
+		Type    string         `json:"type"`
+		Version int            `json:"version,omitempty"`
+		Root    string         `json:"root,omitempty"`
+		Record  map[string]any `json:"record,omitempty"`
+	}
+
+	// archive is an archive read by Import.
+	archive struct {
+		root       string
+		schemas    []map[string]any
+		components []map[string]any
+		templates  []map[string]any
+		nodes      []map[string]any
+	}
+
+	// importPlan is the records of an archive to write, with IDs mapped to the ones they are imported with.
+	importPlan struct {
+		ids        map[string]string
+		schemas    []map[string]any
+		components []map[string]any
+		templates  []map[string]any
+		nodes      []map[string]any
+	}
+)
+
+const (
+	headerEntry    = "header"
+	schemaEntry    = "schema"
+	componentEntry = "component"
+	templateEntry  = "template"
+	nodeEntry      = "node"
+)
+
+func (s *Scene) Export(rootID string, w io.Writer) error {
+	return s.ExportCtx(context.Background(), rootID, w)
+}
+
+// ExportCtx writes an archive of a subtree if the principal carried by ctx can read it. The archive is made of
+// JSON Lines holding the nodes of the subtree, the schemas they follow including the ones extended or referred to,
+// and the components and templates they are bound to. Active nodes are written back before being exported.
+func (s *Scene) ExportCtx(ctx context.Context, rootID string, w io.Writer) error {
+	if err := s.authorize(ctx, auth.Read, rootID, "", ""); err != nil {
+		return fmt.Errorf("scene %v cannot export node %v: %w", s.Name, rootID, err)
+	}
+	if err := s.authorizeScene(ctx, auth.Read, ""); err != nil {
+		return fmt.Errorf("scene %v cannot export node %v: %w", s.Name, rootID, err)
+	}
+
+	nodes, err := s.exportNodes(ctx, rootID)
+	if err != nil {
+		return fmt.Errorf("scene %v cannot export node %v: %v", s.Name, rootID, err)
+	}
+
+	// Collect components, templates and schemas the nodes refer to
+	var compoIDs, templateIDs, schemaNames []string
+	for _, record := range nodes {
+		compoIDs = appendUnique(compoIDs, stringsOf(record["components"])...)
+		if templateID, ok := record["template"].(string); ok && templateID != "" {
+			templateIDs = appendUnique(templateIDs, templateID)
+		}
+		schemaNames = appendUnique(schemaNames, schemaOf(record["_id"].(string)))
+	}
+	templates, err := s.readRecords(ctx, "nodetemplate", templateIDs)
+	if err != nil {
+		return fmt.Errorf("scene %v cannot export templates: %v", s.Name, err)
+	}
+	for _, record := range templates {
+		compoIDs = appendUnique(compoIDs, stringsOf(record["components"])...)
+		if schemaName, ok := record["schema"].(string); ok {
+			schemaNames = appendUnique(schemaNames, schemaName)
+		}
+	}
+	components, err := s.readRecords(ctx, "composchema", compoIDs)
+	if err != nil {
+		return fmt.Errorf("scene %v cannot export components: %v", s.Name, err)
+	}
+	schemas, err := s.exportSchemas(ctx, schemaNames)
+	if err != nil {
+		return fmt.Errorf("scene %v cannot export schemas: %v", s.Name, err)
+	}
+
+	// Write archive
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+	if err := encoder.Encode(archiveEntry{Type: headerEntry, Version: ArchiveVersion, Root: rootID}); err != nil {
+		return fmt.Errorf("failed to write archive: %v", err)
+	}
+	for _, group := range []struct {
+		entryType string
+		records   []map[string]any
+	}{
+		{schemaEntry, schemas},
+		{componentEntry, components},
+		{templateEntry, templates},
+		{nodeEntry, nodes},
+	} {
+		for _, record := range group.records {
+			if err := encoder.Encode(archiveEntry{Type: group.entryType, Record: record}); err != nil {
+				return fmt.Errorf("failed to write archive: %v", err)
+			}
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write archive: %v", err)
+	}
+	return nil
+}
+
+// exportNodes reads records of a subtree, parents before children, without their versions.
+func (s *Scene) exportNodes(ctx context.Context, rootID string) ([]map[string]any, error) {
+	nodes, err := s.Tree.ReadSubtreeCtx(ctx, rootID)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range nodes {
+		delete(record, "_version")
+	}
+	return nodes, nil
+}
+
+// exportSchemas reads records of schemas and the ones they depend on, dependencies first.
+func (s *Scene) exportSchemas(ctx context.Context, schemaNames []string) ([]map[string]any, error) {
+	var schemas []map[string]any
+	visited := make(map[string]bool)
+	var visit func(name string) error
+	visit = func(name string) error {
+		if visited[name] {
+			return nil
+		}
+		visited[name] = true
+
+		deps, err := s.Tree.SchemaMgr.GetDependenciesCtx(ctx, name)
+		if err != nil {
+			return err
+		}
+		for _, dep := range deps {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		record, err := s.Repo.ReadOne(ctx, "nodeschema", map[string]any{"name": name})
+		if err != nil {
+			return fmt.Errorf("failed to read schema %s: %v", name, err)
+		}
+		schemas = append(schemas, record)
+		return nil
+	}
+
+	for _, name := range schemaNames {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return schemas, nil
+}
+
+func (s *Scene) readRecords(ctx context.Context, table string, IDs []string) ([]map[string]any, error) {
+	if len(IDs) == 0 {
+		return nil, nil
+	}
+	records, err := s.Repo.ReadAll(ctx, table, map[string]any{"_id": map[string]any{"$in": IDs}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read records of %s: %v", table, err)
+	}
+
+	// Keep the order of IDs
+	byID := make(map[string]map[string]any, len(records))
+	for _, record := range records {
+		byID[record["_id"].(string)] = record
+	}
+	ordered := make([]map[string]any, 0, len(records))
+	for _, ID := range IDs {
+		if record, ok := byID[ID]; ok {
+			ordered = append(ordered, record)
+		}
+	}
+	return ordered, nil
+}
+
+func (s *Scene) Import(r io.Reader, opts ImportOptions) (map[string]string, error) {
+	return s.ImportCtx(context.Background(), r, opts)
+}
+
+// ImportCtx reads an archive written by Export, and imports its records if the principal carried by ctx is admin
+// of the scene and of the parent node. It returns the IDs records are imported with, by their IDs in the archive.
+// Every record is validated before any is written, and records are written in a unit of work, see TransactionCtx.
+// Schemas and templates existing with the same names are not imported again.
+func (s *Scene) ImportCtx(ctx context.Context, r io.Reader, opts ImportOptions) (map[string]string, error) {
+	a, err := readArchive(r)
+	if err != nil {
+		return nil, fmt.Errorf("scene %v cannot import archive: %v", s.Name, err)
+	}
+	if err := s.authorizeScene(ctx, auth.Admin, ""); err != nil {
+		return nil, fmt.Errorf("scene %v cannot import archive: %w", s.Name, err)
+	}
+	if err := s.authorizeNew(ctx, auth.Admin, schemaOf(a.root), opts.ParentID); err != nil {
+		return nil, fmt.Errorf("scene %v cannot import archive: %w", s.Name, err)
+	}
+
+	plan, err := s.planImport(ctx, a, opts)
+	if err != nil {
+		return nil, fmt.Errorf("scene %v cannot import archive: %v", s.Name, err)
+	}
+
+	err = s.TransactionCtx(ctx, func(uow *UnitOfWork) error {
+		for _, record := range plan.schemas {
+			if err := uow.registerSchema(record); err != nil {
+				return err
+			}
+		}
+		for _, record := range plan.components {
+			if err := uow.createRecord("composchema", record); err != nil {
+				return err
+			}
+		}
+		for _, record := range plan.templates {
+			if err := uow.createRecord("nodetemplate", record); err != nil {
+				return err
+			}
+		}
+		for _, record := range plan.nodes {
+			if err := uow.importNode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scene %v cannot import archive: %v", s.Name, err)
+	}
+	return plan.ids, nil
+}
+
+func readArchive(r io.Reader) (*archive, error) {
+	decoder := json.NewDecoder(r)
+	var header archiveEntry
+	if err := decoder.Decode(&header); err != nil {
+		return nil, fmt.Errorf("failed to read archive header: %v", err)
+	}
+	if header.Type != headerEntry {
+		return nil, fmt.Errorf("archive does not start with a header")
+	}
+	if header.Version < 1 || header.Version > ArchiveVersion {
+		return nil, fmt.Errorf("archive version %d is not supported", header.Version)
+	}
+
+	a := &archive{root: header.Root}
+	for {
+		var entry archiveEntry
+		if err := decoder.Decode(&entry); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %v", err)
+		}
+		if _, ok := entry.Record["_id"].(string); !ok && entry.Type != schemaEntry {
+			return nil, fmt.Errorf("%s record %v of archive has no ID", entry.Type, entry.Record)
+		}
+
+		switch entry.Type {
+		case schemaEntry:
+			a.schemas = append(a.schemas, entry.Record)
+		case componentEntry:
+			a.components = append(a.components, entry.Record)
+		case templateEntry:
+			a.templates = append(a.templates, entry.Record)
+		case nodeEntry:
+			a.nodes = append(a.nodes, entry.Record)
+		default:
+			return nil, fmt.Errorf("archive entry type %s is not supported", entry.Type)
+		}
+	}
+
+	if len(a.nodes) == 0 || a.nodes[0]["_id"] != a.root {
+		return nil, fmt.Errorf("archive does not start with its root node %s", a.root)
+	}
+	return a, nil
+}
+
+// planImport validates records of an archive against the scene, and maps them to the records to write.
+func (s *Scene) planImport(ctx context.Context, a *archive, opts ImportOptions) (*importPlan, error) {
+	plan := &importPlan{ids: make(map[string]string)}
+
+	// Schemas, validated by a schema manager holding the schemas in effect once imported
+	for _, record := range a.schemas {
+		name, _ := record["name"].(string)
+		existing, err := s.Repo.ReadOne(ctx, "nodeschema", map[string]any{"name": name})
+		if err != nil {
+			plan.schemas = append(plan.schemas, record)
+			continue
+		}
+		if !sameFields(existing, record, "extends", "fields") && opts.OnConflict == ConflictFail {
+			return nil, fmt.Errorf("schema %s conflicts with an existing one", name)
+		}
+	}
+	validator, err := s.Tree.SchemaMgr.ValidateSchemasCtx(ctx, plan.schemas)
+	if err != nil {
+		return nil, err
+	}
+
+	// Components
+	for _, record := range a.components {
+		ID := record["_id"].(string)
+		compoType := component.ComponentType(strings.Split(ID, "-")[0])
+		if compoType != component.Restful {
+			return nil, fmt.Errorf("component %s is of an unsupported type %s", ID, compoType)
+		}
+		schema, err := restfulcomponent.NewRestfulComponent(record)
+		if err != nil {
+			return nil, fmt.Errorf("component %s is not valid: %v", ID, err)
+		}
+
+		newID, write, err := s.mapID(ctx, "composchema", ID, schema["_id"].(string), opts)
+		if err != nil {
+			return nil, err
+		}
+		plan.ids[ID] = newID
+		if write {
+			schema["_id"] = newID
+			plan.components = append(plan.components, schema)
+		}
+	}
+
+	// Templates, matched by name
+	for _, record := range a.templates {
+		ID := record["_id"].(string)
+		name, _ := record["name"].(string)
+		schemaName, _ := record["schema"].(string)
+		if !validator.HasSchemaCtx(ctx, schemaName) {
+			return nil, fmt.Errorf("schema %s of template %s does not exist", schemaName, name)
+		}
+		components, err := plan.mapIDs(stringsOf(record["components"]))
+		if err != nil {
+			return nil, fmt.Errorf("template %s is not valid: %v", name, err)
+		}
+
+		if existing, err := s.Repo.ReadOne(ctx, "nodetemplate", map[string]any{"name": name}); err == nil {
+			if opts.OnConflict == ConflictFail && (existing["schema"] != schemaName || !slices.Equal(stringsOf(existing["components"]), components)) {
+				return nil, fmt.Errorf("template %s conflicts with an existing one", name)
+			}
+			plan.ids[ID] = existing["_id"].(string)
+			continue
+		}
+
+		newID := ID
+		if !opts.KeepIDs {
+			newID = uuid.New().String()
+		}
+		plan.ids[ID] = newID
+		plan.templates = append(plan.templates, map[string]any{
+			"_id":        newID,
+			"name":       name,
+			"schema":     schemaName,
+			"components": components,
+		})
+	}
+
+	// Nodes, parents before children
+	for _, record := range a.nodes {
+		ID := record["_id"].(string)
+		schemaName := schemaOf(ID)
+		if !validator.HasSchemaCtx(ctx, schemaName) {
+			return nil, fmt.Errorf("schema %s of node %s does not exist", schemaName, ID)
+		}
+
+		newID, write, err := s.mapID(ctx, "node", ID, schemaName+"-"+uuid.New().String(), opts)
+		if err != nil {
+			return nil, err
+		}
+		plan.ids[ID] = newID
+		if !write {
+			continue
+		}
+
+		nodeInfo := make(map[string]any, len(record))
+		for name, value := range record {
+			nodeInfo[name] = value
+		}
+		nodeInfo["_id"] = newID
+		delete(nodeInfo, "parent")
+		if ID == a.root {
+			if opts.ParentID != "" {
+				if count, err := s.Repo.Count(ctx, "node", map[string]any{"_id": opts.ParentID}); err != nil || count == 0 {
+					return nil, fmt.Errorf("parent node %s does not exist", opts.ParentID)
+				}
+				nodeInfo["parent"] = opts.ParentID
+			}
+		} else {
+			parentID, _ := record["parent"].(string)
+			if nodeInfo["parent"], err = plan.mapID(parentID); err != nil {
+				return nil, fmt.Errorf("node %s is not valid: %v", ID, err)
+			}
+		}
+		if _, ok := record["components"]; ok {
+			compoIDs, err := plan.mapIDs(stringsOf(record["components"]))
+			if err != nil {
+				return nil, fmt.Errorf("node %s is not valid: %v", ID, err)
+			}
+			components := make([]any, len(compoIDs))
+			for i, compoID := range compoIDs {
+				components[i] = compoID
+			}
+			nodeInfo["components"] = components
+		}
+		if templateID, ok := record["template"].(string); ok && templateID != "" {
+			if nodeInfo["template"], err = plan.mapID(templateID); err != nil {
+				return nil, fmt.Errorf("node %s is not valid: %v", ID, err)
+			}
+		}
+
+		if err := validator.ValidateCtx(ctx, schemaName, nodeInfo); err != nil {
+			return nil, fmt.Errorf("node %s is not valid: %v", ID, err)
+		}
+		plan.nodes = append(plan.nodes, nodeInfo)
+	}
+	return plan, nil
+}
+
+// mapID maps the ID of a record to the one it is imported with, and reports if the record is written.
+// newID is used unless IDs are kept.
+func (s *Scene) mapID(ctx context.Context, table, ID, newID string, opts ImportOptions) (string, bool, error) {
+	if !opts.KeepIDs {
+		return newID, true, nil
+	}
+
+	count, err := s.Repo.Count(ctx, table, map[string]any{"_id": ID})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to check if record %s exists: %v", ID, err)
+	}
+	if count == 0 {
+		return ID, true, nil
+	}
+
+	switch opts.OnConflict {
+	case ConflictSkip:
+		return ID, false, nil
+	case ConflictRemap:
+		return newID, true, nil
+	default:
+		return "", false, fmt.Errorf("record %s of %s conflicts with an existing one", ID, table)
+	}
+}
+
+func (p *importPlan) mapID(ID string) (string, error) {
+	newID, ok := p.ids[ID]
+	if !ok {
+		return "", fmt.Errorf("%s is not in the archive", ID)
+	}
+	return newID, nil
+}
+
+func (p *importPlan) mapIDs(IDs []string) ([]string, error) {
+	mapped := make([]string, len(IDs))
+	for i, ID := range IDs {
+		newID, err := p.mapID(ID)
+		if err != nil {
+			return nil, err
+		}
+		mapped[i] = newID
+	}
+	return mapped, nil
+}
+
+// registerSchema registers a schema, which is deleted on rollback.
+func (u *UnitOfWork) registerSchema(record map[string]any) error {
+	name, _ := record["name"].(string)
+	info := map[string]any{"name": name, "extends": record["extends"], "fields": record["fields"]}
+	if _, err := u.scene.Tree.RegisterNodeSchemaCtx(u.ctx, info); err != nil {
+		return fmt.Errorf("failed to register schema %s: %v", name, err)
+	}
+
+	u.undo = append(u.undo, func(ctx context.Context) error {
+		return u.scene.Tree.SchemaMgr.DeleteSchemaCtx(ctx, name, true)
+	})
+	return nil
+}
+
+// createRecord creates a record with its ID, which is deleted on rollback.
+func (u *UnitOfWork) createRecord(table string, record map[string]any) error {
+	ID, err := u.scene.Repo.Create(u.ctx, table, record)
+	if err != nil {
+		return fmt.Errorf("failed to create record %v of %s: %v", record["_id"], table, err)
+	}
+
+	if !u.transactional {
+		u.undo = append(u.undo, func(ctx context.Context) error {
+			return u.scene.Repo.Delete(ctx, table, map[string]any{"_id": ID})
+		})
+	}
+	return nil
+}
+
+// importNode records a node with its ID, which is deleted on rollback.
+func (u *UnitOfWork) importNode(nodeInfo map[string]any) error {
+	parentID, _ := nodeInfo["parent"].(string)
+	if _, err := u.hold(parentID); err != nil {
+		return err
+	}
+
+	ID := nodeInfo["_id"].(string)
+	if err := u.scene.Tree.ImportNodeCtx(u.ctx, nodeInfo); err != nil {
+		return err
+	}
+
+	u.nodes[ID] = struct{}{}
+	if u.transactional {
+		u.undo = append(u.undo, u.discardNode(ID))
+	} else {
+		u.undo = append(u.undo, func(ctx context.Context) error {
+			return u.scene.Tree.DeleteNodeCtx(ctx, ID)
+		})
+	}
+	return nil
+}
+
+// sameFields checks if two records have the same values of keys.
+func sameFields(a, b map[string]any, keys ...string) bool {
+	for _, key := range keys {
+		x, errX := json.Marshal(a[key])
+		y, errY := json.Marshal(b[key])
+		if errX != nil || errY != nil || string(x) != string(y) {
+			return false
+		}
+	}
+	return true
+}
+
+// schemaOf returns the schema name of a node from its ID.
+func schemaOf(nodeID string) string {
+	return strings.Split(nodeID, "-")[0]
+}
+
+func stringsOf(value any) []string {
+	switch values := value.(type) {
+	case []string:
+		return values
+	case []any:
+		strs := make([]string, 0, len(values))
+		for _, v := range values {
+			if s, ok := v.(string); ok {
+				strs = append(strs, s)
+			}
+		}
+		return strs
+	}
+	return nil
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		if !slices.Contains(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
@@ -0,0 +1,124 @@
+package scene
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/world-in-progress/yggdrasil/db/memory"
+)
+
+// newArchive exports a root with a child bound to a component, and returns the archive with IDs of the nodes.
+func newArchive(t *testing.T, scene *Scene) (*bytes.Buffer, string, string) {
+	rootID, err := scene.RegisterNode("BaseNode", map[string]any{"name": "Root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	childID, err := scene.RegisterNode("SumNode", map[string]any{"name": "Child", "parent": rootID, "result": 1.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compoID := newTestComponent(t, scene, nil)
+	if err := scene.BindComponentToNode(childID, compoID); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := scene.Export(rootID, &buf); err != nil {
+		t.Fatal(err)
+	}
+	return &buf, rootID, childID
+}
+
+func TestArchiveImport(t *testing.T) {
+	source := newTestScene(t)
+	buf, rootID, childID := newArchive(t, source)
+
+	target, err := NewSceneWithRepository("Target scene", memory.NewMemoryRepository(), 1, 4, 16, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(target.Dispatcher.Shutdown)
+
+	ids, err := target.Import(buf, ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids[rootID] == rootID || ids[childID] == childID {
+		t.Fatalf("imported nodes are expected to have new IDs, but got %v", ids)
+	}
+
+	// Schemas are imported with the ones they extend
+	for _, name := range []string{"MongoDocument", "BaseNode", "SumNode"} {
+		if !target.Tree.SchemaMgr.HasSchema(name) {
+			t.Fatalf("schema %s is expected to be imported", name)
+		}
+	}
+	child, err := target.GetNode(ids[childID])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if child.GetParentID() != ids[rootID] || child.GetParam("result") != 1.0 {
+		t.Fatalf("child is expected to be imported under the root, but got %v", child.GetParentID())
+	}
+	compoIDs := stringsOf(child.GetParam("components"))
+	if len(compoIDs) != 1 {
+		t.Fatalf("child is expected to be bound to a component, but got %v", compoIDs)
+	}
+	if _, err := target.GetComponnet(compoIDs[0]); err != nil {
+		t.Fatalf("bound component is expected to be imported: %v", err)
+	}
+}
+
+func TestArchiveConflict(t *testing.T) {
+	scene := newTestScene(t)
+	buf, rootID, childID := newArchive(t, scene)
+	archive := buf.String()
+
+	if _, err := scene.Import(strings.NewReader(archive), ImportOptions{KeepIDs: true}); err == nil {
+		t.Fatalf("import is expected to fail by conflicting nodes")
+	}
+	if count, _ := scene.Tree.GetNodeRecordNum(); count != 2 {
+		t.Fatalf("nothing is expected to be written, but got %v node records", count)
+	}
+
+	ids, err := scene.Import(strings.NewReader(archive), ImportOptions{KeepIDs: true, OnConflict: ConflictSkip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids[rootID] != rootID || ids[childID] != childID {
+		t.Fatalf("existing nodes are expected to be kept, but got %v", ids)
+	}
+	if count, _ := scene.Tree.GetNodeRecordNum(); count != 2 {
+		t.Fatalf("no node is expected to be imported, but got %v node records", count)
+	}
+
+	ids, err = scene.Import(strings.NewReader(archive), ImportOptions{KeepIDs: true, OnConflict: ConflictRemap})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids[rootID] == rootID {
+		t.Fatalf("conflicting root is expected to be remapped")
+	}
+	if count, _ := scene.Tree.GetNodeRecordNum(); count != 4 {
+		t.Fatalf("remapped nodes are expected to be imported, but got %v node records", count)
+	}
+}
+
+func TestArchiveInvalid(t *testing.T) {
+	scene := newTestScene(t)
+	buf, _, _ := newArchive(t, scene)
+
+	// The child misses a required attribute
+	archive := strings.Replace(buf.String(), `"result":1`, `"other":1`, 1)
+	if _, err := scene.Import(strings.NewReader(archive), ImportOptions{}); err == nil {
+		t.Fatalf("import is expected to fail by an invalid node")
+	}
+	if count, _ := scene.Tree.GetNodeRecordNum(); count != 2 {
+		t.Fatalf("nothing is expected to be written, but got %v node records", count)
+	}
+
+	if _, err := scene.Import(strings.NewReader(`{"type":"header","version":2}`), ImportOptions{}); err == nil {
+		t.Fatalf("import is expected to fail by an unsupported version")
+	}
+}
@@ -0,0 +1,30 @@
+package scene
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSceneContextCancellation(t *testing.T) {
+	scene := newTestScene(t)
+
+	// a node only recorded in repository has to be activated through it
+	ID := "SumNode-00000000-0000-0000-0000-000000000000"
+	if _, err := scene.Repo.Create(context.Background(), "node", map[string]any{"_id": ID, "name": "Node", "result": 0.0}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := scene.GetNodeCtx(ctx, ID); err == nil {
+		t.Fatal("getting an inactive node with a canceled context is expected to fail")
+	}
+	if _, err := scene.RegisterNodeCtx(ctx, "SumNode", map[string]any{"name": "Node", "result": 0.0}); err == nil {
+		t.Fatal("registering a node with a canceled context is expected to fail")
+	}
+
+	if _, err := scene.GetNodeCtx(context.Background(), ID); err != nil {
+		t.Fatalf("node is expected to be activated after a canceled attempt: %v", err)
+	}
+}
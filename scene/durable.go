@@ -0,0 +1,504 @@
+package scene
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/world-in-progress/yggdrasil/auth"
+	"github.com/world-in-progress/yggdrasil/core/logger"
+	"github.com/world-in-progress/yggdrasil/core/threading"
+	nodeinterface "github.com/world-in-progress/yggdrasil/node/interface"
+)
+
+const (
+	invocationTable     = "invocation"
+	deadInvocationTable = "invocationdead"
+
+	InvocationPending InvocationState = "PENDING"
+	InvocationRunning InvocationState = "RUNNING"
+	// InvocationDead is the state of an invocation moved to the dead-letter collection after failing all attempts.
+	InvocationDead InvocationState = "DEAD"
+)
+
+type (
+	// InvocationState is the state of a durable invocation.
+	InvocationState string
+
+	// Invocation is a component invocation persisted in the repository, surviving restarts of the scene.
+	// Times are in Unix nanoseconds.
+	Invocation struct {
+		ID            string            `json:"_id"`
+		NodeID        string            `json:"nodeID"`
+		ComponentID   string            `json:"componentID"`
+		Params        map[string]any    `json:"params,omitempty"`
+		Headers       map[string]string `json:"headers,omitempty"`
+		PrincipalID   string            `json:"principalID"`
+		Roles         []string          `json:"roles,omitempty"`
+		Priority      int               `json:"priority"`
+		TimeoutMs     int64             `json:"timeoutMs,omitempty"`
+		State         InvocationState   `json:"state"`
+		Attempts      int               `json:"attempts"`
+		LastError     string            `json:"lastError,omitempty"`
+		LeaseOwner    string            `json:"leaseOwner,omitempty"`
+		LeasedAt      int64             `json:"leasedAt"`
+		LeaseUntil    int64             `json:"leaseUntil"`
+		NextAttemptAt int64             `json:"nextAttemptAt"`
+		CreatedAt     int64             `json:"createdAt"`
+	}
+
+	// DurableOptions configures durable invocations of a scene. Zero values fall back to defaults.
+	DurableOptions struct {
+		// Owner identifies the scene instance leasing invocations. An instance restarted with the same owner
+		// resumes the invocations it leased at once, instead of waiting for their leases to expire.
+		// A random owner is used by default.
+		Owner string
+		// LeaseDuration is the time an invocation is leased for, renewed while it runs. 30s by default.
+		LeaseDuration time.Duration
+		// MaxAttempts is the number of attempts before an invocation is dead-lettered. 5 by default.
+		MaxAttempts int
+		// Backoff is the delay before the second attempt, doubled for every further attempt up to MaxBackoff.
+		// 1s and 1m by default.
+		Backoff    time.Duration
+		MaxBackoff time.Duration
+		// PollInterval is the interval of checking for due invocations. 1s by default.
+		PollInterval time.Duration
+		// MaxInFlight is the number of invocations run concurrently by the scene. 16 by default.
+		MaxInFlight int
+	}
+
+	// durableQueue claims persisted invocations and runs them on the dispatcher of a scene.
+	durableQueue struct {
+		scene   *Scene
+		repo    nodeinterface.IAtomicRepository
+		opts    DurableOptions
+		started int64
+
+		ctx    context.Context
+		cancel context.CancelFunc
+		slots  chan struct{}
+		nudge  chan struct{}
+		wg     sync.WaitGroup
+	}
+)
+
+// StartDurableInvocations starts running durable invocations, resuming those left unfinished by previous runs.
+// The repository of the scene must implement nodeinterface.IAtomicRepository.
+func (s *Scene) StartDurableInvocations(opts DurableOptions) error {
+	repo, ok := s.Repo.(nodeinterface.IAtomicRepository)
+	if !ok {
+		return fmt.Errorf("repository of scene %v does not support durable invocations", s.Name)
+	}
+	if s.durable != nil {
+		return fmt.Errorf("durable invocations of scene %v have been started", s.Name)
+	}
+
+	if opts.Owner == "" {
+		opts.Owner = uuid.New().String()
+	}
+	if opts.LeaseDuration <= 0 {
+		opts.LeaseDuration = 30 * time.Second
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Minute
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.MaxInFlight <= 0 {
+		opts.MaxInFlight = 16
+	}
+
+	ctx, cancel := context.WithCancel(logger.ContextWithFields(context.Background(), logger.Fields{logger.SceneField: s.Name}))
+	q := &durableQueue{
+		scene:   s,
+		repo:    repo,
+		opts:    opts,
+		started: time.Now().UnixNano(),
+		ctx:     ctx,
+		cancel:  cancel,
+		slots:   make(chan struct{}, opts.MaxInFlight),
+		nudge:   make(chan struct{}, 1),
+	}
+	s.durable = q
+
+	q.wg.Add(1)
+	threading.GoSafe(q.run)
+	return nil
+}
+
+// StopDurableInvocations stops running durable invocations and waits for running ones to be released.
+// Released invocations are resumed by the next start, without counting the interrupted attempt.
+func (s *Scene) StopDurableInvocations() {
+	if s.durable == nil {
+		return
+	}
+	s.durable.cancel()
+	s.durable.wg.Wait()
+	s.durable = nil
+}
+
+func (s *Scene) EnqueueInvocation(nodeID, compoID string, params map[string]any, headers map[string]string, opts ...InvokeOption) (string, error) {
+	return s.EnqueueInvocationCtx(context.Background(), nodeID, compoID, params, headers, opts...)
+}
+
+// EnqueueInvocationCtx persists an invocation of a component of a node if the principal carried by ctx can invoke it,
+// and returns its ID. The invocation is run on behalf of the principal once durable invocations are started,
+// see StartDurableInvocations. Priority and timeout options are persisted with it.
+func (s *Scene) EnqueueInvocationCtx(ctx context.Context, nodeID, compoID string, params map[string]any, headers map[string]string, opts ...InvokeOption) (string, error) {
+	if err := s.authorize(ctx, auth.Invoke, nodeID, "", compoID); err != nil {
+		return "", fmt.Errorf("failed to enqueue invocation of component %v of node %v: %w", compoID, nodeID, err)
+	}
+
+	options := invokeOptions{priority: threading.PriorityNormal}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	principal := auth.PrincipalFromContext(ctx)
+	now := time.Now().UnixNano()
+	invocation := &Invocation{
+		ID:            uuid.New().String(),
+		NodeID:        nodeID,
+		ComponentID:   compoID,
+		Params:        params,
+		Headers:       headers,
+		PrincipalID:   principal.ID,
+		Roles:         principal.Roles,
+		Priority:      int(options.priority),
+		TimeoutMs:     options.timeout.Milliseconds(),
+		State:         InvocationPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	if _, err := s.Repo.Create(ctx, invocationTable, invocation.record()); err != nil {
+		return "", fmt.Errorf("failed to record invocation of component %v of node %v: %v", compoID, nodeID, err)
+	}
+
+	if s.durable != nil {
+		s.durable.notify()
+	}
+	return invocation.ID, nil
+}
+
+func (s *Scene) GetInvocation(ID string) (*Invocation, error) {
+	return s.GetInvocationCtx(context.Background(), ID)
+}
+
+// GetInvocationCtx gets a durable invocation, looking it up in the dead-letter collection if it is not queued.
+// Invocations are deleted once they succeed.
+func (s *Scene) GetInvocationCtx(ctx context.Context, ID string) (*Invocation, error) {
+	for _, table := range []string{invocationTable, deadInvocationTable} {
+		record, err := s.Repo.ReadOne(ctx, table, map[string]any{"_id": ID})
+		if err != nil || len(record) == 0 {
+			continue
+		}
+		invocation, err := convertToStruct[*Invocation](record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse invocation %v: %v", ID, err)
+		}
+		if err := s.authorize(ctx, auth.Read, invocation.NodeID, "", invocation.ComponentID); err != nil {
+			return nil, fmt.Errorf("scene %v cannot get invocation %v: %w", s.Name, ID, err)
+		}
+		return invocation, nil
+	}
+	return nil, fmt.Errorf("invocation %v does not exist", ID)
+}
+
+func (s *Scene) ListDeadInvocations() ([]*Invocation, error) {
+	return s.ListDeadInvocationsCtx(context.Background())
+}
+
+// ListDeadInvocationsCtx lists invocations dead-lettered after failing all attempts, if the principal carried by ctx
+// is admin of the scene.
+func (s *Scene) ListDeadInvocationsCtx(ctx context.Context) ([]*Invocation, error) {
+	if err := s.authorizeScene(ctx, auth.Admin, ""); err != nil {
+		return nil, fmt.Errorf("scene %v cannot list dead invocations: %w", s.Name, err)
+	}
+
+	records, err := s.Repo.ReadAll(ctx, deadInvocationTable, map[string]any{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead invocations: %v", err)
+	}
+	invocations := make([]*Invocation, 0, len(records))
+	for _, record := range records {
+		invocation, err := convertToStruct[*Invocation](record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse invocation %v: %v", record["_id"], err)
+		}
+		invocations = append(invocations, invocation)
+	}
+	return invocations, nil
+}
+
+func (s *Scene) RequeueDeadInvocation(ID string) error {
+	return s.RequeueDeadInvocationCtx(context.Background(), ID)
+}
+
+// RequeueDeadInvocationCtx moves a dead invocation back to the queue with its attempts reset,
+// if the principal carried by ctx is admin of the scene.
+func (s *Scene) RequeueDeadInvocationCtx(ctx context.Context, ID string) error {
+	if err := s.authorizeScene(ctx, auth.Admin, ""); err != nil {
+		return fmt.Errorf("scene %v cannot requeue invocation %v: %w", s.Name, ID, err)
+	}
+
+	record, err := s.Repo.ReadOne(ctx, deadInvocationTable, map[string]any{"_id": ID})
+	if err != nil {
+		return fmt.Errorf("dead invocation %v does not exist: %v", ID, err)
+	}
+	record["state"] = string(InvocationPending)
+	record["attempts"] = 0
+	record["nextAttemptAt"] = time.Now().UnixNano()
+	delete(record, "leaseOwner")
+	if _, err := s.Repo.Create(ctx, invocationTable, record); err != nil {
+		return fmt.Errorf("failed to requeue invocation %v: %v", ID, err)
+	}
+	if err := s.Repo.Delete(ctx, deadInvocationTable, map[string]any{"_id": ID}); err != nil {
+		return fmt.Errorf("failed to delete dead invocation %v: %v", ID, err)
+	}
+
+	if s.durable != nil {
+		s.durable.notify()
+	}
+	return nil
+}
+
+// record is the repository record of an invocation, keeping times as integers so that they compare exactly.
+func (inv *Invocation) record() map[string]any {
+	record := map[string]any{
+		"_id":           inv.ID,
+		"nodeID":        inv.NodeID,
+		"componentID":   inv.ComponentID,
+		"principalID":   inv.PrincipalID,
+		"priority":      inv.Priority,
+		"state":         string(inv.State),
+		"attempts":      inv.Attempts,
+		"leasedAt":      inv.LeasedAt,
+		"leaseUntil":    inv.LeaseUntil,
+		"nextAttemptAt": inv.NextAttemptAt,
+		"createdAt":     inv.CreatedAt,
+	}
+	if inv.Params != nil {
+		record["params"] = inv.Params
+	}
+	if inv.Headers != nil {
+		record["headers"] = inv.Headers
+	}
+	if inv.Roles != nil {
+		record["roles"] = inv.Roles
+	}
+	if inv.TimeoutMs > 0 {
+		record["timeoutMs"] = inv.TimeoutMs
+	}
+	if inv.LastError != "" {
+		record["lastError"] = inv.LastError
+	}
+	if inv.LeaseOwner != "" {
+		record["leaseOwner"] = inv.LeaseOwner
+	}
+	return record
+}
+
+// notify wakes the queue up to claim invocations.
+func (q *durableQueue) notify() {
+	select {
+	case q.nudge <- struct{}{}:
+	default:
+	}
+}
+
+// run claims due invocations whenever notified or polled, until the queue is stopped.
+func (q *durableQueue) run() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		q.claimAll()
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.nudge:
+		}
+	}
+}
+
+// claimAll claims and runs invocations while the scene can run more of them.
+func (q *durableQueue) claimAll() {
+	for q.ctx.Err() == nil {
+		select {
+		case q.slots <- struct{}{}:
+		default:
+			return
+		}
+
+		invocation, err := q.claim()
+		if err != nil || invocation == nil {
+			<-q.slots
+			if err != nil {
+				logger.FromContext(q.ctx).WithError(err).Warn("Failed to claim invocation")
+			}
+			return
+		}
+
+		q.wg.Add(1)
+		threading.GoSafe(func() { q.execute(invocation) })
+	}
+}
+
+// claim leases an invocation left by a previous run of the same owner, one whose lease has expired,
+// or a pending one due for an attempt, in this order.
+func (q *durableQueue) claim() (*Invocation, error) {
+	now := time.Now().UnixNano()
+	filters := []map[string]any{
+		{"state": string(InvocationRunning), "leaseOwner": q.opts.Owner, "leasedAt": map[string]any{"$lt": q.started}},
+		{"state": string(InvocationRunning), "leaseUntil": map[string]any{"$lt": now}},
+		{"state": string(InvocationPending), "nextAttemptAt": map[string]any{"$lte": now}},
+	}
+	update := map[string]any{
+		"$set": map[string]any{
+			"state":      string(InvocationRunning),
+			"leaseOwner": q.opts.Owner,
+			"leasedAt":   now,
+			"leaseUntil": now + int64(q.opts.LeaseDuration),
+		},
+		"$inc": map[string]any{"attempts": 1},
+	}
+
+	for _, filter := range filters {
+		record, err := q.repo.FindOneAndUpdate(q.ctx, invocationTable, filter, update, nodeinterface.ReturnAfter)
+		if err != nil {
+			return nil, err
+		}
+		if record != nil {
+			return convertToStruct[*Invocation](record)
+		}
+	}
+	return nil, nil
+}
+
+// execute runs a claimed invocation, renewing its lease while it runs, and records its outcome.
+func (q *durableQueue) execute(invocation *Invocation) {
+	defer q.wg.Done()
+	defer func() {
+		<-q.slots
+		q.notify()
+	}()
+
+	ctx := auth.WithPrincipal(q.ctx, auth.Principal{ID: invocation.PrincipalID, Roles: invocation.Roles})
+	ctx = logger.ContextWithFields(ctx, logger.Fields{"invocation": invocation.ID})
+
+	// Renew the lease while running
+	renewed := make(chan struct{})
+	stopRenewal := make(chan struct{})
+	threading.GoSafe(func() {
+		defer close(renewed)
+		ticker := time.NewTicker(q.opts.LeaseDuration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopRenewal:
+				return
+			case <-ticker.C:
+				q.update(invocation, map[string]any{"leaseUntil": time.Now().Add(q.opts.LeaseDuration).UnixNano()}, nil)
+			}
+		}
+	})
+
+	opts := []InvokeOption{WithPriority(threading.Priority(invocation.Priority))}
+	if invocation.TimeoutMs > 0 {
+		opts = append(opts, WithTimeout(time.Duration(invocation.TimeoutMs)*time.Millisecond))
+	}
+	params := invocation.Params
+	if params == nil {
+		params = map[string]any{}
+	}
+	task, err := q.scene.InvokeNodeComponentCtx(ctx, string(Sync), invocation.NodeID, invocation.ComponentID, params, invocation.Headers, opts...)
+	if err == nil {
+		_, err = task.(*SyncTask).SyncingCtx(ctx)
+	}
+	close(stopRenewal)
+	<-renewed
+
+	switch {
+	case err == nil:
+		q.delete(invocation)
+
+	case q.ctx.Err() != nil:
+		// Release the invocation interrupted by stopping, not counting the attempt
+		q.update(invocation, map[string]any{
+			"state":         string(InvocationPending),
+			"nextAttemptAt": time.Now().UnixNano(),
+		}, map[string]any{"attempts": -1})
+
+	case invocation.Attempts >= q.opts.MaxAttempts:
+		logger.FromContext(ctx).WithError(err).Warn("Invocation failed %d attempts and is dead-lettered", invocation.Attempts)
+		q.bury(invocation, err)
+
+	default:
+		logger.FromContext(ctx).WithError(err).Warn("Invocation failed attempt %d and is retried", invocation.Attempts)
+		q.update(invocation, map[string]any{
+			"state":         string(InvocationPending),
+			"lastError":     err.Error(),
+			"nextAttemptAt": time.Now().Add(q.backoff(invocation.Attempts)).UnixNano(),
+		}, nil)
+	}
+}
+
+// backoff is the delay before the attempt following the given one.
+func (q *durableQueue) backoff(attempts int) time.Duration {
+	delay := q.opts.Backoff
+	for i := 1; i < attempts && delay < q.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, q.opts.MaxBackoff)
+}
+
+// update updates an invocation if it is still leased by the queue, as it may have been claimed by another owner
+// once its lease expired.
+func (q *durableQueue) update(invocation *Invocation, set map[string]any, inc map[string]any) {
+	update := map[string]any{"$set": set}
+	if inc != nil {
+		update["$inc"] = inc
+	}
+	filter := map[string]any{"_id": invocation.ID, "leaseOwner": q.opts.Owner, "leasedAt": invocation.LeasedAt}
+
+	ctx := context.WithoutCancel(q.ctx)
+	if err := q.repo.Update(ctx, invocationTable, filter, update); err != nil {
+		logger.FromContext(ctx).WithError(err).Warn("Failed to update invocation %v", invocation.ID)
+	}
+}
+
+// delete deletes a succeeded invocation if it is still leased by the queue.
+func (q *durableQueue) delete(invocation *Invocation) {
+	ctx := context.WithoutCancel(q.ctx)
+	filter := map[string]any{"_id": invocation.ID, "leaseOwner": q.opts.Owner, "leasedAt": invocation.LeasedAt}
+	if err := q.repo.Delete(ctx, invocationTable, filter); err != nil {
+		logger.FromContext(ctx).WithError(err).Warn("Failed to delete succeeded invocation %v", invocation.ID)
+	}
+}
+
+// bury moves an invocation to the dead-letter collection.
+func (q *durableQueue) bury(invocation *Invocation, cause error) {
+	ctx := context.WithoutCancel(q.ctx)
+
+	invocation.State = InvocationDead
+	invocation.LastError = cause.Error()
+	invocation.LeaseOwner = ""
+	_, err := q.repo.Create(ctx, deadInvocationTable, invocation.record())
+	if err == nil {
+		err = q.repo.Delete(ctx, invocationTable, map[string]any{"_id": invocation.ID, "leaseOwner": q.opts.Owner})
+	}
+	if err != nil {
+		logger.FromContext(ctx).WithError(err).Error("Failed to dead-letter invocation %v", invocation.ID)
+	}
+}
@@ -0,0 +1,222 @@
+package scene
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/world-in-progress/yggdrasil/node"
+)
+
+// waitInvocation waits for an invocation to reach a state.
+func waitInvocation(t *testing.T, scene *Scene, ID string, state InvocationState) *Invocation {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		invocation, err := scene.GetInvocation(ID)
+		if err == nil && invocation.State == state {
+			return invocation
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("invocation %v is expected to be %v, but is %+v (%v)", ID, state, invocation, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitSucceeded waits for an invocation to succeed, that is to be deleted.
+func waitSucceeded(t *testing.T, scene *Scene, ID string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		count, err := scene.Repo.Count(t.Context(), invocationTable, map[string]any{"_id": ID})
+		if err == nil && count == 0 {
+			if count, _ := scene.Repo.Count(t.Context(), deadInvocationTable, map[string]any{"_id": ID}); count != 0 {
+				t.Fatalf("invocation %v is expected to succeed, but is dead-lettered", ID)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			invocation, err := scene.GetInvocation(ID)
+			t.Fatalf("invocation %v is expected to succeed, but is %+v (%v)", ID, invocation, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDurableInvocation(t *testing.T) {
+	scene := newTestScene(t)
+	var calls atomic.Int32
+	compoID := newTestComponent(t, scene, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"result": 42}`))
+	})
+	nodeID, err := scene.RegisterNode("SumNode", map[string]any{"name": "Node", "result": 0.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// invocations enqueued before starting are run once started
+	ID, err := scene.EnqueueInvocation(nodeID, compoID, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := scene.StartDurableInvocations(DurableOptions{PollInterval: 10 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	defer scene.StopDurableInvocations()
+
+	waitSucceeded(t, scene, ID)
+	if calls.Load() != 1 {
+		t.Fatalf("invocation is expected to succeed at the first attempt, but took %d", calls.Load())
+	}
+	node, _ := scene.GetNode(nodeID)
+	if result := node.GetParam("result"); result != 42.0 {
+		t.Fatalf("result of the invocation is expected to be written back, but is %v", result)
+	}
+}
+
+func TestDurableInvocationRetry(t *testing.T) {
+	scene := newTestScene(t)
+	var calls atomic.Int32
+	compoID := newTestComponent(t, scene, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"result": 42}`))
+	})
+	nodeID, err := scene.RegisterNode("SumNode", map[string]any{"name": "Node", "result": 0.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := scene.StartDurableInvocations(DurableOptions{
+		PollInterval: 5 * time.Millisecond,
+		Backoff:      10 * time.Millisecond,
+		MaxAttempts:  3,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer scene.StopDurableInvocations()
+
+	// failed attempts are retried with backoff
+	retried, _ := scene.EnqueueInvocation(nodeID, compoID, nil, nil)
+	waitSucceeded(t, scene, retried)
+	if calls.Load() != 3 {
+		t.Fatalf("invocation is expected to succeed at the third attempt, but took %d", calls.Load())
+	}
+
+	// invocations failing all attempts are dead-lettered
+	calls.Store(-10)
+	dead, _ := scene.EnqueueInvocation(nodeID, compoID, nil, nil)
+	invocation := waitInvocation(t, scene, dead, InvocationDead)
+	if invocation.Attempts != 3 || invocation.LastError == "" {
+		t.Fatalf("dead invocation is expected to record its attempts and error, but is %+v", invocation)
+	}
+	deadInvocations, err := scene.ListDeadInvocations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deadInvocations) != 1 || deadInvocations[0].ID != dead {
+		t.Fatalf("dead-letter collection is expected to hold the dead invocation, but holds %v", deadInvocations)
+	}
+
+	// requeued dead invocations are run again
+	calls.Store(10)
+	if err := scene.RequeueDeadInvocation(dead); err != nil {
+		t.Fatal(err)
+	}
+	waitSucceeded(t, scene, dead)
+}
+
+func TestDurableInvocationResume(t *testing.T) {
+	scene := newTestScene(t)
+	var calls atomic.Int32
+	compoID := newTestComponent(t, scene, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"result": 42}`))
+	})
+	nodeID, err := scene.RegisterNode("SumNode", map[string]any{"name": "Node", "result": 0.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a previous run of the same owner crashed while running an invocation leased for long
+	ID, _ := scene.EnqueueInvocation(nodeID, compoID, nil, nil)
+	leasedAt := time.Now().UnixNano()
+	err = scene.Repo.Update(t.Context(), invocationTable, map[string]any{"_id": ID}, map[string]any{
+		"$set": map[string]any{
+			"state":      string(InvocationRunning),
+			"leaseOwner": "instance",
+			"leasedAt":   leasedAt,
+			"leaseUntil": time.Now().Add(time.Hour).UnixNano(),
+			"attempts":   1,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another owner does not take the leased invocation over
+	if err := scene.StartDurableInvocations(DurableOptions{Owner: "other", PollInterval: 5 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	scene.StopDurableInvocations()
+	if invocation, _ := scene.GetInvocation(ID); invocation.State != InvocationRunning || invocation.LeaseOwner != "instance" {
+		t.Fatalf("invocation leased by another owner is expected to be left running, but is %+v", invocation)
+	}
+
+	// the restarted owner resumes it at once
+	if err := scene.StartDurableInvocations(DurableOptions{Owner: "instance", PollInterval: 5 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	defer scene.StopDurableInvocations()
+	waitSucceeded(t, scene, ID)
+	if calls.Load() != 1 {
+		t.Fatalf("resumed invocation is expected to be run once, but is run %d times", calls.Load())
+	}
+}
+
+// stoppingHistoryStore stops durable invocations of a scene once a change is recorded,
+// that is once the result of an invocation is written back.
+type stoppingHistoryStore struct {
+	scene *Scene
+}
+
+func (s *stoppingHistoryStore) Record(ctx context.Context, change node.AttributeChange) error {
+	s.scene.durable.cancel()
+	return nil
+}
+
+func (s *stoppingHistoryStore) List(ctx context.Context, nodeID string) ([]node.AttributeChange, error) {
+	return nil, nil
+}
+
+func TestDurableInvocationStopAfterSuccess(t *testing.T) {
+	scene := newTestScene(t)
+	compoID := newTestComponent(t, scene, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"result": 42}`))
+	})
+	nodeID, err := scene.RegisterNode("SumNode", map[string]any{"name": "Node", "result": 0.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scene.Tree.SetHistoryStore(&stoppingHistoryStore{scene: scene})
+
+	ID, _ := scene.EnqueueInvocation(nodeID, compoID, nil, nil)
+	if err := scene.StartDurableInvocations(DurableOptions{PollInterval: 5 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for scene.durable.ctx.Err() == nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	scene.StopDurableInvocations()
+
+	// the invocation finished before stopping is deleted rather than released to run again
+	if invocation, err := scene.GetInvocation(ID); err == nil {
+		t.Fatalf("invocation is expected to be deleted once succeeded, but is %+v", invocation)
+	}
+}
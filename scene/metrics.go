@@ -0,0 +1,50 @@
+package scene
+
+import (
+	"time"
+
+	componentinterface "github.com/world-in-progress/yggdrasil/component/interface"
+	"github.com/world-in-progress/yggdrasil/core/metrics"
+)
+
+// invocationMetrics records invocations of components through a scene. A nil value records nothing.
+type invocationMetrics struct {
+	scene    string
+	calls    *metrics.CounterVec
+	errors   *metrics.CounterVec
+	duration *metrics.HistogramVec
+}
+
+func newInvocationMetrics(r *metrics.Registry, scene string) *invocationMetrics {
+	return &invocationMetrics{
+		scene:    scene,
+		calls:    r.Counter("yggdrasil_component_invocations_total", "Component invocations.", "scene", "component", "name"),
+		errors:   r.Counter("yggdrasil_component_errors_total", "Component invocations failed.", "scene", "component", "name"),
+		duration: r.Histogram("yggdrasil_component_duration_seconds", "Time component invocations take.", nil, "scene", "component", "name"),
+	}
+}
+
+// observe records an invocation of a component started at a time.
+func (m *invocationMetrics) observe(compo componentinterface.IComponent, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+
+	labels := []string{m.scene, compo.GetID(), compo.GetName()}
+	m.calls.With(labels...).Inc()
+	m.duration.With(labels...).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.errors.With(labels...).Inc()
+	}
+}
+
+// unregister removes invocations of components through the scene from the registry.
+func (m *invocationMetrics) unregister() {
+	if m == nil {
+		return
+	}
+
+	m.calls.DeleteMatching("scene", m.scene)
+	m.errors.DeleteMatching("scene", m.scene)
+	m.duration.DeleteMatching("scene", m.scene)
+}
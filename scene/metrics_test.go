@@ -0,0 +1,52 @@
+package scene
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/world-in-progress/yggdrasil/core/metrics"
+	"github.com/world-in-progress/yggdrasil/db/memory"
+)
+
+func TestSceneMetrics(t *testing.T) {
+	r := metrics.NewRegistry()
+	scene, err := NewSceneWithRepository("Metered scene", memory.NewMemoryRepository(), 1, 4, 16, 16, WithMetricsRegistry(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sb strings.Builder
+	if err := r.WriteText(&sb); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`yggdrasil_cache_size{cache="Tree of Metered scene"} 0`,
+		`yggdrasil_cache_size{cache="Component Manager of Metered scene"} 0`,
+		`yggdrasil_workerpool_active_workers{pool="Dispatcher of Metered scene"}`,
+	} {
+		if !strings.Contains(sb.String(), line) {
+			t.Fatalf("metrics are expected to contain %s, but are\n%s", line, sb.String())
+		}
+	}
+
+	// Metrics of the scene are removed once it is shut down
+	scene.invocation.calls.With(scene.Name, "component", "name").Inc()
+	scene.Shutdown()
+	sb.Reset()
+	if err := r.WriteText(&sb); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sb.String(), "Metered scene") {
+		t.Fatalf("metrics of a shut down scene are not expected to be left, but are\n%s", sb.String())
+	}
+
+	// Without a registry, nothing is recorded
+	unmetered, err := NewSceneWithRepository("Unmetered scene", memory.NewMemoryRepository(), 1, 4, 16, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unmetered.Shutdown()
+	if unmetered.Metrics != nil || unmetered.invocation != nil {
+		t.Fatalf("a scene without a registry is not expected to record metrics")
+	}
+}
@@ -4,13 +4,21 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/world-in-progress/yggdrasil/auth"
 	"github.com/world-in-progress/yggdrasil/component"
 	componentinterface "github.com/world-in-progress/yggdrasil/component/interface"
+	"github.com/world-in-progress/yggdrasil/core/logger"
+	"github.com/world-in-progress/yggdrasil/core/metrics"
 	"github.com/world-in-progress/yggdrasil/core/threading"
+	"github.com/world-in-progress/yggdrasil/core/tracing"
 	"github.com/world-in-progress/yggdrasil/db/mongo"
 	"github.com/world-in-progress/yggdrasil/node"
+	nodeinterface "github.com/world-in-progress/yggdrasil/node/interface"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type (
@@ -39,9 +47,14 @@ type (
 	Scene struct {
 		Name       string
 		Dispatcher *threading.WorkerPool
-		Repo       *mongo.MongoRepository
+		Repo       nodeinterface.IRepository
 		Tree       *node.Tree
 		Compos     *component.ComponentManager
+		Authorizer auth.IAuthorizer // nil authorizer allows every access
+		Metrics    *metrics.Registry
+
+		invocation *invocationMetrics
+		durable    *durableQueue
 	}
 )
 
@@ -51,11 +64,48 @@ const (
 	Socket TaskType = "SOCKET"
 )
 
-func NewScene(name string, minWorkerNum, maxWorkerNum, bufferSize, cacheSize int) (*Scene, error) {
+// SceneOption configures a scene created by NewScene or NewSceneWithRepository.
+type SceneOption func(*sceneOptions)
+
+type sceneOptions struct {
+	pool    []threading.PoolOption
+	metrics *metrics.Registry
+}
+
+// WithPoolOptions configures the dispatcher of the scene, such as limits of priority classes.
+func WithPoolOptions(opts ...threading.PoolOption) SceneOption {
+	return func(o *sceneOptions) {
+		o.pool = append(o.pool, opts...)
+	}
+}
+
+// WithMetricsRegistry records metrics of the scene in a registry, such as metrics.DefaultRegistry.
+// Metrics are removed from it once the scene is shut down. A nil registry, the default, records nothing.
+func WithMetricsRegistry(r *metrics.Registry) SceneOption {
+	return func(o *sceneOptions) {
+		o.metrics = r
+	}
+}
+
+func NewScene(name string, minWorkerNum, maxWorkerNum, bufferSize, cacheSize int, opts ...SceneOption) (*Scene, error) {
+	repo, err := mongo.NewMongoRepository()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create repository for the scene %v: %v", name, err)
+	}
+	return NewSceneWithRepository(name, repo, minWorkerNum, maxWorkerNum, bufferSize, cacheSize, opts...)
+}
+
+// NewSceneWithRepository creates a scene whose tree, components and templates are recorded in the provided repository.
+func NewSceneWithRepository(name string, repo nodeinterface.IRepository, minWorkerNum, maxWorkerNum, bufferSize, cacheSize int, opts ...SceneOption) (*Scene, error) {
+	var options sceneOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	s := &Scene{
-		Name:       name,
-		Repo:       mongo.NewMongoRepository(),
-		Dispatcher: threading.NewWorkerPool(minWorkerNum, maxWorkerNum, bufferSize),
+		Name:    name,
+		Repo:    repo,
+		Metrics: options.metrics,
 	}
 
 	// Create information resource tree
@@ -71,11 +121,41 @@ func NewScene(name string, minWorkerNum, maxWorkerNum, bufferSize, cacheSize int
 		return nil, fmt.Errorf("failed to create component manager for the scene %v: %v", name, err)
 	}
 	s.Compos = cManager
+
+	if s.Metrics != nil {
+		options.pool = append([]threading.PoolOption{threading.WithMetrics(s.Metrics, "Dispatcher of "+name)}, options.pool...)
+		s.invocation = newInvocationMetrics(s.Metrics, name)
+		s.Tree.RegisterMetrics(s.Metrics)
+		s.Compos.RegisterMetrics(s.Metrics)
+	}
+	s.Dispatcher = threading.NewWorkerPool(minWorkerNum, maxWorkerNum, bufferSize, options.pool...)
 	return s, nil
 }
 
+// Shutdown stops durable invocations and the dispatcher of the scene, and removes metrics of the scene from its registry.
+func (s *Scene) Shutdown() {
+	s.StopDurableInvocations()
+	s.Dispatcher.Shutdown()
+
+	if s.Metrics != nil {
+		s.invocation.unregister()
+		s.Tree.UnregisterMetrics(s.Metrics)
+		s.Compos.UnregisterMetrics(s.Metrics)
+	}
+}
+
 func (s *Scene) RegisterNode(schemaName string, nodeInfo map[string]any) (string, error) {
-	if ID, err := s.Tree.RegisterNode(schemaName, nodeInfo); err != nil {
+	return s.RegisterNodeCtx(context.Background(), schemaName, nodeInfo)
+}
+
+// RegisterNodeCtx registers a node if the principal carried by ctx is admin of the subtree the node is registered to.
+func (s *Scene) RegisterNodeCtx(ctx context.Context, schemaName string, nodeInfo map[string]any) (string, error) {
+	parentID, _ := nodeInfo["parent"].(string)
+	if err := s.authorizeNew(ctx, auth.Admin, schemaName, parentID); err != nil {
+		return "", fmt.Errorf("scene %v cannot register node %v: %w", s.Name, nodeInfo, err)
+	}
+
+	if ID, err := s.Tree.RegisterNodeCtx(ctx, schemaName, nodeInfo); err != nil {
 		return "", fmt.Errorf("scene %v cannot register node %v: %v", s.Name, nodeInfo, err)
 	} else {
 		return ID, nil
@@ -83,15 +163,47 @@ func (s *Scene) RegisterNode(schemaName string, nodeInfo map[string]any) (string
 }
 
 func (s *Scene) GetNode(ID string) (*node.Node, error) {
-	if node, err := s.Tree.GetNode(ID); err != nil {
+	return s.GetNodeCtx(context.Background(), ID)
+}
+
+// GetNodeCtx gets a node if the principal carried by ctx can read all of its attributes.
+func (s *Scene) GetNodeCtx(ctx context.Context, ID string) (*node.Node, error) {
+	if err := s.authorize(ctx, auth.Read, ID, "", ""); err != nil {
+		return nil, fmt.Errorf("scene %v cannot get node %v: %w", s.Name, ID, err)
+	}
+
+	if node, err := s.Tree.GetNodeCtx(ctx, ID); err != nil {
 		return nil, fmt.Errorf("scene %v cannot get node %v: %v", s.Name, ID, err)
 	} else {
 		return node, nil
 	}
 }
 
+// ReadNodeCtx returns a copy of node attributes, redacting those the principal carried by ctx cannot read.
+func (s *Scene) ReadNodeCtx(ctx context.Context, ID string) (map[string]any, error) {
+	node, err := s.Tree.GetNodeCtx(ctx, ID)
+	if err != nil {
+		return nil, fmt.Errorf("scene %v cannot read node %v: %v", s.Name, ID, err)
+	}
+
+	attributes, err := s.redact(ctx, ID, node.Snapshot())
+	if err != nil {
+		return nil, fmt.Errorf("scene %v cannot read node %v: %w", s.Name, ID, err)
+	}
+	return attributes, nil
+}
+
 func (s *Scene) DeleteNode(ID string) error {
-	if err := s.Tree.DeleteNode(ID); err != nil {
+	return s.DeleteNodeCtx(context.Background(), ID)
+}
+
+// DeleteNodeCtx deletes a node if the principal carried by ctx is admin of it.
+func (s *Scene) DeleteNodeCtx(ctx context.Context, ID string) error {
+	if err := s.authorize(ctx, auth.Admin, ID, "", ""); err != nil {
+		return fmt.Errorf("scene %v cannot delete node %v: %w", s.Name, ID, err)
+	}
+
+	if err := s.Tree.DeleteNodeCtx(ctx, ID); err != nil {
 		return fmt.Errorf("scene %v cannot delete node %v: %v", s.Name, ID, err)
 	} else {
 		return nil
@@ -99,7 +211,16 @@ func (s *Scene) DeleteNode(ID string) error {
 }
 
 func (s *Scene) RegisterComponent(compoType component.ComponentType, compoSchema map[string]any) (string, error) {
-	if ID, err := s.Compos.RegisterComponent(compoType, compoSchema); err != nil {
+	return s.RegisterComponentCtx(context.Background(), compoType, compoSchema)
+}
+
+// RegisterComponentCtx registers a component if the principal carried by ctx is admin of the scene.
+func (s *Scene) RegisterComponentCtx(ctx context.Context, compoType component.ComponentType, compoSchema map[string]any) (string, error) {
+	if err := s.authorizeScene(ctx, auth.Admin, ""); err != nil {
+		return "", fmt.Errorf("scene %v cannot register component %v: %w", s.Name, compoSchema, err)
+	}
+
+	if ID, err := s.Compos.RegisterComponentCtx(ctx, compoType, compoSchema); err != nil {
 		return "", fmt.Errorf("scene %v cannot register component %v: %v", s.Name, compoSchema, err)
 	} else {
 		return ID, nil
@@ -107,7 +228,16 @@ func (s *Scene) RegisterComponent(compoType component.ComponentType, compoSchema
 }
 
 func (s *Scene) GetComponnet(ID string) (componentinterface.IComponent, error) {
-	if compo, err := s.Compos.GetComponent(ID); err != nil {
+	return s.GetComponentCtx(context.Background(), ID)
+}
+
+// GetComponentCtx gets a component if the principal carried by ctx can read components of the scene.
+func (s *Scene) GetComponentCtx(ctx context.Context, ID string) (componentinterface.IComponent, error) {
+	if err := s.authorizeScene(ctx, auth.Read, ID); err != nil {
+		return nil, fmt.Errorf("scene %v cannot get componnet %v: %w", s.Name, ID, err)
+	}
+
+	if compo, err := s.Compos.GetComponentCtx(ctx, ID); err != nil {
 		return nil, fmt.Errorf("scene %v cannot get componnet %v: %v", s.Name, ID, err)
 	} else {
 		return compo, nil
@@ -115,7 +245,16 @@ func (s *Scene) GetComponnet(ID string) (componentinterface.IComponent, error) {
 }
 
 func (s *Scene) DeleteComponent(ID string) error {
-	if err := s.Compos.DeleteComponent(ID); err != nil {
+	return s.DeleteComponentCtx(context.Background(), ID)
+}
+
+// DeleteComponentCtx deletes a component if the principal carried by ctx is admin of the scene.
+func (s *Scene) DeleteComponentCtx(ctx context.Context, ID string) error {
+	if err := s.authorizeScene(ctx, auth.Admin, ID); err != nil {
+		return fmt.Errorf("scene %v cannot delete componnet %v: %w", s.Name, ID, err)
+	}
+
+	if err := s.Compos.DeleteComponentCtx(ctx, ID); err != nil {
 		return fmt.Errorf("scene %v cannot delete componnet %v: %v", s.Name, ID, err)
 	} else {
 		return nil
@@ -123,8 +262,16 @@ func (s *Scene) DeleteComponent(ID string) error {
 }
 
 func (s *Scene) RegisterNodeTemplate(templateName string, schemaID string, compoIDs []string) (string, error) {
+	return s.RegisterNodeTemplateCtx(context.Background(), templateName, schemaID, compoIDs)
+}
+
+// RegisterNodeTemplateCtx registers a node template if the principal carried by ctx is admin of the scene.
+func (s *Scene) RegisterNodeTemplateCtx(ctx context.Context, templateName string, schemaID string, compoIDs []string) (string, error) {
+	if err := s.authorizeScene(ctx, auth.Admin, ""); err != nil {
+		return "", fmt.Errorf("scene %v cannot register node template %v: %w", s.Name, templateName, err)
+	}
+
 	// Check if template name has existed
-	ctx := context.Background()
 	record, err := s.Repo.ReadOne(ctx, "nodetemplate", map[string]any{"name": templateName})
 	if err != nil {
 		if record == nil {
@@ -135,13 +282,13 @@ func (s *Scene) RegisterNodeTemplate(templateName string, schemaID string, compo
 	}
 
 	// Check if schema exists
-	if !s.Tree.SchemaMgr.HasSchema(schemaID) {
+	if !s.Tree.SchemaMgr.HasSchemaCtx(ctx, schemaID) {
 		return "", fmt.Errorf("no schema has ID %s", schemaID)
 	}
 
 	// Check if all component exists
 	for _, compoID := range compoIDs {
-		if _, err := s.Compos.GetComponent(compoID); err != nil {
+		if _, err := s.Compos.GetComponentCtx(ctx, compoID); err != nil {
 			return "", fmt.Errorf("no component has ID %s", compoID)
 		}
 	}
@@ -170,8 +317,12 @@ func (s *Scene) RegisterNodeTemplate(templateName string, schemaID string, compo
 }
 
 func (s *Scene) GetNodeTemplate(templateID string) (*NodeTemplate, error) {
+	return s.GetNodeTemplateCtx(context.Background(), templateID)
+}
+
+// GetNodeTemplateCtx gets a node template from repository with context.
+func (s *Scene) GetNodeTemplateCtx(ctx context.Context, templateID string) (*NodeTemplate, error) {
 	// Load template
-	ctx := context.Background()
 	templateInfo, err := s.Repo.ReadOne(ctx, "nodetemplate", map[string]any{"_id": templateID})
 	if err != nil {
 		if templateInfo != nil {
@@ -190,14 +341,22 @@ func (s *Scene) GetNodeTemplate(templateID string) (*NodeTemplate, error) {
 }
 
 func (s *Scene) DeleteNodeTemplate(templateID string) error {
+	return s.DeleteNodeTemplateCtx(context.Background(), templateID)
+}
+
+// DeleteNodeTemplateCtx deletes a node template if the principal carried by ctx is admin of the scene.
+func (s *Scene) DeleteNodeTemplateCtx(ctx context.Context, templateID string) error {
+	if err := s.authorizeScene(ctx, auth.Admin, ""); err != nil {
+		return fmt.Errorf("scene %v cannot delete node template %v: %w", s.Name, templateID, err)
+	}
+
 	// Get template
-	_, err := s.GetNodeTemplate(templateID)
+	_, err := s.GetNodeTemplateCtx(ctx, templateID)
 	if err != nil {
 		return err
 	}
 
 	// Delete template from repository
-	ctx := context.Background()
 	err = s.Repo.Delete(ctx, "nodetemplate", map[string]any{"_id": templateID})
 	if err != nil {
 		return fmt.Errorf("failed to delete node template (ID: %s) from template: %v", templateID, err)
@@ -206,60 +365,117 @@ func (s *Scene) DeleteNodeTemplate(templateID string) error {
 }
 
 func (s *Scene) RegisterNodeFromTemplate(templateID string, nodeInfo map[string]any) (string, error) {
-	// Load template
-	template, err := s.GetNodeTemplate(templateID)
+	return s.RegisterNodeFromTemplateCtx(context.Background(), templateID, nodeInfo)
+}
+
+// RegisterNodeFromTemplateCtx registers a node from a template with context.
+// The node is registered in a unit of work, so that no node is left behind if a step fails, see TransactionCtx.
+func (s *Scene) RegisterNodeFromTemplateCtx(ctx context.Context, templateID string, nodeInfo map[string]any) (string, error) {
+	var nodeID string
+	err := s.TransactionCtx(ctx, func(uow *UnitOfWork) error {
+		var err error
+		nodeID, err = uow.RegisterNodeFromTemplate(templateID, nodeInfo)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
+	return nodeID, nil
+}
 
-	// Create node
-	nodeID, err := s.RegisterNode(template.Schema, nodeInfo)
-	if err != nil {
-		return "", fmt.Errorf("failed to register node (Info: %v) from template (ID: %s): %v", nodeInfo, templateID, err)
+func (s *Scene) UpdateNodeAttribute(ID string, attributeName string, updateData any) error {
+	return s.UpdateNodeAttributeCtx(context.Background(), ID, attributeName, updateData)
+}
+
+// UpdateNodeAttributeCtx updates a node attribute if the principal carried by ctx can write it.
+func (s *Scene) UpdateNodeAttributeCtx(ctx context.Context, ID string, attributeName string, updateData any) error {
+	if err := s.authorize(ctx, auth.Write, ID, attributeName, ""); err != nil {
+		return fmt.Errorf("scene %v cannot update attribute about %v of node %v: %w", s.Name, attributeName, ID, err)
+	}
+
+	if err := s.Tree.UpdateNodeAttributeCtx(userSource(ctx), ID, attributeName, updateData); err != nil {
+		return fmt.Errorf("scene %v cannot update attribute about %v of node %v: %v", s.Name, attributeName, ID, err)
+	} else {
+		return nil
 	}
+}
 
-	// Update node attribute about template
-	err = s.Tree.UpdateNodeAttribute(nodeID, "template", templateID)
+func (s *Scene) GetNodeHistory(ID string) ([]node.AttributeChange, error) {
+	return s.GetNodeHistoryCtx(context.Background(), ID)
+}
+
+// GetNodeHistoryCtx lists attribute changes of a node if the principal carried by ctx can read the node.
+func (s *Scene) GetNodeHistoryCtx(ctx context.Context, ID string) ([]node.AttributeChange, error) {
+	if err := s.authorize(ctx, auth.Read, ID, "", ""); err != nil {
+		return nil, fmt.Errorf("scene %v cannot get history of node %v: %w", s.Name, ID, err)
+	}
+
+	if changes, err := s.Tree.GetNodeHistoryCtx(ctx, ID); err != nil {
+		return nil, fmt.Errorf("scene %v cannot get history of node %v: %v", s.Name, ID, err)
+	} else {
+		return changes, nil
+	}
+}
+
+func (s *Scene) GetNodeAsOf(ID string, at time.Time) (map[string]any, error) {
+	return s.GetNodeAsOfCtx(context.Background(), ID, at)
+}
+
+// GetNodeAsOfCtx returns node attributes at a point in time, redacted to those the principal carried by ctx can read.
+func (s *Scene) GetNodeAsOfCtx(ctx context.Context, ID string, at time.Time) (map[string]any, error) {
+	attributes, err := s.Tree.GetNodeAsOfCtx(ctx, ID, at)
 	if err != nil {
-		return "", fmt.Errorf("failed to update node (ID: %s) attribute about template (ID: %s): %v", nodeID, templateID, err)
+		return nil, fmt.Errorf("scene %v cannot get node %v as of %v: %v", s.Name, ID, at, err)
 	}
 
-	// Bind all components to node
-	for _, compoID := range template.Components {
-		err = s.Tree.BindComponentToNode(nodeID, compoID)
-		if err != nil {
-			return "", fmt.Errorf("failed to bind component (ID: %s) to node (ID: %s): %v", compoID, nodeID, err)
-		}
+	if attributes, err = s.redact(ctx, ID, attributes); err != nil {
+		return nil, fmt.Errorf("scene %v cannot get node %v as of %v: %w", s.Name, ID, at, err)
 	}
+	return attributes, nil
+}
 
-	return nodeID, nil
+func (s *Scene) RevertNodeAttribute(ID string, attributeName string, at time.Time) error {
+	return s.RevertNodeAttributeCtx(context.Background(), ID, attributeName, at)
 }
 
-func (s *Scene) UpdateNodeAttribute(ID string, attributeName string, updateData any) error {
-	if err := s.Tree.UpdateNodeAttribute(ID, attributeName, updateData); err != nil {
-		return fmt.Errorf("scene %v cannot update attribute about %v of node %v: %v", s.Name, attributeName, ID, err)
-	} else {
-		return nil
+// RevertNodeAttributeCtx reverts a node attribute to its value at a point in time if the principal carried by ctx can write it.
+func (s *Scene) RevertNodeAttributeCtx(ctx context.Context, ID string, attributeName string, at time.Time) error {
+	if err := s.authorize(ctx, auth.Write, ID, attributeName, ""); err != nil {
+		return fmt.Errorf("scene %v cannot revert attribute about %v of node %v: %w", s.Name, attributeName, ID, err)
+	}
+
+	if err := s.Tree.RevertNodeAttributeCtx(userSource(ctx), ID, attributeName, at); err != nil {
+		return fmt.Errorf("scene %v cannot revert attribute about %v of node %v: %v", s.Name, attributeName, ID, err)
 	}
+	return nil
 }
 
 func (s *Scene) BindComponentToNode(nodeID, compoID string) error {
+	return s.BindComponentToNodeCtx(context.Background(), nodeID, compoID)
+}
+
+// BindComponentToNodeCtx binds a component to a node if the principal carried by ctx is admin of the node.
+func (s *Scene) BindComponentToNodeCtx(ctx context.Context, nodeID, compoID string) error {
 	var err error
 
+	if err = s.authorize(ctx, auth.Admin, nodeID, "", compoID); err != nil {
+		return fmt.Errorf("failed to bind component %v to node %v: %w", compoID, nodeID, err)
+	}
+
 	// Get node
-	_, err = s.Tree.GetNode(nodeID)
+	_, err = s.Tree.GetNodeCtx(ctx, nodeID)
 	if err != nil {
 		return fmt.Errorf("failed to get node by ID %v: %v", nodeID, err)
 	}
 
 	// Get component
-	_, err = s.Compos.GetComponent(compoID)
+	_, err = s.Compos.GetComponentCtx(ctx, compoID)
 	if err != nil {
 		return fmt.Errorf("failed to get componnet by ID %v: %v", compoID, err)
 	}
 
 	// Bind component to node
-	err = s.Tree.BindComponentToNode(nodeID, compoID)
+	err = s.Tree.BindComponentToNodeCtx(ctx, nodeID, compoID)
 	if err != nil {
 		return fmt.Errorf("failed to bind component %v to node %v: %v", compoID, nodeID, err)
 	}
@@ -267,54 +483,120 @@ func (s *Scene) BindComponentToNode(nodeID, compoID string) error {
 }
 
 func (s *Scene) DeleteComponentFromNode(nodeID, compoID string) error {
+	return s.DeleteComponentFromNodeCtx(context.Background(), nodeID, compoID)
+}
+
+// DeleteComponentFromNodeCtx deletes a component from a node if the principal carried by ctx is admin of the node.
+func (s *Scene) DeleteComponentFromNodeCtx(ctx context.Context, nodeID, compoID string) error {
 	var err error
 
+	if err = s.authorize(ctx, auth.Admin, nodeID, "", compoID); err != nil {
+		return fmt.Errorf("failed to delete component %v from node %v: %w", compoID, nodeID, err)
+	}
+
 	// Get node
-	_, err = s.Tree.GetNode(nodeID)
+	_, err = s.Tree.GetNodeCtx(ctx, nodeID)
 	if err != nil {
 		return fmt.Errorf("failed to get node by ID %v: %v", nodeID, err)
 	}
 
 	// Get component
-	_, err = s.Compos.GetComponent(compoID)
+	_, err = s.Compos.GetComponentCtx(ctx, compoID)
 	if err != nil {
 		return fmt.Errorf("failed to get component by ID %v: %v", compoID, err)
 	}
 
 	// Delete component from node
-	err = s.Tree.DeleteComponentFromNode(nodeID, compoID)
+	err = s.Tree.DeleteComponentFromNodeCtx(ctx, nodeID, compoID)
 	if err != nil {
 		return fmt.Errorf("failed to delete component %v from node %v: %v", compoID, nodeID, err)
 	}
 	return nil
 }
 
-func (s *Scene) InvokeNodeComponent(taskType string, nodeID, compoID string, params map[string]any, headers map[string]string) (ITask, error) {
-	var err error
+// InvokeOption configures a component invocation.
+type InvokeOption func(*invokeOptions)
+
+type invokeOptions struct {
+	priority threading.Priority
+	timeout  time.Duration
+}
+
+// WithPriority sets the priority the invocation task is scheduled with by the dispatcher.
+// Invocations are of threading.PriorityNormal by default.
+func WithPriority(priority threading.Priority) InvokeOption {
+	return func(o *invokeOptions) {
+		o.priority = priority
+	}
+}
+
+// WithTimeout bounds the processing time of the invocation task. A task exceeding it has its component call
+// canceled and fails with threading.ErrTaskTimeout. The timeout of the dispatcher applies by default.
+func WithTimeout(timeout time.Duration) InvokeOption {
+	return func(o *invokeOptions) {
+		o.timeout = timeout
+	}
+}
+
+func (s *Scene) InvokeNodeComponent(taskType string, nodeID, compoID string, params map[string]any, headers map[string]string, opts ...InvokeOption) (ITask, error) {
+	return s.InvokeNodeComponentCtx(context.Background(), taskType, nodeID, compoID, params, headers, opts...)
+}
+
+// InvokeNodeComponentCtx invokes a component of a node if the principal carried by ctx can invoke it.
+// Permission is checked before the task is submitted to the dispatcher.
+// The invocation is traced by spans linked by the task ID, see tracing.TaskIDKey.
+func (s *Scene) InvokeNodeComponentCtx(ctx context.Context, taskType string, nodeID, compoID string, params map[string]any, headers map[string]string, opts ...InvokeOption) (task ITask, err error) {
+	taskID := uuid.New().String()
+	ctx = logger.ContextWithFields(ctx, logger.Fields{
+		logger.SceneField:     s.Name,
+		logger.NodeField:      nodeID,
+		logger.ComponentField: compoID,
+		logger.TaskField:      taskID,
+	})
+	ctx, span := tracing.Start(tracing.WithTaskID(ctx, taskID), "scene.invoke", trace.WithAttributes(
+		attribute.String("yggdrasil.node.id", nodeID),
+		attribute.String("yggdrasil.component.id", compoID),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	options := invokeOptions{priority: threading.PriorityNormal}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if err = s.authorize(ctx, auth.Invoke, nodeID, "", compoID); err != nil {
+		return nil, fmt.Errorf("failed to invoke component %v of node %v: %w", compoID, nodeID, err)
+	}
 
 	if params == nil {
 		params = map[string]any{}
 	}
 
 	// Get node
-	node, err := s.Tree.GetNode(nodeID)
+	node, err := s.Tree.GetNodeCtx(ctx, nodeID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get node by ID %v: %v", nodeID, err)
 	}
 
 	// Get component
-	compo, err := s.Compos.GetComponent(compoID)
+	compo, err := s.Compos.GetComponentCtx(ctx, compoID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get component by ID %v: %v", compoID, err)
 	}
 
 	// Build task
-	var task ITask
-	taskID := uuid.New().String()
 	switch taskType {
 	case string(Sync):
-		task = NewSyncTask(taskID, s.Tree, node, compo, params, headers)
-		if _, err := s.Dispatcher.Submit(task); err != nil {
+		syncTask := NewSyncTaskCtx(ctx, taskID, s.Tree, node, compo, params, headers)
+		syncTask.Priority = options.priority
+		syncTask.Timeout = options.timeout
+		syncTask.metrics = s.invocation
+		_, syncTask.queueSpan = tracing.Start(ctx, "dispatcher.queue", trace.WithAttributes(
+			attribute.String("yggdrasil.task.priority", options.priority.String()),
+		))
+		task = syncTask
+		if _, err = s.Dispatcher.SubmitCtx(ctx, task); err != nil {
+			tracing.End(syncTask.queueSpan, err)
 			return nil, fmt.Errorf("failed to submit sync task: %v", err)
 		}
 
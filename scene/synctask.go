@@ -1,16 +1,24 @@
 package scene
 
 import (
+	"context"
 	"fmt"
+	"time"
 
+	"github.com/world-in-progress/yggdrasil/auth"
 	componentinterface "github.com/world-in-progress/yggdrasil/component/interface"
+	"github.com/world-in-progress/yggdrasil/core/rescue"
 	"github.com/world-in-progress/yggdrasil/core/threading"
+	"github.com/world-in-progress/yggdrasil/core/tracing"
 	"github.com/world-in-progress/yggdrasil/node"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // SyncTask is the structure for a synchronously call a specific node and its component
 type SyncTask struct {
 	threading.BaseTask
+	ctx     context.Context
 	Result  chan any
 	ERR     chan error
 	headers map[string]string
@@ -18,14 +26,31 @@ type SyncTask struct {
 	tree    *node.Tree
 	node    *node.Node
 	compo   componentinterface.IComponent
+	metrics *invocationMetrics
+
+	// version is the version of the node the component is called with, compared when writing the result back
+	version uint64
+
+	// queueSpan traces the time the task waits in the dispatcher, ended once the task is processed
+	queueSpan trace.Span
 }
 
 func NewSyncTask(taskID string, tree *node.Tree, node *node.Node, compo componentinterface.IComponent, params map[string]any, headers map[string]string) *SyncTask {
+	return NewSyncTaskCtx(context.Background(), taskID, tree, node, compo, params, headers)
+}
+
+// NewSyncTaskCtx creates a sync task whose component call and attribute write-back are bound to ctx.
+// Spans of the task are attributed with the task ID.
+func NewSyncTaskCtx(ctx context.Context, taskID string, tree *node.Tree, node *node.Node, compo componentinterface.IComponent, params map[string]any, headers map[string]string) *SyncTask {
+	if tracing.TaskIDFromContext(ctx) != taskID {
+		ctx = tracing.WithTaskID(ctx, taskID)
+	}
 
 	task := &SyncTask{
 		BaseTask: threading.BaseTask{
 			ID: taskID,
 		},
+		ctx:     ctx,
 		Result:  make(chan any, 1),
 		ERR:     make(chan error, 1),
 		tree:    tree,
@@ -39,22 +64,112 @@ func NewSyncTask(taskID string, tree *node.Tree, node *node.Node, compo componen
 }
 
 func (st *SyncTask) Process() {
-	result, err := st.compo.Execute(st.node, st.params, nil, st.headers)
+	st.ProcessCtx(st.ctx)
+}
+
+// Context returns the context the task is bound to.
+func (st *SyncTask) Context() context.Context {
+	return st.ctx
+}
+
+// ProcessCtx calls the component bound to ctx, which is done once the deadline of the task is exceeded.
+func (st *SyncTask) ProcessCtx(ctx context.Context) {
+	if st.queueSpan != nil {
+		st.queueSpan.End()
+	}
+
+	// Surface a panic of the component on ERR, so that Syncing is not blocked forever
+	var panicErr error
+	defer func() {
+		if panicErr != nil {
+			st.Finish(fmt.Errorf("task of component %v of node %v panicked: %w",
+				st.compo.GetName(), st.node.GetName(), panicErr))
+		}
+	}()
+	defer rescue.RecoverToError(ctx, &panicErr)
+
+	if err := ctx.Err(); err != nil {
+		st.Finish(fmt.Errorf("task of component %v of node %v is abandoned: %w",
+			st.compo.GetName(), st.node.GetName(), err))
+		return
+	}
+
+	st.version = st.node.Version()
+	start := time.Now()
+	result, err := st.compo.ExecuteCtx(ctx, st.node, st.params, nil, st.headers)
+	st.metrics.observe(st.compo, start, err)
 	if err != nil {
-		st.ERR <- fmt.Errorf("error executing component %v of node %v: %v",
-			st.compo.GetName(), st.node.GetName(), err)
+		st.Finish(fmt.Errorf("error executing component %v of node %v: %w",
+			st.compo.GetName(), st.node.GetName(), err))
 		return
 	}
-	st.Result <- result
+	if st.BaseTask.Finish(nil) {
+		st.Result <- result
+	}
+}
+
+// Finish completes the task with err once, delivering it to Syncing.
+func (st *SyncTask) Finish(err error) bool {
+	if !st.BaseTask.Finish(err) {
+		return false
+	}
+	if err != nil {
+		st.ERR <- err
+	}
+	return true
+}
+
+// Cancel cancels the task if it has not been done, delivering the cancellation to Syncing.
+func (st *SyncTask) Cancel() bool {
+	if !st.BaseTask.Cancel() {
+		return false
+	}
+	st.ERR <- fmt.Errorf("task of component %v of node %v is canceled: %w",
+		st.compo.GetName(), st.node.GetName(), threading.ErrTaskCanceled)
+	return true
 }
 
 func (st *SyncTask) Syncing() (any, error) {
+	return st.SyncingCtx(context.Background())
+}
+
+// SyncingCtx waits for the result of the task until ctx is done, and writes it back to the node.
+// The task keeps running if ctx is done first.
+// Attributes of the result are written back at once. A node.VersionConflictError is returned if the node has been
+// updated since the component was called, as writing the result back would lose the update.
+func (st *SyncTask) SyncingCtx(ctx context.Context) (any, error) {
 	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	case result := <-st.Result:
 		// update node attribute if the attribute name is provided in the result
 		r := result.(map[string]any)
-		for attribute, value := range r {
-			st.tree.UpdateNodeAttribute(st.node.GetID(), attribute, value)
+		ctx, span := tracing.Start(st.ctx, "synctask.syncing", trace.WithAttributes(
+			attribute.String("yggdrasil.node.id", st.node.GetID()),
+		))
+		defer span.End()
+
+		ctx = node.WithChangeSource(ctx, node.ChangeSource{
+			Type:        node.ComponentSource,
+			PrincipalID: auth.PrincipalFromContext(st.ctx).ID,
+			ComponentID: st.compo.GetID(),
+			TaskID:      st.GetID(),
+		})
+		// Attributes the node does not have are not written back
+		attributes := st.node.Snapshot()
+		updates := make(map[string]any, len(r))
+		for name, value := range r {
+			if _, ok := attributes[name]; ok {
+				updates[name] = value
+			}
+		}
+		if len(updates) == 0 {
+			return result, nil
+		}
+		if _, err := st.tree.CompareAndUpdateNodeAttributesCtx(ctx, st.node.GetID(), updates, st.version); err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("result of component %v of node %v is not written back: %w",
+				st.compo.GetName(), st.node.GetName(), err)
 		}
 		return result, nil
 	case err := <-st.ERR:
@@ -0,0 +1,167 @@
+package scene
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	componentinterface "github.com/world-in-progress/yggdrasil/component/interface"
+	"github.com/world-in-progress/yggdrasil/core/rescue"
+	"github.com/world-in-progress/yggdrasil/core/threading"
+	"github.com/world-in-progress/yggdrasil/node"
+)
+
+// panickingComponent is a component whose execution panics.
+type panickingComponent struct{}
+
+func (panickingComponent) GetID() string          { return "RESTFUL-panic" }
+func (panickingComponent) GetName() string        { return "Panicking API" }
+func (panickingComponent) GetCallTime() time.Time { return time.Time{} }
+func (c panickingComponent) Execute(node componentinterface.INode, params map[string]any, client *http.Client, headers map[string]string) (map[string]any, error) {
+	return c.ExecuteCtx(context.Background(), node, params, client, headers)
+}
+func (panickingComponent) ExecuteCtx(context.Context, componentinterface.INode, map[string]any, *http.Client, map[string]string) (map[string]any, error) {
+	panic("component is broken")
+}
+
+// gatedComponent is a component returning result once gate is closed.
+type gatedComponent struct {
+	gate   chan struct{}
+	result map[string]any
+}
+
+func (gatedComponent) GetID() string          { return "RESTFUL-gated" }
+func (gatedComponent) GetName() string        { return "Gated API" }
+func (gatedComponent) GetCallTime() time.Time { return time.Time{} }
+func (c gatedComponent) Execute(node componentinterface.INode, params map[string]any, client *http.Client, headers map[string]string) (map[string]any, error) {
+	return c.ExecuteCtx(context.Background(), node, params, client, headers)
+}
+func (c gatedComponent) ExecuteCtx(context.Context, componentinterface.INode, map[string]any, *http.Client, map[string]string) (map[string]any, error) {
+	<-c.gate
+	return c.result, nil
+}
+
+func TestSyncTaskPanic(t *testing.T) {
+	scene := newTestScene(t)
+	nodeID, err := scene.RegisterNode("BaseNode", map[string]any{"name": "Node"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := scene.Tree.GetNode(nodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var recovered *rescue.PanicInfo
+	remove := rescue.AddHandler(func(ctx context.Context, info *rescue.PanicInfo) { recovered = info })
+	defer remove()
+
+	task := NewSyncTask("task", scene.Tree, node, panickingComponent{}, nil, nil)
+	if _, err := scene.Dispatcher.Submit(task); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := task.Syncing()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		var panicErr *rescue.PanicError
+		if !errors.As(err, &panicErr) {
+			t.Fatalf("syncing is expected to fail with a panic error, but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("syncing is expected not to block when the component panics")
+	}
+	if recovered == nil || recovered.Value != "component is broken" {
+		t.Fatalf("panic is expected to be passed to handlers, but got %+v", recovered)
+	}
+
+}
+
+func TestInvocationTimeout(t *testing.T) {
+	scene := newTestScene(t)
+
+	requestDone := make(chan error, 1)
+	compoID := newTestComponent(t, scene, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		requestDone <- r.Context().Err()
+	})
+	nodeID, err := scene.RegisterNode("SumNode", map[string]any{"name": "Node", "result": 0.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := scene.InvokeNodeComponent(string(Sync), nodeID, compoID, nil, nil, WithTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncTask := task.(*SyncTask)
+
+	// waiting can be bounded on its own, without affecting the task
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := syncTask.SyncingCtx(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("syncing is expected to give up once its context is done, but got %v", err)
+	}
+
+	if _, err := syncTask.Syncing(); !errors.Is(err, threading.ErrTaskTimeout) {
+		t.Fatalf("syncing is expected to fail with a timeout error, but got %v", err)
+	}
+	select {
+	case <-requestDone:
+	case <-time.After(time.Second):
+		t.Fatal("http request of a timed out task is expected to be canceled")
+	}
+	if err := syncTask.Wait(time.Second); !errors.Is(err, threading.ErrTaskTimeout) {
+		t.Fatalf("timed out task is expected to be done with a timeout error, but got %v", err)
+	}
+}
+
+func TestSyncTaskVersionConflict(t *testing.T) {
+	scene := newTestScene(t)
+	nodeID, err := scene.RegisterNode("SumNode", map[string]any{"name": "Node", "result": 0.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := scene.Tree.GetNode(nodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The node is updated while the component is called
+	compo := gatedComponent{gate: make(chan struct{}), result: map[string]any{"result": 1.0}}
+	task := NewSyncTask("task", scene.Tree, n, compo, nil, nil)
+	if _, err := scene.Dispatcher.Submit(task); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := scene.Tree.UpdateNodeAttribute(nodeID, "result", 2.0); err != nil {
+		t.Fatal(err)
+	}
+	close(compo.gate)
+
+	var conflict *node.VersionConflictError
+	if _, err := task.Syncing(); !errors.As(err, &conflict) {
+		t.Fatalf("syncing is expected to fail with a version conflict, but got %v", err)
+	}
+	if result := n.GetParam("result"); result != 2.0 {
+		t.Fatalf("update made during the call is expected to be kept, but result is %v", result)
+	}
+
+	// The result is written back if the node is not updated meanwhile
+	task = NewSyncTask("task", scene.Tree, n, compo, nil, nil)
+	if _, err := scene.Dispatcher.Submit(task); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := task.Syncing(); err != nil {
+		t.Fatal(err)
+	}
+	if result := n.GetParam("result"); result != 1.0 {
+		t.Fatalf("result is expected to be written back, but is %v", result)
+	}
+}
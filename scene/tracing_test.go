@@ -0,0 +1,103 @@
+package scene
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/world-in-progress/yggdrasil/component"
+	"github.com/world-in-progress/yggdrasil/core/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// newTestComponent registers a RESTful component calling a GET handler.
+func newTestComponent(t *testing.T, scene *Scene, handler http.HandlerFunc) string {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	compoID, err := scene.RegisterComponent(component.Restful, map[string]any{
+		"method": "GET",
+		"name":   "Test API",
+		"api":    server.URL,
+		"resStatuses": []any{
+			map[string]any{"code": 200, "schema": "application/json"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return compoID
+}
+
+// newTestExporter records spans of the global tracer provider in memory during a test.
+func newTestExporter(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	oldProvider, oldPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+		otel.SetTracerProvider(oldProvider)
+		otel.SetTextMapPropagator(oldPropagator)
+	})
+	return exporter
+}
+
+func TestInvocationTracing(t *testing.T) {
+	exporter := newTestExporter(t)
+	scene := newTestScene(t)
+
+	var traceparent string
+	compoID := newTestComponent(t, scene, func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Write([]byte(`{"result": 42}`))
+	})
+	nodeID, err := scene.RegisterNode("SumNode", map[string]any{"name": "Node", "result": 0.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := scene.InvokeNodeComponent(string(Sync), nodeID, compoID, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := task.(*SyncTask).Syncing(); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	for _, name := range []string{"scene.invoke", "dispatcher.queue", "HTTP GET", "synctask.syncing"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Fatalf("span %s is expected to be recorded, but spans are %v", name, spans)
+		}
+		if span.SpanContext.TraceID() != spans["scene.invoke"].SpanContext.TraceID() {
+			t.Fatalf("span %s is expected to belong to the trace of the invocation", name)
+		}
+
+		var taskID string
+		for _, attr := range span.Attributes {
+			if attr.Key == tracing.TaskIDKey {
+				taskID = attr.Value.AsString()
+			}
+		}
+		if taskID != task.GetID() {
+			t.Fatalf("span %s is expected to be attributed with task ID %s, but is with %q", name, task.GetID(), taskID)
+		}
+	}
+
+	httpSpan := spans["HTTP GET"].SpanContext
+	if !strings.Contains(traceparent, httpSpan.TraceID().String()+"-"+httpSpan.SpanID().String()) {
+		t.Fatalf("trace context of the HTTP span is expected to be injected in request headers, but traceparent is %q", traceparent)
+	}
+}
@@ -0,0 +1,345 @@
+package scene
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/world-in-progress/yggdrasil/auth"
+	"github.com/world-in-progress/yggdrasil/component"
+	"github.com/world-in-progress/yggdrasil/core/logger"
+	"github.com/world-in-progress/yggdrasil/node"
+	nodeinterface "github.com/world-in-progress/yggdrasil/node/interface"
+)
+
+type (
+	// ITransactionalRepository is the interface for a repository running operations in transactions.
+	// Operations run with the context given to fn are committed together if fn succeeds, and aborted otherwise.
+	ITransactionalRepository interface {
+		nodeinterface.IRepository
+		WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+	}
+
+	// UnitOfWork groups operations of a scene, which are rolled back together if one of them fails,
+	// see Scene.TransactionCtx. A unit of work must not be used out of the function it is given to.
+	UnitOfWork struct {
+		scene         *Scene
+		ctx           context.Context // context operations run with, carrying the transaction if any
+		outer         context.Context // context of the unit of work, out of the transaction
+		transactional bool
+		nodes         map[string]struct{}               // nodes rolled back as a whole
+		undo          []func(ctx context.Context) error // actions rolling back operations, in order of operations
+	}
+)
+
+func (s *Scene) Transaction(fn func(uow *UnitOfWork) error) error {
+	return s.TransactionCtx(context.Background(), fn)
+}
+
+// TransactionCtx runs fn with a unit of work, whose operations are rolled back if fn fails.
+// If the repository of the scene implements ITransactionalRepository, operations are written in one transaction,
+// and nodes and components they change are dropped from the runtime caches on rollback, to be loaded again
+// from their records. Changes made to these nodes by others meanwhile are lost as well.
+// Otherwise, operations are undone by compensating actions in reverse order, such as deleting a registered node.
+func (s *Scene) TransactionCtx(ctx context.Context, fn func(uow *UnitOfWork) error) error {
+	uow := &UnitOfWork{
+		scene: s,
+		ctx:   ctx,
+		outer: ctx,
+		nodes: make(map[string]struct{}),
+	}
+
+	repo, ok := s.Repo.(ITransactionalRepository)
+	if !ok {
+		if err := fn(uow); err != nil {
+			return uow.rollback(err)
+		}
+		return nil
+	}
+
+	// Evicted nodes are written back out of the transaction, not to lose them if it is aborted
+	uow.transactional = true
+	release := s.Tree.HoldEviction()
+	defer func() {
+		if err := release(ctx); err != nil {
+			logger.FromContext(ctx).WithError(err).Warn("Failed to shrink the cache of scene %s after a transaction", s.Name)
+		}
+	}()
+
+	if err := repo.WithTransaction(ctx, func(txCtx context.Context) error {
+		uow.ctx = txCtx
+		return fn(uow)
+	}); err != nil {
+		return uow.rollback(err)
+	}
+	return nil
+}
+
+// RegisterNode registers a node, which is deleted on rollback, see Scene.RegisterNodeCtx.
+func (u *UnitOfWork) RegisterNode(schemaName string, nodeInfo map[string]any) (string, error) {
+	parentID, _ := nodeInfo["parent"].(string)
+	if _, err := u.hold(parentID); err != nil {
+		return "", err
+	}
+
+	ID, err := u.scene.RegisterNodeCtx(u.ctx, schemaName, nodeInfo)
+	if err != nil {
+		return "", err
+	}
+
+	u.nodes[ID] = struct{}{}
+	if u.transactional {
+		u.undo = append(u.undo, u.discardNode(ID))
+	} else {
+		u.undo = append(u.undo, func(ctx context.Context) error {
+			return u.scene.Tree.DeleteNodeCtx(ctx, ID)
+		})
+	}
+	return ID, nil
+}
+
+// UpdateNodeAttribute updates a node attribute, which is updated back on rollback, see Scene.UpdateNodeAttributeCtx.
+func (u *UnitOfWork) UpdateNodeAttribute(ID string, attributeName string, updateData any) error {
+	return u.updateNodeAttribute(ID, attributeName, func(ctx context.Context) error {
+		return u.scene.UpdateNodeAttributeCtx(ctx, ID, attributeName, updateData)
+	})
+}
+
+// BindComponentToNode binds a component to a node, which is unbound on rollback, see Scene.BindComponentToNodeCtx.
+func (u *UnitOfWork) BindComponentToNode(nodeID, compoID string) error {
+	return u.bindComponent(nodeID, compoID, true, func(ctx context.Context) error {
+		return u.scene.BindComponentToNodeCtx(ctx, nodeID, compoID)
+	})
+}
+
+// DeleteComponentFromNode deletes a component from a node, which is bound again on rollback,
+// see Scene.DeleteComponentFromNodeCtx.
+func (u *UnitOfWork) DeleteComponentFromNode(nodeID, compoID string) error {
+	return u.bindComponent(nodeID, compoID, false, func(ctx context.Context) error {
+		return u.scene.DeleteComponentFromNodeCtx(ctx, nodeID, compoID)
+	})
+}
+
+// RegisterComponent registers a component, which is deleted on rollback, see Scene.RegisterComponentCtx.
+func (u *UnitOfWork) RegisterComponent(compoType component.ComponentType, compoSchema map[string]any) (string, error) {
+	ID, err := u.scene.RegisterComponentCtx(u.ctx, compoType, compoSchema)
+	if err != nil {
+		return "", err
+	}
+
+	if u.transactional {
+		u.undo = append(u.undo, func(context.Context) error {
+			u.scene.Compos.DiscardComponent(ID)
+			return nil
+		})
+	} else {
+		u.undo = append(u.undo, func(ctx context.Context) error {
+			return u.scene.Compos.DeleteComponentCtx(ctx, ID)
+		})
+	}
+	return ID, nil
+}
+
+// RegisterNodeTemplate registers a node template, which is deleted on rollback unless it exists before,
+// see Scene.RegisterNodeTemplateCtx.
+func (u *UnitOfWork) RegisterNodeTemplate(templateName string, schemaID string, compoIDs []string) (string, error) {
+	_, err := u.scene.Repo.ReadOne(u.ctx, "nodetemplate", map[string]any{"name": templateName})
+	existed := err == nil
+
+	templateID, err := u.scene.RegisterNodeTemplateCtx(u.ctx, templateName, schemaID, compoIDs)
+	if err != nil {
+		return "", err
+	}
+
+	if !u.transactional && !existed {
+		u.undo = append(u.undo, func(ctx context.Context) error {
+			return u.scene.Repo.Delete(ctx, "nodetemplate", map[string]any{"_id": templateID})
+		})
+	}
+	return templateID, nil
+}
+
+// DeleteNodeTemplate deletes a node template, which is recorded again on rollback, see Scene.DeleteNodeTemplateCtx.
+func (u *UnitOfWork) DeleteNodeTemplate(templateID string) error {
+	var record map[string]any
+	if !u.transactional {
+		var err error
+		if record, err = u.scene.Repo.ReadOne(u.ctx, "nodetemplate", map[string]any{"_id": templateID}); err != nil {
+			return fmt.Errorf("failed to find template hasing ID %s in repository: %v", templateID, err)
+		}
+	}
+
+	if err := u.scene.DeleteNodeTemplateCtx(u.ctx, templateID); err != nil {
+		return err
+	}
+
+	if !u.transactional {
+		u.undo = append(u.undo, func(ctx context.Context) error {
+			_, err := u.scene.Repo.Create(ctx, "nodetemplate", record)
+			return err
+		})
+	}
+	return nil
+}
+
+// RegisterNodeFromTemplate registers a node from a template, see Scene.RegisterNodeFromTemplateCtx.
+func (u *UnitOfWork) RegisterNodeFromTemplate(templateID string, nodeInfo map[string]any) (string, error) {
+	// Load template
+	template, err := u.scene.GetNodeTemplateCtx(u.ctx, templateID)
+	if err != nil {
+		return "", err
+	}
+
+	// Create node
+	nodeID, err := u.RegisterNode(template.Schema, nodeInfo)
+	if err != nil {
+		return "", fmt.Errorf("failed to register node (Info: %v) from template (ID: %s): %v", nodeInfo, templateID, err)
+	}
+
+	// Update node attribute about template
+	err = u.updateNodeAttribute(nodeID, "template", func(ctx context.Context) error {
+		templateCtx := node.WithChangeSource(ctx, node.ChangeSource{
+			Type:        node.TemplateSource,
+			PrincipalID: auth.PrincipalFromContext(ctx).ID,
+			TemplateID:  templateID,
+		})
+		return u.scene.Tree.UpdateNodeAttributeCtx(templateCtx, nodeID, "template", templateID)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to update node (ID: %s) attribute about template (ID: %s): %v", nodeID, templateID, err)
+	}
+
+	// Bind all components to node
+	for _, compoID := range template.Components {
+		err = u.bindComponent(nodeID, compoID, true, func(ctx context.Context) error {
+			return u.scene.Tree.BindComponentToNodeCtx(ctx, nodeID, compoID)
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to bind component (ID: %s) to node (ID: %s): %v", compoID, nodeID, err)
+		}
+	}
+
+	return nodeID, nil
+}
+
+// hold makes a node rolled back as a whole in a transaction: an active node is written back before being changed,
+// and dropped from the cache on rollback. It reports if the node is rolled back as a whole.
+func (u *UnitOfWork) hold(ID string) (bool, error) {
+	if _, ok := u.nodes[ID]; ok {
+		return true, nil
+	}
+	if !u.transactional || ID == "" {
+		return false, nil
+	}
+
+	if err := u.scene.Tree.FlushNodeCtx(u.outer, ID); err != nil {
+		return false, fmt.Errorf("failed to write back node %v before changing it: %v", ID, err)
+	}
+	u.nodes[ID] = struct{}{}
+	u.undo = append(u.undo, u.discardNode(ID))
+	return true, nil
+}
+
+func (u *UnitOfWork) discardNode(ID string) func(context.Context) error {
+	return func(context.Context) error {
+		u.scene.Tree.DiscardNode(ID)
+		return nil
+	}
+}
+
+// updateNodeAttribute runs update, which updates an attribute of a node, and updates it back on rollback.
+func (u *UnitOfWork) updateNodeAttribute(ID string, attributeName string, update func(ctx context.Context) error) error {
+	whole, err := u.hold(ID)
+	if err != nil {
+		return err
+	}
+
+	var old any
+	if !whole {
+		n, err := u.scene.Tree.GetNodeCtx(u.ctx, ID)
+		if err != nil {
+			return fmt.Errorf("failed to get node by ID %v: %v", ID, err)
+		}
+		old = n.GetParam(attributeName)
+	}
+
+	if err := update(u.ctx); err != nil {
+		return err
+	}
+
+	if !whole {
+		u.undo = append(u.undo, func(ctx context.Context) error {
+			source := node.ChangeSourceFromContext(ctx)
+			source.Type = node.RevertSource
+			return u.scene.Tree.UpdateNodeAttributeCtx(node.WithChangeSource(ctx, source), ID, attributeName, old)
+		})
+	}
+	return nil
+}
+
+// bindComponent runs change, which binds a component to a node if bind or deletes it from the node otherwise,
+// and changes it back on rollback.
+func (u *UnitOfWork) bindComponent(nodeID, compoID string, bind bool, change func(ctx context.Context) error) error {
+	whole, err := u.hold(nodeID)
+	if err != nil {
+		return err
+	}
+
+	bound := false
+	if !whole {
+		n, err := u.scene.Tree.GetNodeCtx(u.ctx, nodeID)
+		if err != nil {
+			return fmt.Errorf("failed to get node by ID %v: %v", nodeID, err)
+		}
+		bound = hasComponent(n.GetParam("components"), compoID)
+	}
+
+	if err := change(u.ctx); err != nil {
+		return err
+	}
+
+	if whole || bound == bind {
+		return nil
+	}
+	u.undo = append(u.undo, func(ctx context.Context) error {
+		if bind {
+			return u.scene.Tree.DeleteComponentFromNodeCtx(ctx, nodeID, compoID)
+		}
+		return u.scene.Tree.BindComponentToNodeCtx(ctx, nodeID, compoID)
+	})
+	return nil
+}
+
+// rollback rolls back operations in reverse order, and returns the error failing the unit of work.
+func (u *UnitOfWork) rollback(cause error) error {
+	failed := 0
+	for i := len(u.undo) - 1; i >= 0; i-- {
+		if err := u.undo[i](u.outer); err != nil {
+			failed++
+			logger.FromContext(u.outer).WithError(err).Error("Failed to roll back an operation of scene %s", u.scene.Name)
+		}
+	}
+	u.undo = nil
+
+	if failed > 0 {
+		return fmt.Errorf("%d operations of scene %v are not rolled back after failure: %w", failed, u.scene.Name, cause)
+	}
+	return cause
+}
+
+func hasComponent(components any, compoID string) bool {
+	switch ids := components.(type) {
+	case []string:
+		for _, id := range ids {
+			if id == compoID {
+				return true
+			}
+		}
+	case []any:
+		for _, id := range ids {
+			if id == compoID {
+				return true
+			}
+		}
+	}
+	return false
+}
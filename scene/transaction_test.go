@@ -0,0 +1,182 @@
+package scene
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/world-in-progress/yggdrasil/db/memory"
+)
+
+var errAbort = errors.New("abort")
+
+type txKey struct{}
+
+// transactionalRepository simulates transactions of a memory repository, by deleting records created
+// in an aborted transaction. Records updated in a transaction are not restored.
+type transactionalRepository struct {
+	*memory.MemoryRepository
+
+	mu      sync.Mutex
+	created map[string][]string // IDs of records created in the transaction, by table
+}
+
+func (r *transactionalRepository) Create(ctx context.Context, table string, record map[string]any) (string, error) {
+	ID, err := r.MemoryRepository.Create(ctx, table, record)
+	if err == nil && ctx.Value(txKey{}) != nil {
+		r.mu.Lock()
+		r.created[table] = append(r.created[table], ID)
+		r.mu.Unlock()
+	}
+	return ID, err
+}
+
+func (r *transactionalRepository) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	r.mu.Lock()
+	r.created = make(map[string][]string)
+	r.mu.Unlock()
+
+	err := fn(context.WithValue(ctx, txKey{}, true))
+	if err != nil {
+		for table, IDs := range r.created {
+			for _, ID := range IDs {
+				r.MemoryRepository.Delete(ctx, table, map[string]any{"_id": ID})
+			}
+		}
+	}
+	return err
+}
+
+func TestTransactionCompensation(t *testing.T) {
+	scene := newTestScene(t)
+	compoID := newTestComponent(t, scene, func(w http.ResponseWriter, r *http.Request) {})
+	nodeID, err := scene.RegisterNode("SumNode", map[string]any{"name": "Node", "result": 0.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var childID, newCompoID string
+	err = scene.Transaction(func(uow *UnitOfWork) error {
+		var err error
+		if childID, err = uow.RegisterNode("SumNode", map[string]any{"name": "Child", "parent": nodeID, "result": 0.0}); err != nil {
+			return err
+		}
+		if err := uow.UpdateNodeAttribute(nodeID, "result", 1.0); err != nil {
+			return err
+		}
+		if err := uow.BindComponentToNode(nodeID, compoID); err != nil {
+			return err
+		}
+		if newCompoID, err = uow.RegisterComponent("RESTFUL", map[string]any{
+			"method": "GET",
+			"name":   "Other API",
+			"api":    "http://localhost",
+			"resStatuses": []any{
+				map[string]any{"code": 200, "schema": "application/json"},
+			},
+		}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("transaction is expected to fail by abort, but got %v", err)
+	}
+
+	if count, _ := scene.Tree.GetNodeRecordNum(); count != 1 {
+		t.Fatalf("registered child is expected to be deleted, but got %v node records", count)
+	}
+	node, err := scene.GetNode(nodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := node.GetParam("result"); result != 0.0 {
+		t.Fatalf("result is expected to be updated back, but got %v", result)
+	}
+	if hasComponent(node.GetParam("components"), compoID) {
+		t.Fatalf("component is expected to be unbound")
+	}
+	if len(node.GetChildIDs()) != 0 {
+		t.Fatalf("node is expected to have no child, but got %v", node.GetChildIDs())
+	}
+	if _, err := scene.GetNode(childID); err == nil {
+		t.Fatalf("child is expected to be deleted")
+	}
+	if _, err := scene.GetComponnet(newCompoID); err == nil {
+		t.Fatalf("registered component is expected to be deleted")
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	repo := &transactionalRepository{MemoryRepository: memory.NewMemoryRepository()}
+	scene, err := NewSceneWithRepository("Test scene", repo, 1, 4, 16, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(scene.Dispatcher.Shutdown)
+	if _, err = scene.Tree.RegistserNodeSchemaFromJson("node_schema_test.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	nodeID, err := scene.RegisterNode("SumNode", map[string]any{"name": "Node", "result": 0.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := scene.UpdateNodeAttribute(nodeID, "result", 1.0); err != nil {
+		t.Fatal(err)
+	}
+
+	var childID string
+	err = scene.Transaction(func(uow *UnitOfWork) error {
+		var err error
+		if childID, err = uow.RegisterNode("SumNode", map[string]any{"name": "Child", "parent": nodeID, "result": 0.0}); err != nil {
+			return err
+		}
+		if err := uow.UpdateNodeAttribute(nodeID, "result", 2.0); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("transaction is expected to fail by abort, but got %v", err)
+	}
+
+	// Changes made before the transaction are kept, and those made in it are discarded from the cache
+	node, err := scene.GetNode(nodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := node.GetParam("result"); result != 1.0 {
+		t.Fatalf("result is expected to be rolled back to 1, but got %v", result)
+	}
+	if len(node.GetChildIDs()) != 0 {
+		t.Fatalf("node is expected to have no child, but got %v", node.GetChildIDs())
+	}
+	if _, err := scene.GetNode(childID); err == nil {
+		t.Fatalf("child is expected to be rolled back")
+	}
+}
+
+func TestRegisterNodeFromTemplateRollback(t *testing.T) {
+	scene := newTestScene(t)
+	if _, err := scene.Tree.RegisterNodeSchema(map[string]any{
+		"name":   "PlainNode",
+		"fields": map[string]any{"name": map[string]any{"type": "string", "required": true}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	templateID, err := scene.RegisterNodeTemplate("Plain", "PlainNode", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nodes of the template have no attribute about template
+	if _, err := scene.RegisterNodeFromTemplate(templateID, map[string]any{"name": "Node"}); err == nil {
+		t.Fatalf("registration is expected to fail")
+	}
+	if count, _ := scene.Tree.GetNodeRecordNum(); count != 0 {
+		t.Fatalf("no node is expected to be left behind, but got %v node records", count)
+	}
+}